@@ -18,12 +18,22 @@ package analysis
 
 import (
 	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/internal/models/rules"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/detector"
 	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
 	"cpds/cpds-analyzer/internal/pkg/response"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	stringutil "cpds/cpds-analyzer/pkg/utils/string"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -35,7 +45,31 @@ type Handler interface {
 
 	DeleteResult() gin.HandlerFunc
 
+	AcknowledgeResults() gin.HandlerFunc
+
+	ExportResults() gin.HandlerFunc
+
 	GetRawData() gin.HandlerFunc
+
+	GetSummary() gin.HandlerFunc
+
+	GetStats() gin.HandlerFunc
+
+	Acknowledge() gin.HandlerFunc
+
+	Unacknowledge() gin.HandlerFunc
+
+	Assign() gin.HandlerFunc
+
+	Resolve() gin.HandlerFunc
+
+	Comment() gin.HandlerFunc
+
+	GetEvents() gin.HandlerFunc
+
+	GetTimeline() gin.HandlerFunc
+
+	GetContext() gin.HandlerFunc
 }
 
 type handler struct {
@@ -46,7 +80,7 @@ type handler struct {
 func New(logger *zap.Logger, db *gorm.DB, config *config.Config) Handler {
 	return &handler{
 		logger:   logger,
-		operator: analysis.NewOperator(config.DetectorOptions.Host, config.DetectorOptions.Port, db),
+		operator: analysis.NewOperator(cluster.FromConfig(config), config.CacheOptions, db),
 	}
 }
 
@@ -76,32 +110,127 @@ func (h *handler) GetResult() gin.HandlerFunc {
 
 func (h *handler) DeleteResult() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var req deleteResultRequest
-		if err := ctx.BindJSON(&req); err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_DELETE_RESULT_ERROR, err))
+		var req bulkRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_DELETE_RESULT_ERROR, err))
+			return
+		}
+
+		selector, err := req.selector()
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_DELETE_RESULT_ERROR, err))
 			return
 		}
 
-		if err := h.operator.DeleteAnalysisResultByID(req.ID); err != nil {
+		count, err := h.operator.DeleteResults(selector, req.DryRun)
+		if err != nil {
 			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_DELETE_RESULT_ERROR, err))
 			return
 		}
 
-		response.HandleOK(ctx, nil)
+		response.HandleOK(ctx, &bulkResponse{Count: count, DryRun: req.DryRun})
+	}
+}
+
+func (h *handler) AcknowledgeResults() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req bulkRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.User == "" || len(req.User) > maxUserLength {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_ACKNOWLEDGE_ERROR, errInvalidLifecycleRequest))
+			return
+		}
+
+		selector, err := req.selector()
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_ACKNOWLEDGE_ERROR, err))
+			return
+		}
+
+		count, err := h.operator.AcknowledgeResults(selector, req.User, req.DryRun)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_ACKNOWLEDGE_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &bulkResponse{Count: count, DryRun: req.DryRun})
+	}
+}
+
+// ExportResults exports the results matching the listing filters and the id
+// parameters as json lines.
+func (h *handler) ExportResults() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := ctx.Request.URL.Query()
+		filter, err := parseFilter(query)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_EXPORT_ERROR, err))
+			return
+		}
+		selector := &analysis.Selector{Filter: filter}
+		if selector.IDs, err = parseIDs(queryValues(query, "id")); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_EXPORT_ERROR, err))
+			return
+		}
+
+		if dryRun, _ := strconv.ParseBool(query.Get("dry_run")); dryRun {
+			count, err := h.operator.CountResults(selector)
+			if err != nil {
+				response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_EXPORT_ERROR, err))
+				return
+			}
+			response.HandleOK(ctx, &bulkResponse{Count: count, DryRun: true})
+			return
+		}
+
+		// results are streamed as they are read, once the first batch is
+		// written a failure can only cut the export short
+		started := false
+		start := func() {
+			ctx.Header("Content-Disposition", "attachment; filename=analysis-results.jsonl")
+			ctx.Header("Content-Type", "application/x-ndjson")
+			ctx.Status(http.StatusOK)
+			started = true
+		}
+		encoder := json.NewEncoder(ctx.Writer)
+		err = h.operator.ExportResults(selector, func(records []analysis.Analysis) error {
+			if !started {
+				start()
+			}
+			for i := range records {
+				if err := encoder.Encode(&records[i]); err != nil {
+					return err
+				}
+			}
+			ctx.Writer.Flush()
+			return nil
+		})
+		switch {
+		case err != nil && !started:
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_EXPORT_ERROR, err))
+		case err != nil:
+			h.logger.Warn("Failed to export analysis results", zap.Error(err))
+			ctx.Abort()
+		case !started:
+			start()
+		}
 	}
 }
 
 func (h *handler) GetRawData() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var req getRawDataRequset
-		if err := ctx.BindJSON(&req); err != nil {
+		id, options, err := parseRawDataParams(ctx)
+		if err != nil {
 			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_RAW_DATA_ERROR, err))
 			return
 		}
 
-		rawData, err := h.operator.GetRawData(req.ID)
+		rawData, err := h.operator.GetRawData(ctx.Request.Context(), id, options)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.HandleError(ctx, http.StatusNotFound, cpdserr.NewError(cpdserr.ANALYSIS_GET_RAW_DATA_ERROR, err))
+			return
+		}
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_GET_RAW_DATA_ERROR, err))
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.ANALYSIS_GET_RAW_DATA_ERROR, err))
 			return
 		}
 
@@ -113,6 +242,295 @@ func (h *handler) GetRawData() gin.HandlerFunc {
 	}
 }
 
+func (h *handler) Acknowledge() gin.HandlerFunc {
+	return h.transition(cpdserr.ANALYSIS_ACKNOWLEDGE_ERROR, func(id uint, req *lifecycleRequest) error {
+		return h.operator.AcknowledgeResult(id, req.User)
+	})
+}
+
+func (h *handler) Unacknowledge() gin.HandlerFunc {
+	return h.transition(cpdserr.ANALYSIS_UNACKNOWLEDGE_ERROR, func(id uint, req *lifecycleRequest) error {
+		return h.operator.UnacknowledgeResult(id, req.User)
+	})
+}
+
+func (h *handler) Assign() gin.HandlerFunc {
+	return h.transition(cpdserr.ANALYSIS_ASSIGN_ERROR, func(id uint, req *lifecycleRequest) error {
+		if req.Assignee == "" || len(req.Assignee) > maxUserLength {
+			return errInvalidLifecycleRequest
+		}
+		return h.operator.AssignResult(id, req.User, req.Assignee)
+	})
+}
+
+func (h *handler) Resolve() gin.HandlerFunc {
+	return h.transition(cpdserr.ANALYSIS_RESOLVE_ERROR, func(id uint, req *lifecycleRequest) error {
+		return h.operator.ResolveResult(id, req.User, req.Note)
+	})
+}
+
+func (h *handler) Comment() gin.HandlerFunc {
+	return h.transition(cpdserr.ANALYSIS_COMMENT_ERROR, func(id uint, req *lifecycleRequest) error {
+		if strings.TrimSpace(req.Comment) == "" {
+			return errInvalidLifecycleRequest
+		}
+		return h.operator.CommentResult(id, req.User, req.Comment)
+	})
+}
+
+func (h *handler) GetEvents() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseResultID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_EVENTS_ERROR, err))
+			return
+		}
+
+		events, err := h.operator.GetResultEvents(id)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_GET_EVENTS_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &getEventsResponse{Events: events})
+	}
+}
+
+func (h *handler) GetTimeline() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseResultID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_TIMELINE_ERROR, err))
+			return
+		}
+
+		timeline, err := h.operator.GetTimeline(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.HandleError(ctx, http.StatusNotFound, cpdserr.NewError(cpdserr.ANALYSIS_GET_TIMELINE_ERROR, err))
+			return
+		}
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_GET_TIMELINE_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, timeline)
+	}
+}
+
+func (h *handler) GetContext() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseResultID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_CONTEXT_ERROR, err))
+			return
+		}
+
+		resultContext, err := h.operator.GetResultContext(ctx.Request.Context(), id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.HandleError(ctx, http.StatusNotFound, cpdserr.NewError(cpdserr.ANALYSIS_GET_CONTEXT_ERROR, err))
+			return
+		}
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.ANALYSIS_GET_CONTEXT_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, resultContext)
+	}
+}
+
+// transition handles the lifecycle endpoints, apply validates the request
+// fields specific to the action and changes the result.
+func (h *handler) transition(code uint16, apply func(id uint, req *lifecycleRequest) error) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseResultID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, err))
+			return
+		}
+
+		var req lifecycleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.User == "" || len(req.User) > maxUserLength {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, errInvalidLifecycleRequest))
+			return
+		}
+
+		err = apply(id, &req)
+		switch {
+		case err == nil:
+			response.HandleOK(ctx, nil)
+		case err == errInvalidLifecycleRequest:
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, err))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			response.HandleError(ctx, http.StatusNotFound, cpdserr.NewError(code, err))
+		case errors.Is(err, analysis.ErrAlreadyAcknowledged), errors.Is(err, analysis.ErrNotAcknowledged),
+			errors.Is(err, analysis.ErrAlreadyAssigned), errors.Is(err, analysis.ErrAlreadyResolved):
+			response.HandleError(ctx, http.StatusConflict, cpdserr.NewError(code, err))
+		default:
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(code, err))
+		}
+	}
+}
+
+func parseResultID(ctx *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid result id")
+	}
+	return uint(id), nil
+}
+
+func (h *handler) GetSummary() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		filter, err := parseFilter(ctx.Request.URL.Query())
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_SUMMARY_ERROR, err))
+			return
+		}
+
+		summary, err := h.operator.GetSummary(filter)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_GET_SUMMARY_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, summary)
+	}
+}
+
+func (h *handler) GetStats() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := ctx.Request.URL.Query()
+		filter, err := parseFilter(query)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_STATS_ERROR, err))
+			return
+		}
+
+		options, err := parseStatsOptions(query)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.ANALYSIS_GET_STATS_ERROR, err))
+			return
+		}
+
+		stats, err := h.operator.GetStats(filter, options)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.ANALYSIS_GET_STATS_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, stats)
+	}
+}
+
+// parseStatsOptions reads the window of the statistics, the last
+// defaultStatsWindow by default, and picks the smallest of statsBuckets
+// giving at most maxStatsBuckets when no bucket is given.
+func parseStatsOptions(query url.Values) (*analysis.StatsOptions, error) {
+	options := &analysis.StatsOptions{
+		EndTime: time.Now().Unix(),
+		Top:     defaultStatsTop,
+	}
+
+	var err error
+	if v := query.Get("end_time"); v != "" {
+		if options.EndTime, err = strconv.ParseInt(v, 10, 64); err != nil || !timeutil.IsTimestamp(options.EndTime) {
+			return nil, errors.New("invalid end_time")
+		}
+	}
+	options.StartTime = options.EndTime - int64(defaultStatsWindow.Seconds())
+	if v := query.Get("start_time"); v != "" {
+		if options.StartTime, err = strconv.ParseInt(v, 10, 64); err != nil || !timeutil.IsTimestamp(options.StartTime) {
+			return nil, errors.New("invalid start_time")
+		}
+	}
+	if options.StartTime >= options.EndTime {
+		return nil, errors.New("start_time must be before end_time")
+	}
+
+	window := options.EndTime - options.StartTime
+	if v := query.Get("bucket"); v != "" {
+		if options.Bucket, err = parseSeconds(v); err != nil || options.Bucket <= 0 {
+			return nil, errors.New("invalid bucket")
+		}
+	} else {
+		for _, bucket := range statsBuckets {
+			options.Bucket = int64(bucket.Seconds())
+			if window/options.Bucket <= maxStatsBuckets {
+				break
+			}
+		}
+	}
+	if (window+options.Bucket-1)/options.Bucket > maxStatsBuckets {
+		return nil, fmt.Errorf("too many buckets, at most %d are allowed", maxStatsBuckets)
+	}
+
+	if v := query.Get("top"); v != "" {
+		if options.Top, err = strconv.Atoi(v); err != nil || options.Top <= 0 || options.Top > maxStatsTop {
+			return nil, fmt.Errorf("invalid top, should be 1 - %d", maxStatsTop)
+		}
+	}
+
+	return options, nil
+}
+
+// parseRawDataParams reads the result id from the id parameter, falling back
+// to a json body for older clients, and the padding and step durations.
+func parseRawDataParams(ctx *gin.Context) (uint, *analysis.RawDataOptions, error) {
+	var id uint
+	if v := ctx.Query("id"); v != "" {
+		parsed, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return 0, nil, errors.New("invalid result id")
+		}
+		id = uint(parsed)
+	} else {
+		var req getRawDataRequset
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.ID == 0 {
+			return 0, nil, errors.New("id is required")
+		}
+		id = req.ID
+	}
+
+	options := &analysis.RawDataOptions{}
+	durations := []struct {
+		key   string
+		value *int64
+	}{
+		{"padding", &options.PaddingBefore},
+		{"padding", &options.PaddingAfter},
+		{"padding_before", &options.PaddingBefore},
+		{"padding_after", &options.PaddingAfter},
+		{"step", &options.Step},
+	}
+	for _, d := range durations {
+		v := ctx.Query(d.key)
+		if v == "" {
+			continue
+		}
+		seconds, err := parseSeconds(v)
+		if err != nil || seconds < 0 {
+			return 0, nil, fmt.Errorf("invalid %s", d.key)
+		}
+		*d.value = seconds
+	}
+
+	return id, options, nil
+}
+
+// parseSeconds parses a duration such as 10m, or a number of seconds.
+func parseSeconds(v string) (int64, error) {
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return seconds, nil
+	}
+	d, err := timeutil.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	return int64(d.Seconds()), nil
+}
+
 func parseGetResultParams(ctx *gin.Context) (*getResultOptions, error) {
 	pageNo, err := strconv.Atoi(ctx.DefaultQuery("page_no", "1"))
 	if err != nil {
@@ -124,11 +542,146 @@ func parseGetResultParams(ctx *gin.Context) (*getResultOptions, error) {
 		return nil, fmt.Errorf("invalid params")
 	}
 
+	filter, err := parseFilter(ctx.Request.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	sortField := ctx.DefaultQuery("sort_field", "rule_name")
+	if !stringutil.IsStringInArray(sortField, analysis.SortFields) {
+		return nil, fmt.Errorf("invalid sort field %s", sortField)
+	}
+
+	sortOrder := ctx.DefaultQuery("sort_order", "asc")
+	if sortOrder != "asc" && sortOrder != "desc" {
+		return nil, fmt.Errorf("invalid sort order %s", sortOrder)
+	}
+
 	return &getResultOptions{
-		filter:    ctx.Query("filter"),
-		sortField: ctx.DefaultQuery("sort_field", "rule_name"),
-		sortOrder: ctx.DefaultQuery("sort_order", "asc"),
+		filter:    filter,
+		sortField: sortField,
+		sortOrder: sortOrder,
 		pageNo:    pageNo,
 		pageSize:  pageSize,
 	}, nil
 }
+
+// parseFilter reads the result filter from a query. Fields taking several
+// values accept both repeated parameters and comma separated values.
+func parseFilter(query url.Values) (*analysis.Filter, error) {
+	filter := &analysis.Filter{
+		RuleName:   query.Get("filter"),
+		Statuses:   queryValues(query, "status"),
+		Instances:  queryValues(query, "instance"),
+		Pods:       queryValues(query, "pod"),
+		Containers: queryValues(query, "container"),
+		Clusters:   queryValues(query, "cluster"),
+		Severities: queryValues(query, "severity"),
+	}
+
+	for _, status := range filter.Statuses {
+		if !stringutil.IsStringInArray(status, analysis.Statuses) {
+			return nil, fmt.Errorf("invalid status %s", status)
+		}
+	}
+
+	var err error
+	if filter.Labels, err = rules.ParseLabelSelector(query.Get("labels")); err != nil {
+		return nil, err
+	}
+
+	if filter.RuleIDs, err = parseIDs(queryValues(query, "rule_id")); err != nil {
+		return nil, err
+	}
+
+	if minRank := query.Get("min_severity_rank"); minRank != "" {
+		if filter.MinSeverityRank, err = strconv.Atoi(minRank); err != nil {
+			return nil, fmt.Errorf("invalid params")
+		}
+	}
+
+	bounds := map[string]*int64{
+		"create_time_start": &filter.CreateTimeStart,
+		"create_time_end":   &filter.CreateTimeEnd,
+		"update_time_start": &filter.UpdateTimeStart,
+		"update_time_end":   &filter.UpdateTimeEnd,
+	}
+	for key, bound := range bounds {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		if *bound, err = strconv.ParseInt(v, 10, 64); err != nil || !timeutil.IsTimestamp(*bound) {
+			return nil, fmt.Errorf("invalid %s", key)
+		}
+	}
+
+	// since is a shorthand for the results active over the last duration
+	if since := query.Get("since"); since != "" {
+		d, err := timeutil.ParseDuration(since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %s", err)
+		}
+		filter.UpdateTimeStart = time.Now().Add(-d).Unix()
+	}
+
+	flags := map[string]**bool{
+		"acknowledged": &filter.Acknowledged,
+		"resolved":     &filter.Resolved,
+		"flapping":     &filter.Flapping,
+	}
+	for key, flag := range flags {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", key)
+		}
+		*flag = &b
+	}
+	filter.Assignees = queryValues(query, "assignee")
+
+	switch query.Get("flaps") {
+	case "", "collapse":
+	case "show":
+		filter.ShowFlapping = true
+	default:
+		return nil, fmt.Errorf("invalid flaps")
+	}
+
+	switch query.Get("inhibited") {
+	case "", "group":
+	case "show":
+		filter.ShowInhibited = true
+	default:
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	return filter, nil
+}
+
+func queryValues(query url.Values, key string) []string {
+	values := make([]string, 0)
+	for _, param := range query[key] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
+
+func parseIDs(values []string) ([]uint, error) {
+	ids := make([]uint, 0, len(values))
+	for _, v := range values {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %s", v)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
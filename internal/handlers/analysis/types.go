@@ -18,11 +18,29 @@ package analysis
 
 import (
 	"cpds/cpds-analyzer/internal/models/analysis"
-	"cpds/cpds-analyzer/pkg/prometheus"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
 )
 
+// maxUserLength matches the size of the user columns of results and events
+const maxUserLength = 64
+
+var errInvalidLifecycleRequest = errors.New("invalid params")
+
+const (
+	defaultStatsWindow = 30 * 24 * time.Hour
+	defaultStatsTop    = 10
+	maxStatsTop        = 100
+	maxStatsBuckets    = 1000
+)
+
+// statsBuckets are the bucket sizes picked from when none is given
+var statsBuckets = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
 type getResultOptions struct {
-	filter    string
+	filter    *analysis.Filter
 	sortField string
 	sortOrder string
 	pageNo    int
@@ -36,8 +54,46 @@ type getResultResponse struct {
 	PageSize  int                 `json:"page_size"`
 }
 
-type deleteResultRequest struct {
-	ID uint `json:"id"`
+// bulkRequest selects results by id, ids and query, a query string taking
+// the filters of the result listing such as "status=fault&rule_id=3". Given
+// together they narrow each other down. A query without filters is ignored,
+// so that it never selects every result.
+type bulkRequest struct {
+	ID     uint    `json:"id"`
+	IDs    []uint  `json:"ids"`
+	Query  *string `json:"query"`
+	DryRun bool    `json:"dry_run"`
+	User   string  `json:"user"`
+}
+
+func (r *bulkRequest) selector() (*analysis.Selector, error) {
+	selector := &analysis.Selector{IDs: r.IDs}
+	if r.ID != 0 {
+		selector.IDs = append(selector.IDs, r.ID)
+	}
+
+	if r.Query != nil {
+		query, err := url.ParseQuery(*r.Query)
+		if err != nil {
+			return nil, fmt.Errorf("invalid query: %s", err)
+		}
+		if selector.Filter, err = parseFilter(query); err != nil {
+			return nil, err
+		}
+	}
+
+	if selector.Filter != nil && !selector.Filter.HasCriteria() {
+		selector.Filter = nil
+	}
+	if len(selector.IDs) == 0 && selector.Filter == nil {
+		return nil, errors.New("id, ids or a query with filters is required")
+	}
+	return selector, nil
+}
+
+type bulkResponse struct {
+	Count  int  `json:"count"`
+	DryRun bool `json:"dry_run"`
 }
 
 type getRawDataRequset struct {
@@ -45,5 +101,18 @@ type getRawDataRequset struct {
 }
 
 type getRawDataResponse struct {
-	Records *prometheus.Metric `json:"records"`
+	Records *analysis.RawData `json:"records"`
+}
+
+// lifecycleRequest is the body of the acknowledge, unacknowledge, assign,
+// resolve and comment endpoints, user is who takes the action.
+type lifecycleRequest struct {
+	User     string `json:"user"`
+	Assignee string `json:"assignee"`
+	Note     string `json:"note"`
+	Comment  string `json:"comment"`
+}
+
+type getEventsResponse struct {
+	Events []analysis.AnalysisEvent `json:"events"`
 }
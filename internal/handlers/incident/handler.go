@@ -0,0 +1,152 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package incident
+
+import (
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
+	"cpds/cpds-analyzer/internal/pkg/response"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	stringutil "cpds/cpds-analyzer/pkg/utils/string"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler interface {
+	Get() gin.HandlerFunc
+}
+
+type handler struct {
+	logger   *zap.Logger
+	operator analysis.Operator
+}
+
+func New(logger *zap.Logger, db *gorm.DB, config *config.Config) Handler {
+	return &handler{
+		logger:   logger,
+		operator: analysis.NewOperator(cluster.FromConfig(config), config.CacheOptions, db),
+	}
+}
+
+func (h *handler) Get() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		opt, err := parseGetParams(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.INCIDENT_GET_ERROR, err))
+			return
+		}
+
+		records, err := h.operator.GetIncidents(opt.filter, opt.pageNo, opt.pageSize)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.INCIDENT_GET_ERROR, err))
+			return
+		}
+
+		total, err := h.operator.CountIncidents(opt.filter)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.INCIDENT_GET_ERROR, err))
+			return
+		}
+
+		responseData := &getResponse{
+			Records:   records,
+			PageNo:    opt.pageNo,
+			PageSize:  opt.pageSize,
+			PageTotal: total,
+		}
+		response.HandleOK(ctx, responseData)
+	}
+}
+
+func parseGetParams(ctx *gin.Context) (*getOptions, error) {
+	pageNo, err := strconv.Atoi(ctx.DefaultQuery("page_no", "1"))
+	if err != nil || pageNo < 1 {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	pageSize, err := strconv.Atoi(ctx.DefaultQuery("page_size", "10"))
+	if err != nil || pageSize < 1 {
+		return nil, fmt.Errorf("invalid params")
+	}
+
+	query := ctx.Request.URL.Query()
+	filter := &analysis.IncidentFilter{
+		Statuses:  queryValues(query, "status"),
+		Instances: queryValues(query, "instance"),
+		Pods:      queryValues(query, "pod"),
+		Clusters:  queryValues(query, "cluster"),
+	}
+
+	for _, status := range filter.Statuses {
+		if !stringutil.IsStringInArray(status, analysis.IncidentStatuses) {
+			return nil, fmt.Errorf("invalid status %s", status)
+		}
+	}
+
+	bounds := map[string]*int64{
+		"start_time_start": &filter.StartTimeFrom,
+		"start_time_end":   &filter.StartTimeTo,
+	}
+	for key, bound := range bounds {
+		v := query.Get(key)
+		if v == "" {
+			continue
+		}
+		if *bound, err = strconv.ParseInt(v, 10, 64); err != nil || !timeutil.IsTimestamp(*bound) {
+			return nil, fmt.Errorf("invalid %s", key)
+		}
+	}
+
+	// since is a shorthand for the incidents started over the last duration
+	if since := query.Get("since"); since != "" {
+		d, err := timeutil.ParseDuration(since)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since: %s", err)
+		}
+		filter.StartTimeFrom = time.Now().Add(-d).Unix()
+	}
+
+	return &getOptions{
+		filter:   filter,
+		pageNo:   pageNo,
+		pageSize: pageSize,
+	}, nil
+}
+
+// queryValues returns the values of key, given as repeated parameters or
+// comma separated values.
+func queryValues(query url.Values, key string) []string {
+	values := make([]string, 0)
+	for _, param := range query[key] {
+		for _, v := range strings.Split(param, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
@@ -17,17 +17,26 @@
 package monitor
 
 import (
+	"cpds/cpds-analyzer/internal/models/analysis"
 	"cpds/cpds-analyzer/internal/models/monitor"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/detector"
 	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
 	"cpds/cpds-analyzer/internal/pkg/response"
+	"cpds/cpds-analyzer/internal/pkg/stream"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler interface {
@@ -44,25 +53,77 @@ type Handler interface {
 	GetNodeResource() gin.HandlerFunc
 
 	GetNodeContainerStatus() gin.HandlerFunc
+
+	Stream() gin.HandlerFunc
 }
 
+// handler streams every cluster or a single one, every stream has its hub
+// keyed by the cluster, empty for every cluster.
 type handler struct {
-	logger   *zap.Logger
-	operator monitor.Operator
+	logger    *zap.Logger
+	operator  *monitor.Federation
+	hubs      map[string]*stream.Hub
+	heartbeat time.Duration
 }
 
-func New(config *config.Config, logger *zap.Logger) Handler {
+func New(config *config.Config, logger *zap.Logger, db *gorm.DB) Handler {
+	clusters := cluster.FromConfig(config)
+	operator := monitor.NewFederation(clusters, config.CacheOptions)
+	analysisOperator := analysis.NewOperator(clusters, config.CacheOptions, db)
+	options := config.StreamOptions
+
+	interval, err := timeutil.ParseDuration(options.Interval)
+	if err != nil {
+		logger.Error("Invalid stream interval, using 5s", zap.String("interval", options.Interval), zap.Error(err))
+		interval = 5 * time.Second
+	}
+	heartbeat, err := timeutil.ParseDuration(options.Heartbeat)
+	if err != nil {
+		logger.Error("Invalid stream heartbeat, using 15s", zap.String("heartbeat", options.Heartbeat), zap.Error(err))
+		heartbeat = 15 * time.Second
+	}
+
+	hubs := make(map[string]*stream.Hub, len(clusters)+1)
+	newHub := func(clusters cluster.Clusters, all bool) *stream.Hub {
+		return stream.NewHub(&statusPoller{
+			logger:   logger,
+			monitor:  operator,
+			analysis: analysisOperator,
+			clusters: clusters,
+			all:      all,
+			interval: interval,
+		}, options.BufferSize)
+	}
+	hubs[""] = newHub(clusters, true)
+	for _, c := range clusters {
+		hubs[c.Name] = newHub(cluster.Clusters{c}, false)
+	}
+
 	return &handler{
-		logger:   logger,
-		operator: monitor.NewOperator(config.DetectorOptions.Host, config.DetectorOptions.Port),
+		logger:    logger,
+		operator:  operator,
+		hubs:      hubs,
+		heartbeat: heartbeat,
 	}
 }
 
+// parseClusters returns the clusters selected by the cluster parameter,
+// every cluster if it is not given.
+func (h *handler) parseClusters(ctx *gin.Context) (cluster.Clusters, error) {
+	return h.operator.Clusters().Select(ctx.Query("cluster"))
+}
+
 func (h *handler) GetMonitorTargets() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		data, err := h.operator.GetMonitorTargets()
+		clusters, err := h.parseClusters(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_TARGET_ERROR, err))
+			return
+		}
+
+		data, err := h.operator.GetMonitorTargets(ctx.Request.Context(), clusters)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_TARGET_ERROR, err))
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_TARGET_ERROR, err))
 			return
 		}
 
@@ -78,9 +139,15 @@ func (h *handler) GetClusterResource() gin.HandlerFunc {
 			return
 		}
 
-		data, err := h.operator.GetClusterResource(time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		clusters, err := h.parseClusters(ctx)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_RESOURCES_ERROR, err))
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_RESOURCES_ERROR, err))
+			return
+		}
+
+		data, err := h.operator.GetClusterResource(ctx.Request.Context(), clusters, time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_RESOURCES_ERROR, err))
 			return
 		}
 
@@ -96,9 +163,15 @@ func (h *handler) GetClusterContainerStatus() gin.HandlerFunc {
 			return
 		}
 
-		data, err := h.operator.GetClusterContainerStatus(time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		clusters, err := h.parseClusters(ctx)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
+			return
+		}
+
+		data, err := h.operator.GetClusterContainerStatus(ctx.Request.Context(), clusters, time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
 			return
 		}
 
@@ -108,10 +181,16 @@ func (h *handler) GetClusterContainerStatus() gin.HandlerFunc {
 
 func (h *handler) GetNodeInfo() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		clusters, err := h.parseClusters(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_INFO_ERROR, err))
+			return
+		}
+
 		instance := ctx.Query("instance")
-		records, err := h.operator.GetNodeInfo(instance)
+		records, err := h.operator.GetNodeInfo(ctx.Request.Context(), clusters, instance)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_INFO_ERROR, err))
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_NODE_INFO_ERROR, err))
 			return
 		}
 
@@ -122,10 +201,16 @@ func (h *handler) GetNodeInfo() gin.HandlerFunc {
 
 func (h *handler) GetNodeStatus() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		clusters, err := h.parseClusters(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_STATUS_ERROR, err))
+			return
+		}
+
 		instance := ctx.Query("instance")
-		records, err := h.operator.GetNodeStatus(instance)
+		records, err := h.operator.GetNodeStatus(ctx.Request.Context(), clusters, instance)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_STATUS_ERROR, err))
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_NODE_STATUS_ERROR, err))
 			return
 		}
 
@@ -141,9 +226,15 @@ func (h *handler) GetNodeResource() gin.HandlerFunc {
 			return
 		}
 
-		records, err := h.operator.GetNodeResources(p.Instance, time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		clusters, err := h.parseClusters(ctx)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_RESOURCES_ERROR, err))
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_NODE_RESOURCES_ERROR, err))
+			return
+		}
+
+		records, err := h.operator.GetNodeResources(ctx.Request.Context(), clusters, p.Instance, time.Unix(p.StartTime, 0), time.Unix(p.EndTime, 0), p.StepSecond)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_NODE_RESOURCES_ERROR, err))
 			return
 		}
 
@@ -159,9 +250,15 @@ func (h *handler) GetNodeContainerStatus() gin.HandlerFunc {
 			return
 		}
 
-		records, err := h.operator.GetNodeContainerStatus(instance)
+		clusters, err := h.parseClusters(ctx)
 		if err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
+			return
+		}
+
+		records, err := h.operator.GetNodeContainerStatus(ctx.Request.Context(), clusters, instance)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR, err))
 			return
 		}
 
@@ -169,6 +266,51 @@ func (h *handler) GetNodeContainerStatus() gin.HandlerFunc {
 	}
 }
 
+// Stream pushes node status, target changes and new analysis results as
+// server-sent events until the client goes away.
+func (h *handler) Stream() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		topics, err := parseStreamTopics(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_STREAM_ERROR, err))
+			return
+		}
+
+		if _, err := h.parseClusters(ctx); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.MONITOR_STREAM_ERROR, err))
+			return
+		}
+
+		hub := h.hubs[ctx.Query("cluster")]
+		subscription := hub.Subscribe(topics)
+		defer hub.Unsubscribe(subscription)
+
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Header("Connection", "keep-alive")
+		ctx.Header("X-Accel-Buffering", "no")
+
+		heartbeat := time.NewTicker(h.heartbeat)
+		defer heartbeat.Stop()
+
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case e, ok := <-subscription.Events():
+				if !ok {
+					h.logger.Warn("Dropped a monitor stream falling behind", zap.String("client", ctx.ClientIP()))
+					return false
+				}
+				ctx.SSEvent(e.Name, e.Data)
+				return true
+			case <-heartbeat.C:
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err == nil
+			}
+		})
+	}
+}
+
 func parseInstanceFromParams(ctx *gin.Context) (string, error) {
 	instance, exist := ctx.GetQuery("instance")
 	if !exist {
@@ -225,3 +367,30 @@ func parseClusterMonitorDataQueryParams(ctx *gin.Context) (*clusterMonitorQueryP
 
 	return &p, nil
 }
+
+// parseStreamTopics accepts topics either comma separated or repeated, none
+// meaning every topic.
+func parseStreamTopics(ctx *gin.Context) ([]string, error) {
+	var topics []string
+	for _, v := range ctx.QueryArray("topics") {
+		for _, topic := range strings.Split(v, ",") {
+			if topic = strings.TrimSpace(topic); topic == "" {
+				continue
+			}
+			if !isStreamTopic(topic) {
+				return nil, fmt.Errorf("invalid topic: %s, should be one of %s", topic, strings.Join(streamTopics, ", "))
+			}
+			topics = append(topics, topic)
+		}
+	}
+	return topics, nil
+}
+
+func isStreamTopic(topic string) bool {
+	for _, t := range streamTopics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
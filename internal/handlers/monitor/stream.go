@@ -0,0 +1,177 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/internal/models/monitor"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/stream"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	topicNodeStatus = "node_status"
+	topicTargets    = "targets"
+	topicResults    = "results"
+)
+
+var streamTopics = []string{topicNodeStatus, topicTargets, topicResults}
+
+// resultsPerPoll bounds the results read at once, more are read until the
+// last one is reached
+const resultsPerPoll = 100
+
+// targetChange is a target coming up, going down, appearing or vanishing,
+// Status is empty when it vanished and PreviousStatus when it appeared.
+type targetChange struct {
+	Instance       string `json:"instance"`
+	Cluster        string `json:"cluster"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status"`
+}
+
+// targetKey identifies a target across clusters.
+type targetKey struct {
+	cluster, instance string
+}
+
+// statusPoller polls the detectors of clusters and the results for the
+// stream. Only the stream of every cluster, all, carries the results not
+// assigned to a cluster yet.
+type statusPoller struct {
+	logger   *zap.Logger
+	monitor  *monitor.Federation
+	analysis analysis.Operator
+	clusters cluster.Clusters
+	all      bool
+	interval time.Duration
+}
+
+func (p *statusPoller) Run(ctx context.Context, publish func(stream.Event)) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	// results stored before the stream started are not streamed
+	lastID, err := p.analysis.LastResultID()
+	if err != nil {
+		p.logger.Warn("Failed to get the last analysis result", zap.Error(err))
+	}
+	cursor := err == nil
+
+	var targets map[targetKey]string
+	for {
+		p.pollNodeStatus(ctx, publish)
+		targets = p.pollTargets(ctx, targets, publish)
+		if cursor {
+			lastID = p.pollResults(lastID, publish)
+		} else if lastID, err = p.analysis.LastResultID(); err == nil {
+			cursor = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *statusPoller) pollNodeStatus(ctx context.Context, publish func(stream.Event)) {
+	status, err := p.monitor.GetNodeStatus(ctx, p.clusters, "")
+	if err != nil {
+		p.logger.Warn("Failed to poll node status", zap.Error(err))
+		return
+	}
+	publish(stream.Event{Topic: topicNodeStatus, Name: "node_status", Data: status, Retained: true})
+}
+
+// pollTargets publishes the targets when they change, along with every
+// change. previous is nil on the first poll.
+func (p *statusPoller) pollTargets(ctx context.Context, previous map[targetKey]string, publish func(stream.Event)) map[targetKey]string {
+	targets, err := p.monitor.GetMonitorTargets(ctx, p.clusters)
+	if err != nil {
+		p.logger.Warn("Failed to poll monitor targets", zap.Error(err))
+		return previous
+	}
+
+	current := make(map[targetKey]string, len(targets.Targets))
+	for _, target := range targets.Targets {
+		current[targetKey{target.Cluster, target.Instance}] = target.Status
+	}
+
+	changes := make([]targetChange, 0)
+	if previous != nil {
+		for _, target := range targets.Targets {
+			if status, ok := previous[targetKey{target.Cluster, target.Instance}]; !ok || status != target.Status {
+				changes = append(changes, targetChange{Instance: target.Instance, Cluster: target.Cluster, Status: target.Status, PreviousStatus: status})
+			}
+		}
+		for key, status := range previous {
+			if _, ok := current[key]; !ok {
+				changes = append(changes, targetChange{Instance: key.instance, Cluster: key.cluster, PreviousStatus: status})
+			}
+		}
+	}
+
+	if previous == nil || len(changes) != 0 {
+		publish(stream.Event{Topic: topicTargets, Name: "targets", Data: targets, Retained: true})
+	}
+	for _, change := range changes {
+		publish(stream.Event{Topic: topicTargets, Name: "target", Data: change})
+	}
+	return current
+}
+
+// pollResults publishes the results stored after lastID, it returns the id
+// of the last one published.
+func (p *statusPoller) pollResults(lastID uint, publish func(stream.Event)) uint {
+	for {
+		records, err := p.analysis.GetResultsAfter(lastID, resultsPerPoll)
+		if err != nil {
+			p.logger.Warn("Failed to poll analysis results", zap.Error(err))
+			return lastID
+		}
+
+		for _, r := range records {
+			lastID = r.ID
+			if !p.wants(&r) {
+				continue
+			}
+			publish(stream.Event{Topic: topicResults, Name: "result", Data: r})
+		}
+		if len(records) < resultsPerPoll {
+			return lastID
+		}
+	}
+}
+
+// wants reports whether the result belongs to the stream.
+func (p *statusPoller) wants(r *analysis.Analysis) bool {
+	if p.all || r.Cluster == "" {
+		return p.all
+	}
+	for _, c := range p.clusters {
+		if c.Name == r.Cluster {
+			return true
+		}
+	}
+	return false
+}
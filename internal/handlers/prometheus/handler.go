@@ -18,6 +18,8 @@ package prometheus
 
 import (
 	"cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/detector"
 	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
 	"cpds/cpds-analyzer/internal/pkg/response"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
@@ -41,13 +43,13 @@ type Handler interface {
 
 type handler struct {
 	logger   *zap.Logger
-	operator prometheus.Operator
+	operator *prometheus.Federation
 }
 
 func New(logger *zap.Logger, config *config.Config) Handler {
 	return &handler{
 		logger:   logger,
-		operator: prometheus.NewOperator(config.DetectorOptions.Host, config.DetectorOptions.Port),
+		operator: prometheus.NewFederation(cluster.FromConfig(config), config.CacheOptions),
 	}
 }
 
@@ -59,12 +61,18 @@ func (h handler) Query() gin.HandlerFunc {
 			return
 		}
 
-		metric, err := h.operator.Query(p.Query, p.Time)
+		clusters, err := h.operator.Clusters().Select(p.Cluster)
 		if err != nil {
 			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_ERROR, err))
 			return
 		}
 
+		metric, err := h.operator.Query(ctx.Request.Context(), clusters, p.Query, p.Time)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusBadRequest), cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_ERROR, err))
+			return
+		}
+
 		response.HandleOK(ctx, metric)
 	}
 }
@@ -77,9 +85,15 @@ func (h handler) QueryRange() gin.HandlerFunc {
 			return
 		}
 
-		metric, err := h.operator.QueryRange(p.Query, p.StartTime, p.EndTime, p.StepSecond)
+		clusters, err := h.operator.Clusters().Select(p.Cluster)
 		if err != nil {
-			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_ERROR, err))
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_RANGE_ERROR, err))
+			return
+		}
+
+		metric, err := h.operator.QueryRange(ctx.Request.Context(), clusters, p.Query, p.StartTime, p.EndTime, p.StepSecond)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusBadRequest), cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_ERROR, err))
 			return
 		}
 
@@ -100,6 +114,11 @@ func (h handler) QueryValidate() gin.HandlerFunc {
 			return
 		}
 
+		if _, err := h.operator.Clusters().Select(ctx.Query("cluster")); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.PROMETHEUS_QUERY_VALIDATE_ERROR, err))
+			return
+		}
+
 		response.HandleOK(ctx, nil)
 	}
 }
@@ -111,6 +130,7 @@ func parseQueryParams(ctx *gin.Context) (*queryParams, error) {
 	if p.Query == "" {
 		return nil, errors.New("query cannot be empty")
 	}
+	p.Cluster = ctx.Query("cluster")
 
 	timeStr := ctx.Query("time")
 	if timeStr == "" {
@@ -152,5 +172,6 @@ func parseQueryRangeParams(ctx *gin.Context) (*queryRangeParams, error) {
 		StartTime:  startTime,
 		EndTime:    endTime,
 		StepSecond: step,
+		Cluster:    ctx.Query("cluster"),
 	}, nil
 }
@@ -17,8 +17,9 @@
 package prometheus
 
 type queryParams struct {
-	Query string `json:"query"`
-	Time  int64  `json:"time"`
+	Query   string `json:"query"`
+	Time    int64  `json:"time"`
+	Cluster string `json:"cluster"`
 }
 
 type queryRangeParams struct {
@@ -26,4 +27,5 @@ type queryRangeParams struct {
 	StartTime  int64  `json:"start_time"`
 	EndTime    int64  `json:"end_time"`
 	StepSecond int64  `json:"step"`
+	Cluster    string `json:"cluster"`
 }
@@ -18,18 +18,19 @@ package rules
 
 import (
 	"cpds/cpds-analyzer/internal/models/rules"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/detector"
 	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
 	"cpds/cpds-analyzer/internal/pkg/response"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
-	prometheusutil "cpds/cpds-analyzer/pkg/utils/prometheus"
 	stringutil "cpds/cpds-analyzer/pkg/utils/string"
 	timeutil "cpds/cpds-analyzer/pkg/utils/time"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
-	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -44,24 +45,52 @@ type Handler interface {
 	Delete() gin.HandlerFunc
 
 	Update() gin.HandlerFunc
+
+	Backtest() gin.HandlerFunc
+
+	GetHistory() gin.HandlerFunc
+
+	Diff() gin.HandlerFunc
+
+	Rollback() gin.HandlerFunc
+
+	Export() gin.HandlerFunc
+
+	Import() gin.HandlerFunc
+
+	GetExpanded() gin.HandlerFunc
+
+	Enable() gin.HandlerFunc
+
+	Disable() gin.HandlerFunc
+
+	Lint() gin.HandlerFunc
+
+	GetSyncStatus() gin.HandlerFunc
 }
 
 type handler struct {
 	config   *config.Config
 	logger   *zap.Logger
+	clusters cluster.Clusters
 	operator rules.Operator
 }
 
 func New(config *config.Config, logger *zap.Logger, db *gorm.DB) Handler {
+	clusters := cluster.FromConfig(config)
 	return &handler{
 		logger:   logger,
-		operator: rules.NewOperator(config.DetectorOptions.Host, config.DetectorOptions.Port, db),
+		clusters: clusters,
+		operator: rules.NewOperator(clusters, config.CacheOptions, db),
 	}
 }
 
 func (h *handler) Get() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		opt, err := parseGetParams(ctx)
+		if err == nil && opt.filter.Cluster != "" {
+			_, err = h.clusters.Get(opt.filter.Cluster)
+		}
 		if err != nil {
 			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_GET_ERROR, err))
 			return
@@ -89,43 +118,23 @@ func (h *handler) Create() gin.HandlerFunc {
 			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, err))
 			return
 		}
-		var SubhealthThresholds,_ = strconv.ParseFloat(getRule.Rules.SubhealthThresholds,64)
-		var FaultThresholds,_ = strconv.ParseFloat(getRule.Rules.FaultThresholds,64)
-		req := &createRequest{
-			&rules.Rule{
-				ID: getRule.ID,
-				Name: getRule.Rules.Name,
-				CreateTime: getRule.Rules.CreateTime,
-				UpdateTime: getRule.Rules.UpdateTime,
-				Duration: getRule.Rules.Duration,
-				Expression: getRule.Rules.Expression,
-				SubhealthConditionType: getRule.Rules.SubhealthConditionType,
-				SubhealthThresholds: SubhealthThresholds,
-				FaultConditionType: getRule.Rules.FaultConditionType,
-				FaultThresholds: FaultThresholds,
-				Severity: getRule.Rules.Severity,
-			},
-		}
-		if err := validateRule(req.Rule); err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, err))
+		if getRule.Rules == nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, errors.New("invalid params")))
 			return
 		}
-
-		if err := h.operator.CreateRule(req.Rule); err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, err))
+		req := &createRequest{newRuleFromRequest(getRule.Rules)}
+		issues := h.operator.LintRule(ctx.Request.Context(), req.Rule)
+		if err := issues.Err(); err != nil {
+			response.HandleErrorWithData(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, err), &lintResponse{Issues: issues})
 			return
 		}
 
-		if err := h.operator.SendRuleUpdatedRequset(); err != nil {
-			response.HandleError(
-				ctx,
-				http.StatusInternalServerError,
-				cpdserr.NewError(cpdserr.DETECTOR_ERROR, fmt.Errorf("create rule success but unable to start analysis: %s", err)),
-			)
+		if err := h.operator.CreateRule(req.Rule); err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_CREATE_ERROR, err))
 			return
 		}
 
-		response.HandleOK(ctx, nil)
+		response.HandleOK(ctx, &lintResponse{Issues: issues})
 	}
 }
 
@@ -136,44 +145,24 @@ func (h *handler) Update() gin.HandlerFunc {
 			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, err))
 			return
 		}
-		var SubhealthThresholds,_ = strconv.ParseFloat(getRule.Rules.SubhealthThresholds,64)
-		var FaultThresholds,_ = strconv.ParseFloat(getRule.Rules.FaultThresholds,64)
-		req := &updateRequest{
-			&rules.Rule{
-				ID: getRule.ID,
-				Name: getRule.Rules.Name,
-				CreateTime: getRule.Rules.CreateTime,
-				UpdateTime: getRule.Rules.UpdateTime,
-				Duration: getRule.Rules.Duration,
-				Expression: getRule.Rules.Expression,
-				SubhealthConditionType: getRule.Rules.SubhealthConditionType,
-				SubhealthThresholds: SubhealthThresholds,
-				FaultConditionType: getRule.Rules.FaultConditionType,
-				FaultThresholds: FaultThresholds,
-				Severity: getRule.Rules.Severity,
-			},
-		}
-
-		if err := validateRule(req.Rule); err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, err))
+		if getRule.Rules == nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, errors.New("invalid params")))
 			return
 		}
+		req := &updateRequest{newRuleFromRequest(getRule.Rules)}
 
-		if err := h.operator.UpdateRule(req.Rule); err != nil {
-			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, err))
+		issues := h.operator.LintRule(ctx.Request.Context(), req.Rule)
+		if err := issues.Err(); err != nil {
+			response.HandleErrorWithData(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, err), &lintResponse{Issues: issues})
 			return
 		}
 
-		if err := h.operator.SendRuleUpdatedRequset(); err != nil {
-			response.HandleError(
-				ctx,
-				http.StatusInternalServerError,
-				cpdserr.NewError(cpdserr.DETECTOR_ERROR, fmt.Errorf("update rule success but unable to start analysis: %s", err)),
-			)
+		if err := h.operator.UpdateRule(req.Rule); err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_UPDATE_ERROR, err))
 			return
 		}
 
-		response.HandleOK(ctx, nil)
+		response.HandleOK(ctx, &lintResponse{Issues: issues})
 	}
 }
 
@@ -190,19 +179,363 @@ func (h *handler) Delete() gin.HandlerFunc {
 			return
 		}
 
-		if err := h.operator.SendRuleUpdatedRequset(); err != nil {
-			response.HandleError(
-				ctx,
-				http.StatusInternalServerError,
-				cpdserr.NewError(cpdserr.DETECTOR_ERROR, fmt.Errorf("delete rule success but unable to stop analysis: %s", err)),
-			)
+		response.HandleOK(ctx, nil)
+	}
+}
+
+func (h *handler) Backtest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req backtestRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.Rules == nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_BACKTEST_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		rule := newRuleFromRequest(req.Rules)
+		if issues := rule.Lint(); issues.HasErrors() {
+			response.HandleErrorWithData(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_BACKTEST_ERROR, issues), &lintResponse{Issues: issues})
 			return
 		}
 
-		response.HandleOK(ctx, nil)
+		if err := normalizeBacktestWindow(&req); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_BACKTEST_ERROR, err))
+			return
+		}
+
+		clusters, err := h.clusters.Select(req.Cluster)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_BACKTEST_ERROR, err))
+			return
+		}
+
+		result, err := h.operator.Backtest(ctx.Request.Context(), clusters, rule, req.StartTime, req.EndTime, req.Step)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.RULES_BACKTEST_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, result)
+	}
+}
+
+func (h *handler) GetHistory() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseRuleID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_GET_HISTORY_ERROR, err))
+			return
+		}
+
+		revisions, err := h.operator.GetRuleHistory(id)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_GET_HISTORY_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &getHistoryResponse{Records: revisions})
+	}
+}
+
+func (h *handler) Diff() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseRuleID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_DIFF_ERROR, err))
+			return
+		}
+
+		from, err := strconv.ParseUint(ctx.Query("from"), 10, 32)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_DIFF_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		to, err := strconv.ParseUint(ctx.Query("to"), 10, 32)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_DIFF_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		changes, err := h.operator.DiffRuleRevisions(id, uint(from), uint(to))
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_DIFF_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &diffResponse{
+			From:    uint(from),
+			To:      uint(to),
+			Changes: changes,
+		})
+	}
+}
+
+func (h *handler) Rollback() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, err := parseRuleID(ctx)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_ROLLBACK_ERROR, err))
+			return
+		}
+
+		var req rollbackRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_ROLLBACK_ERROR, err))
+			return
+		}
+
+		rule, err := h.operator.RollbackRule(id, req.Revision)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_ROLLBACK_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, rule)
+	}
+}
+
+func (h *handler) Export() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		format := ctx.DefaultQuery("format", rules.FileFormatYAML)
+
+		var data []byte
+		switch format {
+		case rules.FileFormatYAML:
+			records, err := h.operator.ExportRules()
+			if err != nil {
+				response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, err))
+				return
+			}
+			data, err = rules.MarshalRules(records)
+			if err != nil {
+				response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, err))
+				return
+			}
+		case rules.FileFormatPrometheus:
+			// prometheus rule files have no templating, rules are exported expanded
+			clusters, err := h.clusters.Select(ctx.Query("cluster"))
+			if err != nil {
+				response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, err))
+				return
+			}
+			records, _, err := h.operator.ExpandRules(ctx.Request.Context(), clusters)
+			if err != nil {
+				response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, err))
+				return
+			}
+			data, err = rules.MarshalPrometheusRules(records)
+			if err != nil {
+				response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, err))
+				return
+			}
+		default:
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_EXPORT_ERROR, fmt.Errorf("unsupported format: %s", format)))
+			return
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=rules-%s.yaml", format))
+		ctx.Data(http.StatusOK, "application/x-yaml", data)
+	}
+}
+
+func (h *handler) Import() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		format := ctx.DefaultQuery("format", rules.FileFormatYAML)
+		policy := ctx.DefaultQuery("policy", rules.ImportPolicyFail)
+		if !stringutil.IsStringInArray(policy, []string{rules.ImportPolicySkip, rules.ImportPolicyOverwrite, rules.ImportPolicyFail}) {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_IMPORT_ERROR, errors.New("invalid policy")))
+			return
+		}
+
+		data, err := ctx.GetRawData()
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_IMPORT_ERROR, err))
+			return
+		}
+
+		records, err := rules.UnmarshalRules(data, format)
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_IMPORT_ERROR, err))
+			return
+		}
+
+		if err := validateImportedRules(records, h.clusters); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_IMPORT_ERROR, err))
+			return
+		}
+
+		result, err := h.operator.ImportRules(records, policy)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_IMPORT_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, result)
+	}
+}
+
+// GetExpanded returns the rule set of the cluster parameter, the rules sent
+// to the detector of the cluster, and the rules left out of it. The rules of
+// every cluster are returned when it is not given.
+func (h *handler) GetExpanded() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		clusters, err := h.clusters.Select(ctx.Query("cluster"))
+		if err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_EXPAND_ERROR, err))
+			return
+		}
+
+		records, skipped, err := h.operator.ExpandRules(ctx.Request.Context(), clusters)
+		if err != nil {
+			response.HandleError(ctx, detector.HTTPStatus(err, http.StatusInternalServerError), cpdserr.NewError(cpdserr.RULES_EXPAND_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &getExpandedResponse{Records: records, Skipped: skipped})
+	}
+}
+
+func (h *handler) Enable() gin.HandlerFunc {
+	return h.setEnabled(true, cpdserr.RULES_ENABLE_ERROR)
+}
+
+func (h *handler) Disable() gin.HandlerFunc {
+	return h.setEnabled(false, cpdserr.RULES_DISABLE_ERROR)
+}
+
+func (h *handler) setEnabled(enabled bool, code uint16) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req toggleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, err))
+			return
+		}
+
+		selector := &rules.RuleSelector{IDs: req.IDs, Labels: req.Labels}
+		if req.ID != 0 {
+			selector.IDs = append(selector.IDs, req.ID)
+		}
+		if len(selector.IDs) == 0 && len(selector.Labels) == 0 {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, errors.New("id, ids or labels is required")))
+			return
+		}
+		if err := rules.ValidateLabels(selector.Labels); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(code, err))
+			return
+		}
+
+		changed, err := h.operator.SetRulesEnabled(selector, enabled)
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(code, err))
+			return
+		}
+
+		response.HandleOK(ctx, &toggleResponse{Rules: changed})
 	}
 }
 
+func (h *handler) Lint() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req ruleRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.Rules == nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.RULES_LINT_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		response.HandleOK(ctx, &lintResponse{Issues: h.operator.LintRule(ctx.Request.Context(), newRuleFromRequest(req.Rules))})
+	}
+}
+
+func (h *handler) GetSyncStatus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		status, err := h.operator.GetSyncStatus()
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.RULES_GET_SYNC_STATUS_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, status)
+	}
+}
+
+// newRuleFromRequest converts the request rule. A threshold that cannot be
+// parsed becomes NaN so that linting reports it, an empty one is only allowed
+// when its condition is unset.
+func newRuleFromRequest(r *rules.Rules) *rules.Rule {
+	var SubhealthThresholds = parseThreshold(r.SubhealthConditionType, r.SubhealthThresholds)
+	var FaultThresholds = parseThreshold(r.FaultConditionType, r.FaultThresholds)
+	return &rules.Rule{
+		ID:                     r.ID,
+		Name:                   r.Name,
+		CreateTime:             r.CreateTime,
+		UpdateTime:             r.UpdateTime,
+		Duration:               r.Duration,
+		Description:            r.Description,
+		RunbookURL:             r.RunbookURL,
+		OwnerTeam:              r.OwnerTeam,
+		Remediation:            r.Remediation,
+		Expression:             r.Expression,
+		Parameters:             r.Parameters,
+		Labels:                 r.Labels,
+		Inhibits:               r.Inhibits,
+		Clusters:               r.Clusters,
+		Enabled:                r.Enabled,
+		SubhealthConditionType: r.SubhealthConditionType,
+		SubhealthThresholds:    SubhealthThresholds,
+		FaultConditionType:     r.FaultConditionType,
+		FaultThresholds:        FaultThresholds,
+		Severity:               r.Severity,
+		SeverityID:             r.SeverityID,
+	}
+}
+
+func parseThreshold(conditionType, threshold string) float64 {
+	if threshold == "" && conditionType == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+// normalizeBacktestWindow fills in the default window (the last 24 hours at a
+// 15 second step) and widens the step so that the range query stays below the
+// 11000 points per series accepted by prometheus.
+func normalizeBacktestWindow(req *backtestRequest) error {
+	if req.EndTime == 0 {
+		req.EndTime = time.Now().Unix()
+	}
+	if req.StartTime == 0 {
+		req.StartTime = req.EndTime - int64((24 * time.Hour).Seconds())
+	}
+	if req.Step == 0 {
+		req.Step = 15
+	}
+
+	if !timeutil.IsTimestamp(req.StartTime) || !timeutil.IsTimestamp(req.EndTime) || req.StartTime >= req.EndTime {
+		return errors.New("invalid time window")
+	}
+	if req.Step < 0 {
+		return errors.New("invalid step")
+	}
+
+	if points := (req.EndTime - req.StartTime) / req.Step; points > maxBacktestPoints {
+		req.Step = int64(math.Ceil(float64(req.EndTime-req.StartTime) / maxBacktestPoints))
+	}
+
+	return nil
+}
+
+func parseRuleID(ctx *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		return 0, errors.New("invalid rule id")
+	}
+	return uint(id), nil
+}
+
 func parseGetParams(p *gin.Context) (*getOptions, error) {
 	pageNo, err := strconv.Atoi(p.DefaultQuery("page_no", "1"))
 	if err != nil {
@@ -214,8 +547,20 @@ func parseGetParams(p *gin.Context) (*getOptions, error) {
 		return nil, fmt.Errorf("invalid params")
 	}
 
+	filter := &rules.RuleFilter{Name: p.Query("filter"), Cluster: p.Query("cluster")}
+	if enabled := p.Query("enabled"); enabled != "" {
+		v, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return nil, fmt.Errorf("invalid params")
+		}
+		filter.Enabled = &v
+	}
+	if filter.Labels, err = rules.ParseLabelSelector(p.Query("labels")); err != nil {
+		return nil, err
+	}
+
 	return &getOptions{
-		filter:    p.Query("filter"),
+		filter:    filter,
 		sortField: p.DefaultQuery("sort_field", "name"),
 		sortOrder: p.DefaultQuery("sort_order", "asc"),
 		pageNo:    pageNo,
@@ -223,32 +568,24 @@ func parseGetParams(p *gin.Context) (*getOptions, error) {
 	}, nil
 }
 
-func validateRule(rule *rules.Rule) error {
-	// check name
-	re := regexp.MustCompile("^[A-Za-z0-9_]{1,64}$")
-	if !re.MatchString(rule.Name) {
-		return errors.New("invalid rule name")
-	}
-
-	// check expression
-	if !prometheusutil.IsExprValid(rule.Expression) {
-		return errors.New("invalid expression")
+func validateImportedRules(records []rules.Rule, clusters cluster.Clusters) error {
+	if len(records) == 0 {
+		return errors.New("no rules found")
 	}
 
-	//check rule
-	if (rule.SubhealthConditionType != "" && math.IsNaN(rule.SubhealthThresholds)) ||
-		(rule.FaultConditionType != "" && math.IsNaN(rule.FaultThresholds)) {
-		return errors.New("invalid rule")
-	}
-
-	// check severity
-	if !stringutil.IsStringInArray(rule.Severity, []string{"warning", "error", "critical"}) {
-		return errors.New("invalid severity")
-	}
+	names := make(map[string]bool)
+	for i := range records {
+		if names[records[i].Name] {
+			return fmt.Errorf("duplicate rule %s", records[i].Name)
+		}
+		names[records[i].Name] = true
 
-	// check duration
-	if !timeutil.IsValidDuration(rule.Duration) {
-		return errors.New("invalid duration")
+		if err := records[i].Lint().Err(); err != nil {
+			return fmt.Errorf("rule %s: %s", records[i].Name, err)
+		}
+		if err := clusters.Check(records[i].Clusters); err != nil {
+			return fmt.Errorf("rule %s: %s", records[i].Name, err)
+		}
 	}
 
 	return nil
@@ -18,8 +18,10 @@ package rules
 
 import "cpds/cpds-analyzer/internal/models/rules"
 
+const maxBacktestPoints = 11000
+
 type getOptions struct {
-	filter    string
+	filter    *rules.RuleFilter
 	sortField string
 	sortOrder string
 	pageNo    int
@@ -28,9 +30,9 @@ type getOptions struct {
 
 type getResponse struct {
 	Records   []rules.Rules `json:"records"`
-	PageTotal int          `json:"page_total"`
-	PageNo    int          `json:"page_no"`
-	PageSize  int          `json:"page_size"`
+	PageTotal int           `json:"page_total"`
+	PageNo    int           `json:"page_no"`
+	PageSize  int           `json:"page_size"`
 }
 
 type createRequest struct {
@@ -48,3 +50,47 @@ type ruleRequest struct {
 type deleteRequest struct {
 	ID int `json:"id"`
 }
+
+// backtestRequest evaluates the rule on Cluster, every cluster it is
+// assigned to if empty.
+type backtestRequest struct {
+	*rules.Rules
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Step      int64  `json:"step"`
+	Cluster   string `json:"cluster"`
+}
+
+type getHistoryResponse struct {
+	Records []rules.RuleRevision `json:"records"`
+}
+
+type diffResponse struct {
+	From    uint                    `json:"from"`
+	To      uint                    `json:"to"`
+	Changes []rules.RuleFieldChange `json:"changes"`
+}
+
+type rollbackRequest struct {
+	Revision uint `json:"revision" binding:"required"`
+}
+
+type getExpandedResponse struct {
+	Records []rules.ExpandedRule `json:"records"`
+	Skipped rules.SkippedRules   `json:"skipped"`
+}
+
+// toggleRequest selects the rules to enable or disable by id, ids or labels.
+type toggleRequest struct {
+	ID     uint              `json:"id"`
+	IDs    []uint            `json:"ids"`
+	Labels map[string]string `json:"labels"`
+}
+
+type toggleResponse struct {
+	Rules []string `json:"rules"`
+}
+
+type lintResponse struct {
+	Issues rules.LintIssues `json:"issues"`
+}
@@ -0,0 +1,150 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package severity
+
+import (
+	"cpds/cpds-analyzer/internal/models/severity"
+	cpdserr "cpds/cpds-analyzer/internal/pkg/errors"
+	"cpds/cpds-analyzer/internal/pkg/response"
+	stringutil "cpds/cpds-analyzer/pkg/utils/string"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	severityNameRegexp  = regexp.MustCompile("^[A-Za-z0-9_-]{1,32}$")
+	severityColorRegexp = regexp.MustCompile("^#[0-9A-Fa-f]{6}$")
+)
+
+type Handler interface {
+	Get() gin.HandlerFunc
+
+	Create() gin.HandlerFunc
+
+	Update() gin.HandlerFunc
+
+	Delete() gin.HandlerFunc
+}
+
+type handler struct {
+	logger   *zap.Logger
+	operator severity.Operator
+}
+
+func New(logger *zap.Logger, db *gorm.DB) Handler {
+	return &handler{
+		logger:   logger,
+		operator: severity.NewOperator(db),
+	}
+}
+
+func (h *handler) Get() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		records, err := h.operator.GetSeverities()
+		if err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.SEVERITY_GET_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &getResponse{Records: records})
+	}
+}
+
+func (h *handler) Create() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req severityRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.SEVERITY_CREATE_ERROR, err))
+			return
+		}
+
+		if err := validateSeverity(&req.Severity); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.SEVERITY_CREATE_ERROR, err))
+			return
+		}
+
+		if err := h.operator.CreateSeverity(&req.Severity); err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.SEVERITY_CREATE_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &req.Severity)
+	}
+}
+
+func (h *handler) Update() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req severityRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.ID == 0 {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.SEVERITY_UPDATE_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		if err := validateSeverity(&req.Severity); err != nil {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.SEVERITY_UPDATE_ERROR, err))
+			return
+		}
+
+		if err := h.operator.UpdateSeverity(&req.Severity); err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.SEVERITY_UPDATE_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, &req.Severity)
+	}
+}
+
+func (h *handler) Delete() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var req deleteRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.ID == 0 {
+			response.HandleError(ctx, http.StatusBadRequest, cpdserr.NewError(cpdserr.SEVERITY_DELETE_ERROR, errors.New("invalid params")))
+			return
+		}
+
+		if err := h.operator.DeleteSeverityByID(req.ID); err != nil {
+			response.HandleError(ctx, http.StatusInternalServerError, cpdserr.NewError(cpdserr.SEVERITY_DELETE_ERROR, err))
+			return
+		}
+
+		response.HandleOK(ctx, nil)
+	}
+}
+
+func validateSeverity(s *severity.Severity) error {
+	if !severityNameRegexp.MatchString(s.Name) {
+		return errors.New("invalid severity name")
+	}
+
+	if !severityColorRegexp.MatchString(s.Color) {
+		return errors.New("invalid color, expected #rrggbb")
+	}
+
+	if s.NotificationPolicy == "" {
+		s.NotificationPolicy = severity.NotificationPolicyNone
+	}
+	if !stringutil.IsStringInArray(s.NotificationPolicy, severity.NotificationPolicies) {
+		return errors.New("invalid notification policy")
+	}
+
+	return nil
+}
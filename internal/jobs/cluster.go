@@ -0,0 +1,58 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// clusterInterval is how often results are assigned their cluster
+	clusterInterval = 10 * time.Second
+
+	// clusterBatchSize is the number of results assigned per query
+	clusterBatchSize = 1000
+)
+
+// startClusters assigns their cluster to the results written by the
+// detectors. Results whose cluster cannot be told are not looked at again
+// until the analyzer restarts.
+func startClusters(ctx context.Context, logger *zap.Logger, operator analysis.Operator) {
+	var lastID uint
+	go every(ctx, clusterInterval, func() {
+		total := 0
+		for {
+			next, assigned, err := operator.AssignClusters(ctx, lastID, clusterBatchSize)
+			total += assigned
+			if err != nil {
+				logger.Warn("Failed to assign analysis results to their cluster", zap.Error(err))
+				break
+			}
+			if next == lastID {
+				break
+			}
+			lastID = next
+		}
+		if total != 0 {
+			logger.Debug("Assigned analysis results to their cluster", zap.Int("results", total))
+		}
+	})
+}
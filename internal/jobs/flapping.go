@@ -0,0 +1,59 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/flapping"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+
+	"go.uber.org/zap"
+)
+
+// startFlapping detects flapping results every interval of the options.
+func startFlapping(ctx context.Context, options *flapping.Options, logger *zap.Logger, operator analysis.Operator) {
+	if options == nil || !options.Enabled {
+		return
+	}
+
+	interval, err := timeutil.ParseDuration(options.Interval)
+	if err != nil {
+		logger.Error("Invalid flapping interval, flapping detection is disabled", zap.Error(err))
+		return
+	}
+	window, err := timeutil.ParseDuration(options.Window)
+	if err != nil {
+		logger.Error("Invalid flapping window, flapping detection is disabled", zap.Error(err))
+		return
+	}
+
+	policy := &analysis.FlappingPolicy{
+		Window:      window,
+		Transitions: options.Transitions,
+	}
+	go every(ctx, interval, func() {
+		marked, err := operator.DetectFlapping(policy)
+		if err != nil {
+			logger.Warn("Failed to detect flapping analysis results", zap.Error(err))
+			return
+		}
+		if marked != 0 {
+			logger.Info("Marked flapping analysis results", zap.Int("results", marked))
+		}
+	})
+}
@@ -0,0 +1,59 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/incident"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+
+	"go.uber.org/zap"
+)
+
+// startIncidents groups results into incidents every interval of the options.
+func startIncidents(ctx context.Context, options *incident.Options, logger *zap.Logger, operator analysis.Operator) {
+	if options == nil || !options.Enabled {
+		return
+	}
+
+	interval, err := timeutil.ParseDuration(options.Interval)
+	if err != nil {
+		logger.Error("Invalid incident interval, incident grouping is disabled", zap.Error(err))
+		return
+	}
+	window, err := timeutil.ParseDuration(options.Window)
+	if err != nil {
+		logger.Error("Invalid incident window, incident grouping is disabled", zap.Error(err))
+		return
+	}
+
+	policy := &analysis.IncidentPolicy{
+		Window:    window,
+		BatchSize: options.BatchSize,
+	}
+	go every(ctx, interval, func() {
+		grouped, err := operator.GroupIncidents(policy)
+		if err != nil {
+			logger.Warn("Failed to group analysis results into incidents", zap.Error(err))
+			return
+		}
+		if grouped != 0 {
+			logger.Debug("Grouped analysis results into incidents", zap.Int("results", grouped))
+		}
+	})
+}
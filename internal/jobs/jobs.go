@@ -0,0 +1,78 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package jobs runs the background work of the analyzer.
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/internal/models/rules"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// notificationInterval is how often pending rule notifications are checked
+	notificationInterval = time.Second
+
+	// ruleSetInterval is how often the expanded rule sets are checked for
+	// changes of the monitor targets
+	ruleSetInterval = time.Minute
+)
+
+// Start starts the background jobs, they stop when ctx is done.
+func Start(ctx context.Context, config *config.Config, logger *zap.Logger, db *gorm.DB) {
+	clusters := cluster.FromConfig(config)
+	rulesOperator := rules.NewOperator(clusters, config.CacheOptions, db)
+
+	go every(ctx, notificationInterval, func() {
+		if err := rulesOperator.DeliverNotifications(ctx); err != nil {
+			logger.Warn("Failed to deliver rule notification", zap.Error(err))
+		}
+	})
+	go every(ctx, ruleSetInterval, func() {
+		if err := rulesOperator.RefreshRuleSets(ctx); err != nil {
+			logger.Warn("Failed to refresh the expanded rule sets", zap.Error(err))
+		}
+	})
+
+	analysisOperator := analysis.NewOperator(clusters, config.CacheOptions, db)
+	startLabels(ctx, logger, analysisOperator)
+	startClusters(ctx, logger, analysisOperator)
+	startRetention(ctx, config.RetentionOptions, logger, analysisOperator)
+	startFlapping(ctx, config.FlappingOptions, logger, analysisOperator)
+	startIncidents(ctx, config.IncidentOptions, logger, analysisOperator)
+}
+
+// every calls fn every interval until ctx is done.
+func every(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn()
+		}
+	}
+}
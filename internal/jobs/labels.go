@@ -0,0 +1,58 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// labelsInterval is how often results are assigned their series labels
+	labelsInterval = 10 * time.Second
+
+	// labelsBatchSize is the number of results labelled per query, each one
+	// evaluates its rule
+	labelsBatchSize = 100
+)
+
+// startLabels fills in the series labels of the results written by the
+// detectors. Every run goes through all the results without labels, so that
+// those whose rule could not be evaluated are retried.
+func startLabels(ctx context.Context, logger *zap.Logger, operator analysis.Operator) {
+	go every(ctx, labelsInterval, func() {
+		var lastID uint
+		total := 0
+		for {
+			next, labelled, err := operator.AssignLabels(ctx, lastID, labelsBatchSize)
+			total += labelled
+			if err != nil {
+				logger.Warn("Failed to assign analysis results their series labels", zap.Error(err))
+			}
+			if next == lastID {
+				break
+			}
+			lastID = next
+		}
+		if total != 0 {
+			logger.Debug("Assigned analysis results their series labels", zap.Int("results", total))
+		}
+	})
+}
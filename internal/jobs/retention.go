@@ -0,0 +1,126 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package jobs
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/analysis"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/retention"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+var (
+	retentionPruned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "retention",
+		Name:      "pruned_results_total",
+		Help:      "Analysis results pruned, by reason (max_age or max_rows).",
+	}, []string{"reason"})
+
+	retentionArchived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "retention",
+		Name:      "archived_results_total",
+		Help:      "Analysis results archived before being pruned, by archive (table or file).",
+	}, []string{"archive"})
+
+	retentionFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "retention",
+		Name:      "failures_total",
+		Help:      "Retention runs that failed.",
+	})
+
+	retentionDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "retention",
+		Name:      "duration_seconds",
+		Help:      "Duration of the retention runs.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+
+	retentionLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "retention",
+		Name:      "last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful retention run.",
+	})
+)
+
+// startRetention prunes the analysis results every interval of the policy.
+// Options are validated on startup, parse errors only disable the job.
+func startRetention(ctx context.Context, options *retention.Options, logger *zap.Logger, operator analysis.Operator) {
+	if options == nil || !options.Enabled {
+		return
+	}
+
+	interval, err := timeutil.ParseDuration(options.Interval)
+	if err != nil {
+		logger.Error("Invalid retention interval, retention is disabled", zap.Error(err))
+		return
+	}
+
+	policy := &analysis.RetentionPolicy{
+		MaxRows:   options.MaxRows,
+		KeepFault: options.KeepFault,
+		BatchSize: options.BatchSize,
+	}
+	if options.MaxAge != "" {
+		if policy.MaxAge, err = timeutil.ParseDuration(options.MaxAge); err != nil {
+			logger.Error("Invalid retention max age, retention is disabled", zap.Error(err))
+			return
+		}
+	}
+
+	var archiver analysis.Archiver
+	switch options.Archive {
+	case retention.ArchiveTable:
+		archiver = analysis.TableArchiver{}
+	case retention.ArchiveFile:
+		archiver = analysis.FileArchiver{Dir: options.ArchiveDir}
+	}
+
+	go every(ctx, interval, func() {
+		start := time.Now()
+		result, err := operator.PruneResults(policy, archiver)
+		retentionDuration.Observe(time.Since(start).Seconds())
+
+		// results pruned before a failure are counted as well
+		if result != nil {
+			retentionPruned.WithLabelValues("max_age").Add(float64(result.Expired))
+			retentionPruned.WithLabelValues("max_rows").Add(float64(result.Excess))
+			if archiver != nil {
+				retentionArchived.WithLabelValues(options.Archive).Add(float64(result.Expired + result.Excess))
+			}
+		}
+
+		if err != nil {
+			retentionFailures.Inc()
+			logger.Warn("Failed to prune analysis results", zap.Error(err))
+			return
+		}
+		retentionLastSuccess.SetToCurrentTime()
+		if result.Expired+result.Excess != 0 {
+			logger.Info("Pruned analysis results", zap.Int("expired", result.Expired), zap.Int("excess", result.Excess))
+		}
+	})
+}
@@ -17,53 +17,101 @@
 package analysis
 
 import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/monitor"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
 	"cpds/cpds-analyzer/internal/models/rules"
-	"cpds/cpds-analyzer/pkg/prometheus"
-	"errors"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
 	"fmt"
-	"net/http"
-	"net/url"
+	"math"
 
-	jsoniter "github.com/json-iterator/go"
 	"gorm.io/gorm"
 )
 
 type Operator interface {
-	GetAnalysisResult(filter, sortField, sortOrder string, pageNo, pageSize int) ([]Analysis, error)
+	GetAnalysisResult(filter *Filter, sortField, sortOrder string, pageNo, pageSize int) ([]Analysis, error)
 
-	DeleteAnalysisResultByID(ID uint) error
+	CountResults(selector *Selector) (int, error)
 
-	GetRawData(ID uint) (*prometheus.Metric, error)
+	DeleteResults(selector *Selector, dryRun bool) (int, error)
 
-	GetTotalPages(filter string) int
-}
+	AcknowledgeResults(selector *Selector, user string, dryRun bool) (int, error)
 
-type operator struct {
-	db             *gorm.DB
-	detectorConfig *detectorConf
+	ExportResults(selector *Selector, fn func(records []Analysis) error) error
+
+	AcknowledgeResult(id uint, user string) error
+
+	UnacknowledgeResult(id uint, user string) error
+
+	AssignResult(id uint, user, assignee string) error
+
+	ResolveResult(id uint, user, note string) error
+
+	CommentResult(id uint, user, comment string) error
+
+	GetResultEvents(id uint) ([]AnalysisEvent, error)
+
+	PruneResults(policy *RetentionPolicy, archiver Archiver) (*PruneResult, error)
+
+	GetRawData(ctx context.Context, ID uint, options *RawDataOptions) (*RawData, error)
+
+	GetTotalPages(filter *Filter) int
+
+	GetResultsAfter(id uint, limit int) ([]Analysis, error)
+
+	LastResultID() (uint, error)
+
+	GetSummary(filter *Filter) (*Summary, error)
+
+	GetStats(filter *Filter, options *StatsOptions) (*Stats, error)
+
+	DetectFlapping(policy *FlappingPolicy) (int, error)
+
+	GetTimeline(id uint) (*Timeline, error)
+
+	GetResultContext(ctx context.Context, id uint) (*ResultContext, error)
+
+	GroupIncidents(policy *IncidentPolicy) (int, error)
+
+	AssignLabels(ctx context.Context, afterID uint, limit int) (uint, int, error)
+
+	AssignClusters(ctx context.Context, afterID uint, limit int) (uint, int, error)
+
+	GetIncidents(filter *IncidentFilter, pageNo, pageSize int) ([]Incident, error)
+
+	CountIncidents(filter *IncidentFilter) (int, error)
 }
 
-type detectorConf struct {
-	host string
-	port int
+type operator struct {
+	db       *gorm.DB
+	clusters cluster.Clusters
+	rules    rules.Operator
+	monitor  *monitor.Federation
 }
 
-func NewOperator(detedetectorHost string, detectorPort int, db *gorm.DB) Operator {
+func NewOperator(clusters cluster.Clusters, cache *cache.Options, db *gorm.DB) Operator {
 	return &operator{
-		db: db.Session(&gorm.Session{}),
-		detectorConfig: &detectorConf{
-			host: detedetectorHost,
-			port: detectorPort,
-		},
+		db:       db.Session(&gorm.Session{}),
+		clusters: clusters,
+		rules:    rules.NewOperator(clusters, cache, db),
+		monitor:  monitor.NewFederation(clusters, cache),
 	}
 }
 
-func (o *operator) GetAnalysisResult(filter, sortField, sortOrder string, pageNo, pageSize int) ([]Analysis, error) {
-	var query = o.db.Model(&Analysis{})
-	if filter != "" {
-		query = query.Where("rule_name LIKE ?", "%"+filter+"%")
-	}
+// clustersOf returns the cluster of the result, every cluster while it is
+// not assigned.
+func (o *operator) clustersOf(a *Analysis) (cluster.Clusters, error) {
+	return o.clusters.Select(a.Cluster)
+}
 
+func (o *operator) GetAnalysisResult(filter *Filter, sortField, sortOrder string, pageNo, pageSize int) ([]Analysis, error) {
+	var query = filter.apply(o.withSeverity())
+
+	// result columns are qualified, they clash with the joined tables
+	if sortField != "severity_rank" {
+		sortField = "analysis." + sortField
+	}
 	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
 
 	offset := (pageNo - 1) * pageSize
@@ -74,67 +122,362 @@ func (o *operator) GetAnalysisResult(filter, sortField, sortOrder string, pageNo
 	if err != nil {
 		return nil, err
 	}
+
+	if err := o.resolveRuleRevisions(analysis); err != nil {
+		return nil, err
+	}
+
+	if filter == nil || !filter.ShowFlapping {
+		if err := o.countFlapResults(analysis); err != nil {
+			return nil, err
+		}
+	}
+
+	if filter != nil && filter.ShowInhibited {
+		err = o.markInhibited(analysis)
+	} else {
+		err = o.groupInhibited(analysis, make(map[uint]bool))
+	}
+	if err != nil {
+		return nil, err
+	}
 	return analysis, nil
 }
 
-func (o *operator) DeleteAnalysisResultByID(ID uint) error {
-	result := o.db.Delete(&Analysis{}, ID)
-	if result.Error != nil {
-		return result.Error
+// resolveRuleRevisions fills in the rule revision of results that were
+// recorded without one: the revision the rule had in the last rule set the
+// detector of the cluster of the result acknowledged before the result was
+// created. Results older than the rule sets kept, or of rules they do not
+// hold, fall back to the last revision created before the result. The rule
+// sets and revisions involved are read in one query each.
+func (o *operator) resolveRuleRevisions(records []Analysis) error {
+	var ruleIDs []uint
+	var latest int64
+	for _, record := range records {
+		if record.RuleRevision != 0 {
+			continue
+		}
+		ruleIDs = append(ruleIDs, record.RuleID)
+		if record.CreateTime > latest {
+			latest = record.CreateTime
+		}
+	}
+	if len(ruleIDs) == 0 {
+		return nil
 	}
 
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+	var notifications []rules.RuleNotification
+	if err := o.db.Select("cluster", "delivered_time", "revisions").
+		Where("delivered_time <> 0 AND delivered_time <= ?", latest).
+		Order("delivered_time, id").
+		Find(&notifications).Error; err != nil {
+		return err
+	}
+	acknowledged := make(map[string][]rules.RuleNotification)
+	for _, n := range notifications {
+		acknowledged[n.Cluster] = append(acknowledged[n.Cluster], n)
+	}
+
+	var revisions []rules.RuleRevision
+	if err := o.db.Select("rule_id", "revision", "create_time").
+		Where("rule_id IN ? AND create_time <= ?", ruleIDs, latest).
+		Order("rule_id, revision").
+		Find(&revisions).Error; err != nil {
+		return err
+	}
+	byRule := make(map[uint][]rules.RuleRevision)
+	for _, revision := range revisions {
+		byRule[revision.RuleID] = append(byRule[revision.RuleID], revision)
+	}
+
+	for i := range records {
+		if records[i].RuleRevision != 0 {
+			continue
+		}
+		clusters := []string{records[i].Cluster}
+		if records[i].Cluster == "" {
+			clusters = o.clusters.Names()
+		}
+		if revision, ok := acknowledgedRevision(acknowledged, clusters, &records[i]); ok {
+			records[i].RuleRevision = revision
+			continue
+		}
+		for _, revision := range byRule[records[i].RuleID] {
+			if revision.CreateTime > records[i].CreateTime {
+				break
+			}
+			records[i].RuleRevision = revision.Revision
+		}
 	}
 
 	return nil
 }
 
-func (o *operator) GetRawData(analysisID uint) (*prometheus.Metric, error) {
-	var analysis *Analysis
-	result := o.db.Model(&Analysis{}).Where("id = ?", analysisID).Find(&analysis)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return nil, result.Error
+// acknowledgedRevision returns the revision of the rule of a in the last rule
+// set acknowledged before a was created, by the first of clusters whose rule
+// set then held the rule. acknowledged holds the delivered notifications of
+// every cluster, oldest first.
+func acknowledgedRevision(acknowledged map[string][]rules.RuleNotification, clusters []string, a *Analysis) (uint, bool) {
+	for _, name := range clusters {
+		notifications := acknowledged[name]
+		for i := len(notifications) - 1; i >= 0; i-- {
+			if notifications[i].DeliveredTime > a.CreateTime {
+				continue
+			}
+			if revision, ok := notifications[i].Revisions[a.RuleID]; ok && revision != 0 {
+				return revision, true
+			}
+			break
+		}
+	}
+	return 0, false
+}
+
+// GetRawData evaluates the rule that produced the result, at the revision
+// that produced it and on the cluster of the result, over the time of the
+// result and the padding around it.
+func (o *operator) GetRawData(ctx context.Context, ID uint, options *RawDataOptions) (*RawData, error) {
+	var analysis Analysis
+	if err := o.db.First(&analysis, ID).Error; err != nil {
+		return nil, err
+	}
+
+	records := []Analysis{analysis}
+	if err := o.resolveRuleRevisions(records); err != nil {
+		return nil, err
 	}
+	analysis = records[0]
 
-	var rule *rules.Rule
-	result = o.db.Model(&rules.Rule{}).Where("id = ?", analysis.RuleID).Find(&rule)
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		return nil, result.Error
+	rule, err := o.ruleAtRevision(analysis.RuleID, analysis.RuleRevision)
+	if err != nil {
+		return nil, err
 	}
 
-	step := (analysis.UpdateTime - analysis.CreateTime) / 250 // format step
-	if step == 0 {
-		step = 1
+	startTime := analysis.CreateTime - options.PaddingBefore
+	endTime := analysis.UpdateTime + options.PaddingAfter
+	step := options.Step
+	if step <= 0 {
+		step = (endTime - startTime) / defaultRawDataPoints
+	}
+	if points := (endTime - startTime) / maxInt64(step, 1); points > maxRawDataPoints {
+		step = int64(math.Ceil(float64(endTime-startTime) / maxRawDataPoints))
 	}
+	step = maxInt64(step, 1)
 
-	urlStr := fmt.Sprintf(
-		"http://%s:%d/api/v1/prometheus/query_range?query=%s&start_time=%d&end_time=%d&step=%d",
-		o.detectorConfig.host,
-		o.detectorConfig.port,
-		url.QueryEscape(rule.Expression),
-		analysis.CreateTime,
-		analysis.UpdateTime,
-		step,
-	)
+	clusters, err := o.clustersOf(&analysis)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := http.Get(urlStr)
+	evaluated, err := o.rules.EvaluateRule(ctx, clusters, rule, startTime, endTime, step)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var data *detectorRawDataResponse
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&data); err != nil || data.Status != 200 {
-		return nil, errors.New("cannot get raw data from detector")
+	data := &RawData{
+		RuleID:            rule.ID,
+		RuleRevision:      analysis.RuleRevision,
+		Expression:        rule.Expression,
+		StartTime:         startTime,
+		EndTime:           endTime,
+		Step:              step,
+		IncidentStartTime: analysis.CreateTime,
+		IncidentEndTime:   analysis.UpdateTime,
+		Thresholds:        make([]Threshold, 0, 2),
+		Series:            make([]RawDataSeries, 0, len(evaluated)),
+	}
+	if rule.SubhealthConditionType != "" {
+		data.Thresholds = append(data.Thresholds, Threshold{Status: StatusSubhealth, ConditionType: rule.SubhealthConditionType, Value: rule.SubhealthThresholds})
+	}
+	if rule.FaultConditionType != "" {
+		data.Thresholds = append(data.Thresholds, Threshold{Status: StatusFault, ConditionType: rule.FaultConditionType, Value: rule.FaultThresholds})
+	}
+	for _, series := range evaluated {
+		data.Series = append(data.Series, RawDataSeries{
+			EvaluatedSeries: series,
+			Triggered:       analysis.triggeredBy(&series, step),
+		})
+	}
+
+	return data, nil
+}
+
+// ruleAtRevision returns the rule at revision, or as it is now for results
+// recorded before the rule was versioned.
+func (o *operator) ruleAtRevision(ruleID, revision uint) (*rules.Rule, error) {
+	if revision != 0 {
+		if rule, err := o.rules.GetRuleRevision(ruleID, revision); err == nil {
+			return rule, nil
+		}
 	}
 
-	return data.Data, err
+	var rule rules.Rule
+	if err := o.db.First(&rule, ruleID).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// triggeredBy reports whether series could have produced the result: a
+// condition of the same status held long enough while the result was
+// active, on the instance and the cluster of the result if it has them. Step
+// absorbs the difference between the detector evaluations and the queried
+// points.
+func (a *Analysis) triggeredBy(series *rules.EvaluatedSeries, step int64) bool {
+	if a.Instance != "" && series.Metric["instance"] != a.Instance {
+		return false
+	}
+	if a.Cluster != "" && series.Metric[prometheusmodel.ClusterLabel] != a.Cluster {
+		return false
+	}
+
+	for _, interval := range series.Intervals {
+		if a.Status != StatusRecovered && interval.Status != a.Status {
+			continue
+		}
+		if interval.FireTime <= a.UpdateTime+step && interval.EndTime >= a.CreateTime-step {
+			return true
+		}
+	}
+	return false
 }
 
-func (o *operator) GetTotalPages(filter string) int {
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// GetResultsAfter returns up to limit results stored after the result id,
+// oldest first.
+func (o *operator) GetResultsAfter(id uint, limit int) ([]Analysis, error) {
+	var records []Analysis
+	err := o.withSeverity().Where("analysis.id > ?", id).Order("analysis.id asc").Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := o.resolveRuleRevisions(records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// LastResultID returns the id of the last stored result, 0 if there is none.
+func (o *operator) LastResultID() (uint, error) {
+	var id uint
+	if err := o.db.Model(&Analysis{}).Select("COALESCE(MAX(id), 0)").Scan(&id).Error; err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+func (o *operator) GetTotalPages(filter *Filter) int {
 	var tableCount int64
-	var query = o.db
-	query = query.Model(&Analysis{}).Where("rule_name LIKE ?", "%"+filter+"%").Count(&tableCount)
+	var query = o.withSeverity()
+	query = filter.apply(query).Count(&tableCount)
 	return int(tableCount)
 }
+
+// withSeverity joins every result with the context and the severity of its rule.
+func (o *operator) withSeverity() *gorm.DB {
+	return joinRule(o.db.Model(&Analysis{})).
+		Select("analysis.*, " +
+			"COALESCE(rule.description, '') AS description, COALESCE(rule.runbook_url, '') AS runbook_url, " +
+			"COALESCE(rule.owner_team, '') AS owner_team, COALESCE(rule.remediation, '') AS remediation, " +
+			"COALESCE(severity.name, '') AS severity, COALESCE(severity.`rank`, 0) AS severity_rank")
+}
+
+// joinRule joins the rule and the severity the filters refer to.
+func joinRule(query *gorm.DB) *gorm.DB {
+	return query.
+		Joins("LEFT JOIN rule ON rule.id = analysis.rule_id").
+		Joins("LEFT JOIN severity ON severity.id = rule.severity_id")
+}
+
+// HasCriteria tells whether the filter narrows the results down, the way
+// flapping and inhibited results are listed aside.
+func (f *Filter) HasCriteria() bool {
+	return f.RuleName != "" || len(f.RuleIDs) != 0 || len(f.Statuses) != 0 ||
+		len(f.Instances) != 0 || len(f.Pods) != 0 || len(f.Containers) != 0 || len(f.Clusters) != 0 ||
+		len(f.Labels) != 0 || len(f.Severities) != 0 || f.MinSeverityRank != 0 ||
+		f.CreateTimeStart != 0 || f.CreateTimeEnd != 0 || f.UpdateTimeStart != 0 || f.UpdateTimeEnd != 0 ||
+		f.Acknowledged != nil || f.Resolved != nil || len(f.Assignees) != 0 || f.Flapping != nil
+}
+
+func (f *Filter) apply(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return notInhibited(query).Where("NOT (" + collapsedCondition + ")")
+	}
+
+	if f.RuleName != "" {
+		query = query.Where("analysis.rule_name LIKE ?", "%"+f.RuleName+"%")
+	}
+	if len(f.RuleIDs) != 0 {
+		query = query.Where("analysis.rule_id IN ?", f.RuleIDs)
+	}
+	if len(f.Statuses) != 0 {
+		query = query.Where("analysis.status IN ?", f.Statuses)
+	}
+	if len(f.Instances) != 0 {
+		query = query.Where("analysis.instance IN ?", f.Instances)
+	}
+	if len(f.Pods) != 0 {
+		query = query.Where("analysis.pod IN ?", f.Pods)
+	}
+	if len(f.Containers) != 0 {
+		query = query.Where("analysis.container IN ?", f.Containers)
+	}
+	if len(f.Clusters) != 0 {
+		query = query.Where("analysis.cluster IN ?", f.Clusters)
+	}
+	for name, value := range f.Labels {
+		// label names are validated, quoting them keeps the json path well formed
+		query = query.Where("JSON_UNQUOTE(JSON_EXTRACT(analysis.labels, ?)) = ?", fmt.Sprintf("$.%q", name), value)
+	}
+	if len(f.Severities) != 0 {
+		query = query.Where("severity.name IN ?", f.Severities)
+	}
+	if f.MinSeverityRank != 0 {
+		query = query.Where("severity.`rank` >= ?", f.MinSeverityRank)
+	}
+	if f.CreateTimeStart != 0 {
+		query = query.Where("analysis.create_time >= ?", f.CreateTimeStart)
+	}
+	if f.CreateTimeEnd != 0 {
+		query = query.Where("analysis.create_time <= ?", f.CreateTimeEnd)
+	}
+	if f.UpdateTimeStart != 0 {
+		query = query.Where("analysis.update_time >= ?", f.UpdateTimeStart)
+	}
+	if f.UpdateTimeEnd != 0 {
+		query = query.Where("analysis.update_time <= ?", f.UpdateTimeEnd)
+	}
+	if f.Acknowledged != nil {
+		if *f.Acknowledged {
+			query = query.Where("analysis.acknowledge_time <> 0")
+		} else {
+			query = query.Where("analysis.acknowledge_time = 0")
+		}
+	}
+	if f.Resolved != nil {
+		if *f.Resolved {
+			query = query.Where("analysis.resolve_time <> 0")
+		} else {
+			query = query.Where("analysis.resolve_time = 0")
+		}
+	}
+	if len(f.Assignees) != 0 {
+		query = query.Where("analysis.assignee IN ?", f.Assignees)
+	}
+	if f.Flapping != nil {
+		query = query.Where("analysis.flapping = ?", *f.Flapping)
+	}
+	if !f.ShowFlapping {
+		query = query.Where("NOT (" + collapsedCondition + ")")
+	}
+	if !f.ShowInhibited {
+		query = notInhibited(query)
+	}
+	return query
+}
@@ -0,0 +1,145 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"compress/gzip"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// archiveFileLayout names the archive files, one per batch named after the
+// day it was archived and its first result
+const archiveFileLayout = "analysis-20060102"
+
+// AnalysisEvents is the audit trail of an archived result.
+type AnalysisEvents []AnalysisEvent
+
+// AnalysisArchive is a pruned result along with its audit trail.
+type AnalysisArchive struct {
+	Analysis    `gorm:"embedded"`
+	Events      AnalysisEvents `json:"events" gorm:"type:longtext"`
+	ArchiveTime int64          `json:"archive_time" gorm:"not null;index"`
+}
+
+// Scan implements sql.Scanner, events are stored as json text.
+func (e *AnalysisEvents) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported events type %T", value)
+	}
+
+	if len(data) == 0 {
+		*e = nil
+		return nil
+	}
+	return json.Unmarshal(data, e)
+}
+
+// Value implements driver.Valuer.
+func (e AnalysisEvents) Value() (driver.Value, error) {
+	if len(e) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// TableArchiver archives results to the analysis_archive table.
+type TableArchiver struct{}
+
+func (TableArchiver) Archive(tx *gorm.DB, records []AnalysisArchive) (ArchiveCommit, error) {
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return func(bool) error { return nil }, nil
+}
+
+// FileArchiver archives results as json lines to a gzip file per batch in
+// Dir, analysis-YYYYMMDD-<first id>.jsonl.gz. A batch is written to a hidden
+// temporary file which is renamed once its results are deleted, and removed
+// if they are not. A temporary file left behind by a crash may hold results
+// that were deleted, it is kept for inspection.
+type FileArchiver struct {
+	Dir string
+}
+
+func (a FileArchiver) Archive(_ *gorm.DB, records []AnalysisArchive) (ArchiveCommit, error) {
+	if err := os.MkdirAll(a.Dir, 0750); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%d.jsonl.gz", time.Now().Format(archiveFileLayout), records[0].ID)
+	f, err := os.CreateTemp(a.Dir, "."+name+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeArchive(f, records); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return func(committed bool) error {
+		if !committed {
+			return os.Remove(f.Name())
+		}
+		return os.Rename(f.Name(), filepath.Join(a.Dir, name))
+	}, nil
+}
+
+// writeArchive writes records to f as gzip compressed json lines and syncs
+// it.
+func writeArchive(f *os.File, records []AnalysisArchive) error {
+	if err := f.Chmod(0640); err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(f)
+	encoder := json.NewEncoder(zw)
+	for i := range records {
+		if err := encoder.Encode(&records[i]); err != nil {
+			zw.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
@@ -0,0 +1,174 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (o *operator) CountResults(selector *Selector) (int, error) {
+	var count int64
+	if err := selector.apply(joinRule(o.db.Model(&Analysis{}))).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// DeleteResults deletes the selected results along with their audit trail,
+// or only counts them on a dry run.
+func (o *operator) DeleteResults(selector *Selector, dryRun bool) (int, error) {
+	if dryRun {
+		return o.CountResults(selector)
+	}
+
+	var deleted int
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		ids, err := selector.ids(tx)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		if err := tx.Where("analysis_id IN ?", ids).Delete(&AnalysisEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("analysis_id IN ?", ids).Delete(&AnalysisOccurrence{}).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&Analysis{}, ids)
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = int(result.RowsAffected)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// AcknowledgeResults acknowledges the selected results that are not already,
+// or only counts them on a dry run. Every acknowledged result gets an event.
+func (o *operator) AcknowledgeResults(selector *Selector, user string, dryRun bool) (int, error) {
+	if dryRun {
+		var count int64
+		query := selector.apply(joinRule(o.db.Model(&Analysis{}))).Where("analysis.acknowledge_time = 0")
+		if err := query.Count(&count).Error; err != nil {
+			return 0, err
+		}
+		return int(count), nil
+	}
+
+	var acknowledged int
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		ids, err := selector.ids(tx)
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		// lock the results so that each one is acknowledged and recorded once
+		var locked []uint
+		err = tx.Model(&Analysis{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ? AND acknowledge_time = 0", ids).
+			Pluck("id", &locked).Error
+		if err != nil || len(locked) == 0 {
+			return err
+		}
+
+		now := time.Now().Unix()
+		err = tx.Model(&Analysis{}).Where("id IN ?", locked).Updates(map[string]interface{}{
+			"acknowledged_by":  user,
+			"acknowledge_time": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		events := make([]AnalysisEvent, 0, len(locked))
+		for _, id := range locked {
+			events = append(events, AnalysisEvent{AnalysisID: id, Action: EventActionAcknowledge, User: user, CreateTime: now})
+		}
+		if err := tx.Create(&events).Error; err != nil {
+			return err
+		}
+		acknowledged = len(locked)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return acknowledged, nil
+}
+
+// exportBatchSize is the number of results an export reads at once
+const exportBatchSize = 500
+
+// ExportResults calls fn with the selected results and the context of their
+// rule, oldest first, exportBatchSize at a time so that the results are
+// never held at once. An error of fn stops the export.
+func (o *operator) ExportResults(selector *Selector, fn func(records []Analysis) error) error {
+	var lastID uint
+	for {
+		var records []Analysis
+		err := selector.apply(o.withSeverity()).
+			Where("analysis.id > ?", lastID).
+			Order("analysis.id asc").
+			Limit(exportBatchSize).
+			Find(&records).Error
+		if err != nil || len(records) == 0 {
+			return err
+		}
+
+		if err := o.resolveRuleRevisions(records); err != nil {
+			return err
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+		if len(records) < exportBatchSize {
+			return nil
+		}
+		lastID = records[len(records)-1].ID
+	}
+}
+
+// apply narrows query, which must be joined with the rule, to the selected
+// results.
+func (s *Selector) apply(query *gorm.DB) *gorm.DB {
+	if s.Filter != nil {
+		filter := *s.Filter
+		filter.ShowInhibited = true
+		filter.ShowFlapping = true
+		query = filter.apply(query)
+	}
+	if len(s.IDs) != 0 {
+		query = query.Where("analysis.id IN ?", s.IDs)
+	}
+	return query
+}
+
+func (s *Selector) ids(tx *gorm.DB) ([]uint, error) {
+	var ids []uint
+	if err := s.apply(joinRule(tx.Model(&Analysis{}))).Pluck("analysis.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
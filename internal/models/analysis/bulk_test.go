@@ -0,0 +1,104 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBulkDryRun(t *testing.T) {
+	// the selection holds results 1 and 2, result 2 is already acknowledged
+	handle := func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT count(*)") && strings.Contains(query, "acknowledge_time = 0"):
+			return fakeResult{columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(1)}}}
+		case strings.HasPrefix(query, "SELECT count(*)"):
+			return fakeResult{columns: []string{"count(*)"}, rows: [][]driver.Value{{int64(2)}}}
+		case strings.HasPrefix(query, "SELECT `analysis`.`id`"):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}}
+		case strings.HasPrefix(query, "SELECT `id`") && strings.Contains(query, "FOR UPDATE"):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}
+		case strings.HasPrefix(query, "DELETE FROM `analysis` "):
+			return fakeResult{affected: 2}
+		}
+		return fakeResult{affected: 1}
+	}
+
+	tests := []struct {
+		name       string
+		run        func(o *operator) (int, error)
+		want       int
+		wantWrites []string
+	}{
+		{
+			name: "delete dry run",
+			run:  func(o *operator) (int, error) { return o.DeleteResults(&Selector{IDs: []uint{1, 2}}, true) },
+			want: 2,
+		},
+		{
+			name: "delete",
+			run:  func(o *operator) (int, error) { return o.DeleteResults(&Selector{IDs: []uint{1, 2}}, false) },
+			want: 2,
+			wantWrites: []string{
+				"DELETE FROM `analysis_event`",
+				"DELETE FROM `analysis_occurrence`",
+				"DELETE FROM `analysis`",
+			},
+		},
+		{
+			name: "acknowledge dry run",
+			run: func(o *operator) (int, error) {
+				return o.AcknowledgeResults(&Selector{IDs: []uint{1, 2}}, "alice", true)
+			},
+			want: 1,
+		},
+		{
+			name: "acknowledge",
+			run: func(o *operator) (int, error) {
+				return o.AcknowledgeResults(&Selector{IDs: []uint{1, 2}}, "alice", false)
+			},
+			want: 1,
+			wantWrites: []string{
+				"UPDATE `analysis`",
+				"INSERT INTO `analysis_event`",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, db := newFakeOperator(t, handle)
+
+			got, err := tt.run(o)
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("count = %d, want %d", got, tt.want)
+			}
+
+			if writes := db.writes(); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %q, want %q", writes, tt.wantWrites)
+			}
+			if dryRun := tt.wantWrites == nil; dryRun == (db.commits != 0) {
+				t.Errorf("commits = %d", db.commits)
+			}
+		})
+	}
+}
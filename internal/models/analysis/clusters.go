@@ -0,0 +1,98 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"context"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+)
+
+// AssignClusters assigns their cluster to up to limit results stored after
+// the result afterID without one. The cluster of a result is the one named by
+// its cluster label, the only cluster monitoring its instance or the only
+// cluster of the analyzer. Results whose cluster cannot be told are left
+// alone, results whose labels are not known yet are waited for. It returns
+// the id of the last result looked at, to resume from, and the number of
+// results assigned.
+func (o *operator) AssignClusters(ctx context.Context, afterID uint, limit int) (uint, int, error) {
+	var pending []Analysis
+	err := o.db.Select("id, instance, labels").
+		Where("id > ? AND cluster = ''", afterID).
+		Order("id asc").
+		Limit(limit).
+		Find(&pending).Error
+	if err != nil {
+		return afterID, 0, err
+	}
+	for i := range pending {
+		if pending[i].Labels == nil {
+			pending = pending[:i]
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return afterID, 0, nil
+	}
+
+	var instances map[string][]string
+	if len(o.clusters) > 1 {
+		targets, err := o.monitor.GetMonitorTargets(ctx, o.clusters)
+		if err != nil {
+			return afterID, 0, err
+		}
+
+		instances = make(map[string][]string)
+		for _, target := range targets.Targets {
+			instances[target.Instance] = append(instances[target.Instance], target.Cluster)
+		}
+	}
+
+	assigned := make(map[string][]uint)
+	for i := range pending {
+		if name := pending[i].resolveCluster(o.clusters, instances); name != "" {
+			assigned[name] = append(assigned[name], pending[i].ID)
+		}
+	}
+
+	count := 0
+	for name, ids := range assigned {
+		result := o.db.Model(&Analysis{}).Where("id IN ? AND cluster = ''", ids).Update("cluster", name)
+		if result.Error != nil {
+			return afterID, count, result.Error
+		}
+		count += int(result.RowsAffected)
+	}
+	return pending[len(pending)-1].ID, count, nil
+}
+
+// resolveCluster returns the cluster of the result, empty if it cannot be
+// told. instances lists the clusters monitoring every instance.
+func (a *Analysis) resolveCluster(clusters cluster.Clusters, instances map[string][]string) string {
+	if name := a.Labels[prometheusmodel.ClusterLabel]; name != "" {
+		if _, err := clusters.Get(name); err == nil {
+			return name
+		}
+	}
+	if len(clusters) == 1 {
+		return clusters[0].Name
+	}
+	if names := instances[a.Instance]; a.Instance != "" && len(names) == 1 {
+		return names[0]
+	}
+	return ""
+}
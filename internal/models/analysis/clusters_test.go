@@ -0,0 +1,82 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"testing"
+)
+
+func TestResolveCluster(t *testing.T) {
+	clusters := cluster.Clusters{{Name: "east"}, {Name: "west"}}
+	instances := map[string][]string{
+		"node1": {"east"},
+		"node2": {"east", "west"},
+	}
+
+	tests := []struct {
+		name     string
+		result   Analysis
+		clusters cluster.Clusters
+		want     string
+	}{
+		{
+			name:     "cluster label",
+			result:   Analysis{Instance: "node1", Labels: SeriesLabels{"cluster": "west"}},
+			clusters: clusters,
+			want:     "west",
+		},
+		{
+			name:     "unknown cluster label",
+			result:   Analysis{Instance: "node1", Labels: SeriesLabels{"cluster": "north"}},
+			clusters: clusters,
+			want:     "east",
+		},
+		{
+			name:     "instance of a single cluster",
+			result:   Analysis{Instance: "node1"},
+			clusters: clusters,
+			want:     "east",
+		},
+		{
+			name:     "instance of several clusters",
+			result:   Analysis{Instance: "node2"},
+			clusters: clusters,
+			want:     "",
+		},
+		{
+			name:     "not tied to an instance",
+			result:   Analysis{Pod: "web-1"},
+			clusters: clusters,
+			want:     "",
+		},
+		{
+			name:     "only cluster",
+			result:   Analysis{Pod: "web-1"},
+			clusters: cluster.Clusters{{Name: cluster.DefaultName}},
+			want:     cluster.DefaultName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.resolveCluster(tt.clusters, instances); got != tt.want {
+				t.Errorf("resolveCluster() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
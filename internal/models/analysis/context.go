@@ -0,0 +1,252 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/monitor"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// GetResultContext places a result in the topology of its node at the time
+// of its last update, marking the entities with other results active along
+// with it.
+func (o *operator) GetResultContext(ctx context.Context, id uint) (*ResultContext, error) {
+	var records []Analysis
+	if err := o.withSeverity().Where("analysis.id = ?", id).Limit(1).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := o.resolveRuleRevisions(records); err != nil {
+		return nil, err
+	}
+
+	result := records[0]
+	if result.Instance == "" && result.Pod == "" {
+		return buildContext(result, "", nil, nil), nil
+	}
+
+	clusters, err := o.clustersOf(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	// the node of a result tied to a pod alone is the one running the pod
+	instance := result.Instance
+	if instance == "" {
+		nodes, err := o.monitor.GetTopology(ctx, clusters, "", result.Pod, result.UpdateTime)
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) != 0 {
+			instance = nodes[0].Name
+		}
+	}
+
+	var nodes []monitor.Entity
+	if instance != "" {
+		if nodes, err = o.monitor.GetTopology(ctx, clusters, instance, "", result.UpdateTime); err != nil {
+			return nil, err
+		}
+	}
+
+	var related []Analysis
+	err = o.db.Select("id, instance, pod, container").
+		Where("id <> ? AND cluster = ? AND create_time <= ? AND update_time >= ?", result.ID, result.Cluster, result.UpdateTime, result.CreateTime).
+		Where("(instance <> '' AND instance = ?) OR (pod <> '' AND pod = ?)", instance, result.Pod).
+		Order("id asc").
+		Find(&related).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return buildContext(result, instance, nodes, related), nil
+}
+
+// buildContext builds the context of result from the topology of the nodes
+// and the related results. Entities of results missing from the topology,
+// gone since or never exported, are added to it.
+func buildContext(result Analysis, instance string, nodes []monitor.Entity, related []Analysis) *ResultContext {
+	ctx := &ResultContext{Result: result, Kind: entityKind(&result), Parents: []ContextEntity{}}
+	if ctx.Kind == "" {
+		return ctx
+	}
+
+	t := &topologyTree{
+		root:       &ContextEntity{Kind: monitor.EntityNode, Name: instance},
+		pods:       make(map[string]*ContextEntity),
+		containers: make(map[containerKey]*ContextEntity),
+	}
+	for _, node := range nodes {
+		if node.Name == instance {
+			t.add(node.Children)
+		}
+	}
+
+	for i := range related {
+		r := &related[i]
+		if r.Instance != "" && r.Instance != instance {
+			continue
+		}
+		if entity := t.entity(r); entity != nil {
+			entity.Faulty = true
+			entity.Results = append(entity.Results, r.ID)
+		}
+	}
+	t.entity(&result)
+
+	var parents []*ContextEntity
+	switch ctx.Kind {
+	case monitor.EntityPod:
+		parents = []*ContextEntity{t.root}
+	case monitor.EntityContainer:
+		parents = []*ContextEntity{t.root}
+		if pod := t.podOf(&result); pod != "" {
+			parents = append(parents, t.pod(pod))
+		}
+	}
+	for _, p := range parents {
+		ctx.Parents = append(ctx.Parents, ContextEntity{Kind: p.Kind, Name: p.Name, Faulty: p.Faulty, Results: p.Results})
+		if p.Faulty {
+			ctx.ParentFaulty = true
+		}
+	}
+
+	sortContextEntities(t.root.Children)
+	ctx.Topology = t.root
+	return ctx
+}
+
+// entityKind returns the kind of the most specific entity a result is tied
+// to, empty if none.
+func entityKind(r *Analysis) string {
+	switch {
+	case r.Container != "":
+		return monitor.EntityContainer
+	case r.Pod != "":
+		return monitor.EntityPod
+	case r.Instance != "":
+		return monitor.EntityNode
+	default:
+		return ""
+	}
+}
+
+type containerKey struct {
+	pod, container string
+}
+
+// topologyTree indexes the pods and the containers of a node, containers not
+// running in a pod have an empty pod.
+type topologyTree struct {
+	root       *ContextEntity
+	pods       map[string]*ContextEntity
+	containers map[containerKey]*ContextEntity
+}
+
+func (t *topologyTree) add(entities []monitor.Entity) {
+	for _, e := range entities {
+		switch e.Kind {
+		case monitor.EntityPod:
+			t.pod(e.Name)
+			for _, c := range e.Children {
+				t.container(e.Name, c.Name)
+			}
+		case monitor.EntityContainer:
+			t.container("", e.Name)
+		}
+	}
+}
+
+func (t *topologyTree) pod(name string) *ContextEntity {
+	if p, ok := t.pods[name]; ok {
+		return p
+	}
+	p := &ContextEntity{Kind: monitor.EntityPod, Name: name}
+	t.pods[name] = p
+	t.root.Children = append(t.root.Children, p)
+	return p
+}
+
+func (t *topologyTree) container(pod, name string) *ContextEntity {
+	key := containerKey{pod, name}
+	if c, ok := t.containers[key]; ok {
+		return c
+	}
+	c := &ContextEntity{Kind: monitor.EntityContainer, Name: name}
+	t.containers[key] = c
+	if pod != "" {
+		parent := t.pod(pod)
+		parent.Children = append(parent.Children, c)
+	} else {
+		t.root.Children = append(t.root.Children, c)
+	}
+	return c
+}
+
+// podOf returns the pod of a result. The pod of a container result without
+// one is looked up in the topology, as long as a single pod runs a container
+// of that name.
+func (t *topologyTree) podOf(r *Analysis) string {
+	if r.Pod != "" || r.Container == "" {
+		return r.Pod
+	}
+
+	pod, found := "", 0
+	for key := range t.containers {
+		if key.container == r.Container && key.pod != "" {
+			pod = key.pod
+			found++
+		}
+	}
+	if found != 1 {
+		return ""
+	}
+	return pod
+}
+
+// entity returns the entity of a result, added to the tree if missing.
+func (t *topologyTree) entity(r *Analysis) *ContextEntity {
+	switch entityKind(r) {
+	case monitor.EntityContainer:
+		return t.container(t.podOf(r), r.Container)
+	case monitor.EntityPod:
+		return t.pod(r.Pod)
+	case monitor.EntityNode:
+		return t.root
+	default:
+		return nil
+	}
+}
+
+// sortContextEntities sorts entities and their children, pods before
+// containers and by name.
+func sortContextEntities(entities []*ContextEntity) {
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].Kind != entities[j].Kind {
+			return entities[i].Kind == monitor.EntityPod
+		}
+		return entities[i].Name < entities[j].Name
+	})
+	for _, e := range entities {
+		sortContextEntities(e.Children)
+	}
+}
@@ -0,0 +1,113 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/models/monitor"
+	"reflect"
+	"testing"
+)
+
+func TestBuildContext(t *testing.T) {
+	nodes := []monitor.Entity{
+		{Kind: monitor.EntityNode, Name: "node1", Children: []monitor.Entity{
+			{Kind: monitor.EntityPod, Name: "web-1", Children: []monitor.Entity{
+				{Kind: monitor.EntityContainer, Name: "nginx"},
+			}},
+			{Kind: monitor.EntityPod, Name: "db-1", Children: []monitor.Entity{
+				{Kind: monitor.EntityContainer, Name: "mysql"},
+			}},
+			{Kind: monitor.EntityContainer, Name: "etcd"},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		result       Analysis
+		related      []Analysis
+		wantKind     string
+		wantParents  []ContextEntity
+		parentFaulty bool
+	}{
+		{
+			name:     "not tied to an entity",
+			result:   Analysis{ID: 1},
+			wantKind: "",
+		},
+		{
+			name:        "node",
+			result:      Analysis{ID: 1, Instance: "node1"},
+			wantKind:    monitor.EntityNode,
+			wantParents: []ContextEntity{},
+		},
+		{
+			name:     "container of a faulty node",
+			result:   Analysis{ID: 1, Instance: "node1", Pod: "web-1", Container: "nginx"},
+			related:  []Analysis{{ID: 2, Instance: "node1"}},
+			wantKind: monitor.EntityContainer,
+			wantParents: []ContextEntity{
+				{Kind: monitor.EntityNode, Name: "node1", Faulty: true, Results: []uint{2}},
+				{Kind: monitor.EntityPod, Name: "web-1"},
+			},
+			parentFaulty: true,
+		},
+		{
+			name:     "pod looked up in the topology",
+			result:   Analysis{ID: 1, Instance: "node1", Container: "mysql"},
+			related:  []Analysis{{ID: 3, Instance: "node1", Pod: "db-1"}, {ID: 4, Instance: "node2"}},
+			wantKind: monitor.EntityContainer,
+			wantParents: []ContextEntity{
+				{Kind: monitor.EntityNode, Name: "node1"},
+				{Kind: monitor.EntityPod, Name: "db-1", Faulty: true, Results: []uint{3}},
+			},
+			parentFaulty: true,
+		},
+		{
+			name:     "container outside of a pod",
+			result:   Analysis{ID: 1, Instance: "node1", Container: "etcd"},
+			related:  []Analysis{{ID: 5, Instance: "node1", Container: "nginx"}},
+			wantKind: monitor.EntityContainer,
+			wantParents: []ContextEntity{
+				{Kind: monitor.EntityNode, Name: "node1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := buildContext(tt.result, tt.result.Instance, nodes, tt.related)
+			if ctx.Kind != tt.wantKind {
+				t.Fatalf("Kind = %q, want %q", ctx.Kind, tt.wantKind)
+			}
+			if tt.wantKind == "" {
+				if ctx.Topology != nil {
+					t.Errorf("Topology = %v, want nil", ctx.Topology)
+				}
+				return
+			}
+			if !reflect.DeepEqual(ctx.Parents, tt.wantParents) {
+				t.Errorf("Parents = %+v, want %+v", ctx.Parents, tt.wantParents)
+			}
+			if ctx.ParentFaulty != tt.parentFaulty {
+				t.Errorf("ParentFaulty = %v, want %v", ctx.ParentFaulty, tt.parentFaulty)
+			}
+			if len(ctx.Topology.Children) != 3 || ctx.Topology.Children[0].Name != "db-1" || ctx.Topology.Children[2].Name != "etcd" {
+				t.Errorf("Topology children are not sorted: %+v", ctx.Topology.Children)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// fakeResult is the answer of the fake database to a statement: the rows of
+// a query or the rows affected by an exec.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// fakeDB answers every statement with handle, which is given the sql and
+// its arguments, and records the statements, commits and rollbacks.
+type fakeDB struct {
+	handle func(query string, args []driver.Value) fakeResult
+
+	mu         sync.Mutex
+	statements []string
+	commits    int
+	rollbacks  int
+}
+
+// writes returns the statements that are neither queries nor locks, up to
+// the table they write, such as "DELETE FROM `analysis`".
+func (db *fakeDB) writes() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var writes []string
+	for _, s := range db.statements {
+		if strings.HasPrefix(s, "SELECT") {
+			continue
+		}
+		if i := strings.Index(s, "` "); i >= 0 {
+			s = s[:i+1]
+		}
+		writes = append(writes, s)
+	}
+	return writes
+}
+
+func (db *fakeDB) record(query string) {
+	db.mu.Lock()
+	db.statements = append(db.statements, query)
+	db.mu.Unlock()
+}
+
+var (
+	fakeDriverOnce sync.Once
+	fakeDBs        sync.Map
+)
+
+type fakeDriver struct{}
+
+// newFakeOperator returns an operator on a fake database answering with
+// handle, an empty result if nil.
+func newFakeOperator(t *testing.T, handle func(query string, args []driver.Value) fakeResult) (*operator, *fakeDB) {
+	fakeDriverOnce.Do(func() { sql.Register("analysis-fake", fakeDriver{}) })
+
+	db := &fakeDB{handle: handle}
+	if db.handle == nil {
+		db.handle = func(string, []driver.Value) fakeResult { return fakeResult{} }
+	}
+	fakeDBs.Store(t.Name(), db)
+	t.Cleanup(func() { fakeDBs.Delete(t.Name()) })
+
+	conn, err := sql.Open("analysis-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	gormDB, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		NamingStrategy:       schema.NamingStrategy{SingularTable: true},
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOperator(nil, nil, gormDB).(*operator), db
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", name)
+	}
+	return &fakeConn{db: db.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	c.db.commits++
+	c.db.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.db.mu.Lock()
+	c.db.rollbacks++
+	c.db.mu.Unlock()
+	return nil
+}
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.record(s.query)
+	result := s.db.handle(s.query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return fakeExecResult(result.affected), nil
+}
+
+// fakeExecResult is the rows affected by an exec, the rows inserted are
+// given ids from 1.
+type fakeExecResult int64
+
+func (r fakeExecResult) LastInsertId() (int64, error) { return 1, nil }
+
+func (r fakeExecResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.record(s.query)
+	result := s.db.handle(s.query, args)
+	if result.err != nil {
+		return nil, result.err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
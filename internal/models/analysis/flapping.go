@@ -0,0 +1,266 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// collapsedCondition matches the results collapsed into the first result of
+// their flapping incident, as long as that one exists.
+const collapsedCondition = "analysis.flap_id <> 0 AND analysis.flap_id <> analysis.id AND " +
+	"EXISTS (SELECT 1 FROM analysis flap WHERE flap.id = analysis.flap_id)"
+
+// flappingLock is the lock of the database held while detecting flapping
+const flappingLock = "cpds_analysis_flapping"
+
+type flapKey struct {
+	RuleID   uint
+	Instance string
+}
+
+// DetectFlapping records the state transitions of the results active within
+// the window, then marks the results of every rule and instance making
+// enough transitions as flapping. Results not tied to an instance are left
+// out, the results of a rule on every node would add up as one. It returns
+// the number of results marked. Nothing is recorded while another replica
+// is detecting flapping, transitions would be recorded twice.
+func (o *operator) DetectFlapping(policy *FlappingPolicy) (int, error) {
+	var marked int
+	err := o.withLock(flappingLock, func() error {
+		var err error
+		marked, err = o.detectFlapping(policy)
+		return err
+	})
+	return marked, err
+}
+
+func (o *operator) detectFlapping(policy *FlappingPolicy) (int, error) {
+	since := time.Now().Add(-policy.Window).Unix()
+	if err := o.recordOccurrences(since); err != nil {
+		return 0, err
+	}
+
+	var keys []flapKey
+	err := o.db.Model(&AnalysisOccurrence{}).
+		Select("rule_id, instance").
+		Where("time >= ? AND instance <> ''", since).
+		Group("rule_id, instance").
+		Having("SUM(transitions) >= ?", policy.Transitions).
+		Scan(&keys).Error
+	if err != nil {
+		return 0, err
+	}
+
+	marked := 0
+	for _, key := range keys {
+		n, err := o.markFlapping(key, since)
+		if err != nil {
+			return marked, err
+		}
+		marked += n
+	}
+	return marked, nil
+}
+
+// recordOccurrences compares the results updated since with their last
+// recorded occurrence. A result is first seen once its instance is known.
+func (o *operator) recordOccurrences(since int64) error {
+	var records []Analysis
+	err := o.db.Select("id, rule_id, instance, status, count, create_time, update_time").
+		Where("update_time >= ? AND instance <> ''", since).
+		Find(&records).Error
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	ids := make([]uint, 0, len(records))
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+
+	var latest []AnalysisOccurrence
+	last := o.db.Model(&AnalysisOccurrence{}).Select("MAX(id)").Where("analysis_id IN ?", ids).Group("analysis_id")
+	if err := o.db.Where("id IN (?)", last).Find(&latest).Error; err != nil {
+		return err
+	}
+	previous := make(map[uint]AnalysisOccurrence, len(latest))
+	for _, occurrence := range latest {
+		previous[occurrence.AnalysisID] = occurrence
+	}
+
+	occurrences := make([]AnalysisOccurrence, 0)
+	for _, r := range records {
+		p, seen := previous[r.ID]
+		if occurrence, ok := nextOccurrence(&r, p, seen); ok {
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	if len(occurrences) == 0 {
+		return nil
+	}
+	return o.db.CreateInBatches(&occurrences, 500).Error
+}
+
+// nextOccurrence returns the occurrence of r following its last recorded
+// occurrence p, false if r made no transition since. seen tells whether r
+// has any recorded occurrence.
+func nextOccurrence(r *Analysis, p AnalysisOccurrence, seen bool) (AnalysisOccurrence, bool) {
+	occurrence := AnalysisOccurrence{
+		AnalysisID: r.ID,
+		RuleID:     r.RuleID,
+		Instance:   r.Instance,
+		Status:     r.Status,
+		Count:      r.Count,
+		Time:       r.UpdateTime,
+	}
+
+	switch {
+	case !seen:
+		// first seen, a result seen recovered already made two transitions
+		occurrence.Time = r.CreateTime
+		occurrence.Transitions = 1
+		if r.Status == StatusRecovered {
+			occurrence.Transitions = 2
+		}
+	case p.Status != r.Status:
+		occurrence.Transitions = 1
+	case r.Count > p.Count:
+		occurrence.Transitions = int(r.Count - p.Count)
+	default:
+		return occurrence, false
+	}
+	return occurrence, true
+}
+
+// markFlapping marks the results of key active since as flapping, joining
+// the incident of the earliest one already flapping if any. Incidents that
+// are joined together are merged.
+func (o *operator) markFlapping(key flapKey, since int64) (int, error) {
+	var marked int
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		var group []Analysis
+		err := tx.Select("id, flap_id").
+			Where("rule_id = ? AND instance = ? AND update_time >= ?", key.RuleID, key.Instance, since).
+			Order("id asc").
+			Find(&group).Error
+		if err != nil || len(group) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(group))
+		flapIDs := make([]uint, 0)
+		for _, r := range group {
+			ids = append(ids, r.ID)
+			if r.FlapID != 0 {
+				flapIDs = append(flapIDs, r.FlapID)
+			}
+		}
+
+		flapID := group[0].ID
+		for _, id := range flapIDs {
+			if id < flapID {
+				flapID = id
+			}
+		}
+
+		query := tx.Model(&Analysis{}).Where("id IN ?", ids)
+		if len(flapIDs) != 0 {
+			query = query.Or("flap_id IN ?", flapIDs)
+		}
+		result := tx.Model(&Analysis{}).
+			Where(query).
+			Where("flapping = ? OR flap_id <> ?", false, flapID).
+			Updates(map[string]interface{}{"flapping": true, "flap_id": flapID})
+		if result.Error != nil {
+			return result.Error
+		}
+		marked = int(result.RowsAffected)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return marked, nil
+}
+
+// countFlapResults fills in the number of results collapsed into each of the
+// records.
+func (o *operator) countFlapResults(records []Analysis) error {
+	ids := make([]uint, 0)
+	for _, r := range records {
+		if r.Flapping && r.FlapID == r.ID {
+			ids = append(ids, r.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var counts []struct {
+		FlapID uint
+		Count  int
+	}
+	err := o.db.Model(&Analysis{}).
+		Select("flap_id, COUNT(*) AS count").
+		Where("flap_id IN ? AND id <> flap_id", ids).
+		Group("flap_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint]int, len(counts))
+	for _, c := range counts {
+		byID[c.FlapID] = c.Count
+	}
+	for i := range records {
+		records[i].FlapResults = byID[records[i].ID]
+	}
+	return nil
+}
+
+func (o *operator) GetTimeline(id uint) (*Timeline, error) {
+	var result Analysis
+	if err := o.db.Select("id, flapping, flap_id").First(&result, id).Error; err != nil {
+		return nil, err
+	}
+
+	timeline := &Timeline{FlapID: result.FlapID, Flapping: result.Flapping}
+	query := o.withSeverity()
+	if result.FlapID != 0 {
+		query = query.Where("analysis.flap_id = ?", result.FlapID)
+	} else {
+		query = query.Where("analysis.id = ?", id)
+	}
+	if err := query.Order("analysis.create_time asc, analysis.id asc").Find(&timeline.Results).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(timeline.Results))
+	for _, r := range timeline.Results {
+		ids = append(ids, r.ID)
+	}
+	err := o.db.Where("analysis_id IN ?", ids).Order("time asc, id asc").Find(&timeline.Occurrences).Error
+	if err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
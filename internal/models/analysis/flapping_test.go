@@ -0,0 +1,149 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextOccurrence(t *testing.T) {
+	fault := AnalysisOccurrence{Status: StatusFault, Count: 3}
+
+	tests := []struct {
+		name            string
+		result          Analysis
+		previous        AnalysisOccurrence
+		seen            bool
+		wantOK          bool
+		wantTransitions int
+		wantTime        int64
+	}{
+		{
+			name:            "first seen",
+			result:          Analysis{Status: StatusFault, Count: 1, CreateTime: 100, UpdateTime: 200},
+			wantOK:          true,
+			wantTransitions: 1,
+			wantTime:        100,
+		},
+		{
+			name:            "first seen recovered",
+			result:          Analysis{Status: StatusRecovered, Count: 1, CreateTime: 100, UpdateTime: 200},
+			wantOK:          true,
+			wantTransitions: 2,
+			wantTime:        100,
+		},
+		{
+			name:            "status changed",
+			result:          Analysis{Status: StatusRecovered, Count: 3, CreateTime: 100, UpdateTime: 200},
+			previous:        fault,
+			seen:            true,
+			wantOK:          true,
+			wantTransitions: 1,
+			wantTime:        200,
+		},
+		{
+			name:            "count grew",
+			result:          Analysis{Status: StatusFault, Count: 6, CreateTime: 100, UpdateTime: 200},
+			previous:        fault,
+			seen:            true,
+			wantOK:          true,
+			wantTransitions: 3,
+			wantTime:        200,
+		},
+		{
+			name:     "unchanged",
+			result:   Analysis{Status: StatusFault, Count: 3, CreateTime: 100, UpdateTime: 200},
+			previous: fault,
+			seen:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := nextOccurrence(&tt.result, tt.previous, tt.seen)
+			if ok != tt.wantOK {
+				t.Fatalf("nextOccurrence() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (got.Transitions != tt.wantTransitions || got.Time != tt.wantTime) {
+				t.Errorf("nextOccurrence() = %d transitions at %d, want %d at %d", got.Transitions, got.Time, tt.wantTransitions, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestDetectFlappingThreshold(t *testing.T) {
+	tests := []struct {
+		name        string
+		transitions int
+		flapping    bool
+		wantMarked  int
+		wantWrites  []string
+	}{
+		{
+			name:        "below the threshold",
+			transitions: 6,
+		},
+		{
+			name:        "at the threshold",
+			transitions: 6,
+			flapping:    true,
+			wantMarked:  2,
+			wantWrites:  []string{"UPDATE `analysis`"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var threshold, since driver.Value
+			o, db := newFakeOperator(t, func(query string, args []driver.Value) fakeResult {
+				switch {
+				case strings.HasPrefix(query, "SELECT GET_LOCK"):
+					return fakeResult{columns: []string{"GET_LOCK"}, rows: [][]driver.Value{{int64(1)}}}
+				case strings.Contains(query, "HAVING"):
+					since, threshold = args[0], args[len(args)-1]
+					if !tt.flapping {
+						return fakeResult{}
+					}
+					return fakeResult{columns: []string{"rule_id", "instance"}, rows: [][]driver.Value{{int64(1), "node1"}}}
+				case strings.HasPrefix(query, "SELECT id, flap_id"):
+					return fakeResult{columns: []string{"id", "flap_id"}, rows: [][]driver.Value{{int64(3), int64(0)}, {int64(4), int64(0)}}}
+				}
+				return fakeResult{affected: 2}
+			})
+
+			start := time.Now()
+			marked, err := o.DetectFlapping(&FlappingPolicy{Window: time.Hour, Transitions: tt.transitions})
+			if err != nil {
+				t.Fatalf("DetectFlapping() error = %v", err)
+			}
+			if marked != tt.wantMarked {
+				t.Errorf("marked = %d, want %d", marked, tt.wantMarked)
+			}
+			if threshold != int64(tt.transitions) {
+				t.Errorf("threshold = %v, want %d", threshold, tt.transitions)
+			}
+			if s, ok := since.(int64); !ok || s < start.Add(-time.Hour).Unix() || s > time.Now().Add(-time.Hour).Unix() {
+				t.Errorf("window start = %v, want an hour ago", since)
+			}
+			if writes := db.writes(); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %q, want %q", writes, tt.wantWrites)
+			}
+		})
+	}
+}
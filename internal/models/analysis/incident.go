@@ -0,0 +1,312 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/models/rules"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// incidentLock is the lock of the database held while grouping incidents
+const incidentLock = "cpds_analysis_incidents"
+
+// GroupIncidents groups the results not grouped yet into incidents, then
+// refreshes the incidents whose results changed. A result joins the incident
+// of a result of its cluster sharing its instance or pod and active within
+// the window of it, or starts a new incident. Results are grouped once their
+// cluster is assigned. It returns the number of results grouped. Nothing is
+// grouped while another replica is grouping.
+func (o *operator) GroupIncidents(policy *IncidentPolicy) (int, error) {
+	var grouped int
+	err := o.withLock(incidentLock, func() error {
+		var err error
+		grouped, err = o.groupIncidents(policy)
+		return err
+	})
+	return grouped, err
+}
+
+func (o *operator) groupIncidents(policy *IncidentPolicy) (int, error) {
+	var pending []Analysis
+	err := o.db.Select("id, rule_name, instance, pod, cluster, create_time, update_time").
+		Where("incident_id = 0 AND cluster <> '' AND (instance <> '' OR pod <> '')").
+		Order("create_time asc, id asc").
+		Limit(policy.BatchSize).
+		Find(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+
+	window := int64(policy.Window / time.Second)
+	for _, r := range pending {
+		if err := o.joinIncident(r, window); err != nil {
+			return 0, err
+		}
+	}
+
+	// open incidents may close, closed ones reopen when a result is updated
+	var ids []uint
+	err = o.db.Model(&Analysis{}).
+		Joins("JOIN incident ON incident.id = analysis.incident_id").
+		Where("incident.status = ? OR analysis.update_time > incident.end_time", IncidentStatusOpen).
+		Distinct().
+		Pluck("analysis.incident_id", &ids).Error
+	if err != nil {
+		return len(pending), err
+	}
+
+	inhibits, err := o.ruleInhibits()
+	if err != nil {
+		return len(pending), err
+	}
+	for _, id := range ids {
+		if err := o.refreshIncident(id, inhibits); err != nil {
+			return len(pending), err
+		}
+	}
+
+	// the results of an incident may have been deleted since
+	err = o.db.Where("NOT EXISTS (SELECT 1 FROM analysis WHERE analysis.incident_id = incident.id)").
+		Delete(&Incident{}).Error
+	return len(pending), err
+}
+
+// joinIncident adds r to the incident of the latest result of its cluster
+// sharing its instance or pod and active within window of it, a new incident
+// is started if there is none.
+func (o *operator) joinIncident(r Analysis, window int64) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint
+		err := tx.Model(&Analysis{}).
+			Where("incident_id <> 0 AND cluster = ?", r.Cluster).
+			Where("(instance <> '' AND instance = ?) OR (pod <> '' AND pod = ?)", r.Instance, r.Pod).
+			Where("create_time <= ? AND update_time >= ?", r.UpdateTime+window, r.CreateTime-window).
+			Order("create_time desc, id desc").
+			Limit(1).
+			Pluck("incident_id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		var incidentID uint
+		if len(ids) != 0 {
+			incidentID = ids[0]
+		} else {
+			now := time.Now().Unix()
+			incident := &Incident{
+				Status:          IncidentStatusOpen,
+				StartTime:       r.CreateTime,
+				EndTime:         r.UpdateTime,
+				RootCauseID:     r.ID,
+				RootCauseRule:   r.RuleName,
+				RootCauseReason: rootCauseEarliest,
+				CreateTime:      now,
+				UpdateTime:      now,
+			}
+			if err := tx.Create(incident).Error; err != nil {
+				return err
+			}
+			incidentID = incident.ID
+		}
+
+		return tx.Model(&Analysis{}).
+			Where("id = ? AND incident_id = 0", r.ID).
+			Update("incident_id", incidentID).Error
+	})
+}
+
+// refreshIncident recomputes the time span, the status and the suggested
+// root cause of an incident from its results.
+func (o *operator) refreshIncident(id uint, inhibits map[string]rules.RuleNames) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var incident Incident
+		if err := tx.First(&incident, id).Error; err != nil {
+			return err
+		}
+
+		var members []Analysis
+		err := tx.Select("id, rule_name, status, create_time, update_time, resolve_time").
+			Where("incident_id = ?", id).
+			Order("create_time asc, id asc").
+			Find(&members).Error
+		if err != nil || len(members) == 0 {
+			return err
+		}
+
+		status := IncidentStatusClosed
+		endTime := members[0].UpdateTime
+		for _, m := range members {
+			if m.Status != StatusRecovered && m.ResolveTime == 0 {
+				status = IncidentStatusOpen
+			}
+			if m.UpdateTime > endTime {
+				endTime = m.UpdateTime
+			}
+		}
+		root, reason := suggestRootCause(members, inhibits)
+
+		if incident.Status == status && incident.StartTime == members[0].CreateTime && incident.EndTime == endTime &&
+			incident.RootCauseID == root.ID && incident.RootCauseReason == reason {
+			return nil
+		}
+		return tx.Model(&incident).Updates(map[string]interface{}{
+			"status":            status,
+			"start_time":        members[0].CreateTime,
+			"end_time":          endTime,
+			"root_cause_id":     root.ID,
+			"root_cause_rule":   root.RuleName,
+			"root_cause_reason": reason,
+			"update_time":       time.Now().Unix(),
+		}).Error
+	})
+}
+
+// ruleInhibits maps the name of every rule inhibiting others to the rules it
+// inhibits, these are the dependency hints of the root cause suggestion.
+func (o *operator) ruleInhibits() (map[string]rules.RuleNames, error) {
+	var records []rules.Rule
+	if err := o.db.Select("name, inhibits").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	inhibits := make(map[string]rules.RuleNames, len(records))
+	for _, r := range records {
+		if len(r.Inhibits) != 0 {
+			inhibits[r.Name] = r.Inhibits
+		}
+	}
+	return inhibits, nil
+}
+
+const rootCauseEarliest = "earliest result of the incident"
+
+// suggestRootCause picks the member whose rule inhibits, directly or through
+// the rules it inhibits, the rules of the most other members. Members are
+// sorted oldest first and ties go to the earliest, which is the suggestion
+// when no rule of the incident inhibits another.
+func suggestRootCause(members []Analysis, inhibits map[string]rules.RuleNames) (*Analysis, string) {
+	best, bestCount := 0, 0
+	for i := range members {
+		downstream := inhibitedRules(members[i].RuleName, inhibits)
+		count := 0
+		for j := range members {
+			if members[j].RuleName != members[i].RuleName && downstream[members[j].RuleName] {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = i, count
+		}
+	}
+
+	if bestCount == 0 {
+		return &members[best], rootCauseEarliest
+	}
+	return &members[best], fmt.Sprintf("rule %s inhibits the rules of %d of the %d other results",
+		members[best].RuleName, bestCount, len(members)-1)
+}
+
+// inhibitedRules returns the rules name inhibits, directly or not.
+func inhibitedRules(name string, inhibits map[string]rules.RuleNames) map[string]bool {
+	found := make(map[string]bool)
+	queue := []string{name}
+	for len(queue) != 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, inhibited := range inhibits[next] {
+			if !found[inhibited] {
+				found[inhibited] = true
+				queue = append(queue, inhibited)
+			}
+		}
+	}
+	return found
+}
+
+func (o *operator) GetIncidents(filter *IncidentFilter, pageNo, pageSize int) ([]Incident, error) {
+	var incidents []Incident
+	err := filter.apply(o.db.Model(&Incident{})).
+		Order("incident.start_time desc, incident.id desc").
+		Offset((pageNo - 1) * pageSize).
+		Limit(pageSize).
+		Find(&incidents).Error
+	if err != nil || len(incidents) == 0 {
+		return incidents, err
+	}
+
+	index := make(map[uint]int, len(incidents))
+	ids := make([]uint, 0, len(incidents))
+	for i := range incidents {
+		index[incidents[i].ID] = i
+		ids = append(ids, incidents[i].ID)
+	}
+
+	var members []Analysis
+	err = o.withSeverity().
+		Where("analysis.incident_id IN ?", ids).
+		Order("analysis.create_time asc, analysis.id asc").
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := o.resolveRuleRevisions(members); err != nil {
+		return nil, err
+	}
+
+	for _, m := range members {
+		incident := &incidents[index[m.IncidentID]]
+		incident.Results = append(incident.Results, m)
+	}
+	return incidents, nil
+}
+
+func (o *operator) CountIncidents(filter *IncidentFilter) (int, error) {
+	var count int64
+	if err := filter.apply(o.db.Model(&Incident{})).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+func (f *IncidentFilter) apply(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
+	}
+
+	if len(f.Statuses) != 0 {
+		query = query.Where("incident.status IN ?", f.Statuses)
+	}
+	if len(f.Instances) != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM analysis WHERE analysis.incident_id = incident.id AND analysis.instance IN ?)", f.Instances)
+	}
+	if len(f.Pods) != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM analysis WHERE analysis.incident_id = incident.id AND analysis.pod IN ?)", f.Pods)
+	}
+	if len(f.Clusters) != 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM analysis WHERE analysis.incident_id = incident.id AND analysis.cluster IN ?)", f.Clusters)
+	}
+	if f.StartTimeFrom != 0 {
+		query = query.Where("incident.start_time >= ?", f.StartTimeFrom)
+	}
+	if f.StartTimeTo != 0 {
+		query = query.Where("incident.start_time <= ?", f.StartTimeTo)
+	}
+	return query
+}
@@ -0,0 +1,69 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/models/rules"
+	"testing"
+)
+
+func TestSuggestRootCause(t *testing.T) {
+	inhibits := map[string]rules.RuleNames{
+		"network_failure": {"kubelet_service"},
+		"kubelet_service": {"container_breakdown", "node_kube_proxy"},
+	}
+
+	tests := []struct {
+		name       string
+		members    []string
+		wantRule   string
+		wantReason string
+	}{
+		{
+			name:       "no hints",
+			members:    []string{"cpu_usage", "memory_usage"},
+			wantRule:   "cpu_usage",
+			wantReason: rootCauseEarliest,
+		},
+		{
+			name:       "direct hint",
+			members:    []string{"container_breakdown", "kubelet_service", "cpu_usage"},
+			wantRule:   "kubelet_service",
+			wantReason: "rule kubelet_service inhibits the rules of 1 of the 2 other results",
+		},
+		{
+			name:       "transitive hint",
+			members:    []string{"node_kube_proxy", "kubelet_service", "container_breakdown", "network_failure"},
+			wantRule:   "network_failure",
+			wantReason: "rule network_failure inhibits the rules of 3 of the 3 other results",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members := make([]Analysis, 0, len(tt.members))
+			for i, name := range tt.members {
+				members = append(members, Analysis{ID: uint(i + 1), RuleName: name, CreateTime: int64(i)})
+			}
+
+			root, reason := suggestRootCause(members, inhibits)
+			if root.RuleName != tt.wantRule || reason != tt.wantReason {
+				t.Errorf("suggestRootCause() = %s, %q, want %s, %q", root.RuleName, reason, tt.wantRule, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/models/rules"
+
+	"gorm.io/gorm"
+)
+
+// inhibitionCondition matches a result, analysis, with the results
+// inhibiting it, root, whose rule is root_rule. A result is inhibited when,
+// on the same instance of the same cluster and while it was active, a rule
+// listing it in its inhibits was in fault. Results not tied to an instance
+// are never inhibited.
+const inhibitionCondition = "root.status = ? AND root.id <> analysis.id AND analysis.instance <> '' " +
+	"AND root.instance = analysis.instance AND root.cluster = analysis.cluster " +
+	"AND root.create_time <= analysis.update_time AND root.update_time >= analysis.create_time " +
+	"AND JSON_CONTAINS(root_rule.inhibits, JSON_QUOTE(analysis.rule_name))"
+
+// notInhibited keeps the results no other result inhibits.
+func notInhibited(query *gorm.DB) *gorm.DB {
+	return query.Where("NOT EXISTS (SELECT 1 FROM analysis root JOIN rule root_rule ON root_rule.id = root.rule_id WHERE "+
+		inhibitionCondition+")", rules.ConditionFault)
+}
+
+func (o *operator) getInhibitions(column string, ids []uint) ([]inhibition, error) {
+	var inhibitions []inhibition
+	err := o.db.Table("analysis").
+		Select("root.id AS root_id, analysis.id AS inhibited_id").
+		Joins("JOIN analysis root ON root.id <> analysis.id").
+		Joins("JOIN rule root_rule ON root_rule.id = root.rule_id").
+		Where(inhibitionCondition, rules.ConditionFault).
+		Where(column+" IN ?", ids).
+		Order("analysis.create_time asc").
+		Scan(&inhibitions).Error
+	return inhibitions, err
+}
+
+// markInhibited fills in the results inhibiting each record.
+func (o *operator) markInhibited(records []Analysis) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	index := make(map[uint]int, len(records))
+	ids := make([]uint, 0, len(records))
+	for i := range records {
+		index[records[i].ID] = i
+		ids = append(ids, records[i].ID)
+	}
+
+	inhibitions, err := o.getInhibitions("analysis.id", ids)
+	if err != nil {
+		return err
+	}
+	for _, in := range inhibitions {
+		r := &records[index[in.InhibitedID]]
+		r.InhibitedBy = append(r.InhibitedBy, in.RootID)
+	}
+	return nil
+}
+
+// groupInhibited attaches to each record the results it inhibits, and to
+// those the results they inhibit in turn. seen guards against results
+// inhibiting each other.
+func (o *operator) groupInhibited(records []Analysis, seen map[uint]bool) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	index := make(map[uint]int, len(records))
+	ids := make([]uint, 0, len(records))
+	for i := range records {
+		seen[records[i].ID] = true
+		index[records[i].ID] = i
+		ids = append(ids, records[i].ID)
+	}
+
+	inhibitions, err := o.getInhibitions("root.id", ids)
+	if err != nil {
+		return err
+	}
+
+	childIDs := make([]uint, 0, len(inhibitions))
+	for _, in := range inhibitions {
+		if !seen[in.InhibitedID] {
+			childIDs = append(childIDs, in.InhibitedID)
+		}
+	}
+	if len(childIDs) == 0 {
+		return nil
+	}
+
+	var children []Analysis
+	if err := o.withSeverity().Where("analysis.id IN ?", childIDs).Order("analysis.create_time asc").Find(&children).Error; err != nil {
+		return err
+	}
+	if err := o.resolveRuleRevisions(children); err != nil {
+		return err
+	}
+	if err := o.groupInhibited(children, seen); err != nil {
+		return err
+	}
+
+	childIndex := make(map[uint]int, len(children))
+	for i := range children {
+		childIndex[children[i].ID] = i
+	}
+	for _, in := range inhibitions {
+		i, ok := childIndex[in.InhibitedID]
+		if !ok {
+			continue
+		}
+		child := children[i]
+		child.InhibitedBy = []uint{in.RootID}
+		root := &records[index[in.RootID]]
+		root.Inhibited = append(root.Inhibited, child)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/rules"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// labelsMinStep is the smallest step, in seconds, the rule of a result is
+// evaluated at to find the series that triggered it
+const labelsMinStep = 15
+
+// labelsMaxAttempts is the number of times the rule of a result is evaluated
+// before the result is given empty labels
+const labelsMaxAttempts = 30
+
+// AssignLabels fills in the labels of up to limit results stored after the
+// result afterID that have none, along with their instance, pod and
+// container, and records the rule revision of the results stored without one
+// so that it no longer changes. The labels are those of the series of the rule that triggered
+// the result, or the labels these series share when there are several.
+// Results of deleted rules or that no series triggered get empty labels. A
+// result whose rule cannot be evaluated is skipped and retried by the next
+// call, after labelsMaxAttempts failures it is given empty labels so that
+// the results waiting on its labels are not held back. It returns the id of
+// the last result read, to resume from, the number of results labelled and
+// the first evaluation error.
+func (o *operator) AssignLabels(ctx context.Context, afterID uint, limit int) (uint, int, error) {
+	var pending []Analysis
+	err := o.db.Where("id > ? AND labels IS NULL", afterID).
+		Order("id asc").
+		Limit(limit).
+		Find(&pending).Error
+	if err != nil || len(pending) == 0 {
+		return afterID, 0, err
+	}
+	if err := o.resolveRuleRevisions(pending); err != nil {
+		return afterID, 0, err
+	}
+
+	lastID, count := afterID, 0
+	var failure error
+	for i := range pending {
+		labels, err := o.seriesLabels(ctx, &pending[i])
+		if err != nil {
+			if failure == nil {
+				failure = fmt.Errorf("result %d: %w", pending[i].ID, err)
+			}
+			if pending[i].LabelAttempts+1 < labelsMaxAttempts {
+				if err := o.db.Model(&Analysis{}).
+					Where("id = ? AND labels IS NULL", pending[i].ID).
+					Update("label_attempts", gorm.Expr("label_attempts + 1")).Error; err != nil {
+					return lastID, count, err
+				}
+				lastID = pending[i].ID
+				continue
+			}
+			labels = SeriesLabels{}
+		}
+
+		result := o.db.Model(&Analysis{}).
+			Where("id = ? AND labels IS NULL", pending[i].ID).
+			Updates(map[string]interface{}{
+				"labels":         labels,
+				"instance":       labels["instance"],
+				"pod":            labels["pod"],
+				"container":      labels["container"],
+				"rule_revision":  pending[i].RuleRevision,
+				"label_attempts": gorm.Expr("label_attempts + 1"),
+			})
+		if result.Error != nil {
+			return lastID, count, result.Error
+		}
+		lastID = pending[i].ID
+		count += int(result.RowsAffected)
+	}
+	return lastID, count, failure
+}
+
+// seriesLabels evaluates the rule of the result over the time of the result
+// and returns the labels of the series that triggered it.
+func (o *operator) seriesLabels(ctx context.Context, a *Analysis) (SeriesLabels, error) {
+	rule, err := o.ruleAtRevision(a.RuleID, a.RuleRevision)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return SeriesLabels{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := o.clustersOf(a)
+	if errors.Is(err, cluster.ErrUnknown) {
+		return SeriesLabels{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	step := maxInt64((a.UpdateTime-a.CreateTime)/defaultRawDataPoints, labelsMinStep)
+	evaluated, err := o.rules.EvaluateRule(ctx, clusters, rule, a.CreateTime-step, a.UpdateTime+step, step)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.triggeringLabels(evaluated, step), nil
+}
+
+// triggeringLabels returns the labels of the series that triggered the
+// result, those they share if there are several, and empty labels if none
+// did. The arguments a series was expanded with count as its labels.
+func (a *Analysis) triggeringLabels(evaluated []rules.EvaluatedSeries, step int64) SeriesLabels {
+	var labels SeriesLabels
+	for i := range evaluated {
+		if !a.triggeredBy(&evaluated[i], step) {
+			continue
+		}
+
+		series := make(SeriesLabels, len(evaluated[i].Metric)+len(evaluated[i].Arguments))
+		for name, value := range evaluated[i].Arguments {
+			series[name] = value
+		}
+		for name, value := range evaluated[i].Metric {
+			series[name] = value
+		}
+
+		if labels == nil {
+			labels = series
+			continue
+		}
+		for name, value := range labels {
+			if series[name] != value {
+				delete(labels, name)
+			}
+		}
+	}
+
+	if labels == nil {
+		return SeriesLabels{}
+	}
+	return labels
+}
@@ -0,0 +1,148 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"cpds/cpds-analyzer/internal/models/rules"
+	"reflect"
+	"testing"
+)
+
+func TestTriggeringLabels(t *testing.T) {
+	result := Analysis{Status: StatusFault, CreateTime: 1000, UpdateTime: 2000}
+	fault := []rules.BacktestInterval{{Status: StatusFault, StartTime: 900, FireTime: 1200, EndTime: 1500}}
+	subhealth := []rules.BacktestInterval{{Status: StatusSubhealth, StartTime: 900, FireTime: 1200, EndTime: 1500}}
+	before := []rules.BacktestInterval{{Status: StatusFault, StartTime: 100, FireTime: 200, EndTime: 500}}
+
+	tests := []struct {
+		name   string
+		series []rules.EvaluatedSeries
+		want   SeriesLabels
+	}{
+		{
+			name: "single series",
+			series: []rules.EvaluatedSeries{
+				{Metric: map[string]string{"instance": "node1", "pod": "web-1"}, Intervals: fault},
+				{Metric: map[string]string{"instance": "node2"}, Intervals: subhealth},
+				{Metric: map[string]string{"instance": "node3"}, Intervals: before},
+			},
+			want: SeriesLabels{"instance": "node1", "pod": "web-1"},
+		},
+		{
+			name: "shared labels",
+			series: []rules.EvaluatedSeries{
+				{Metric: map[string]string{"instance": "node1", "cluster": "east"}, Intervals: fault},
+				{Metric: map[string]string{"instance": "node2", "cluster": "east"}, Intervals: fault},
+			},
+			want: SeriesLabels{"cluster": "east"},
+		},
+		{
+			name: "arguments",
+			series: []rules.EvaluatedSeries{
+				{Metric: map[string]string{}, Arguments: map[string]string{"instance": "node1"}, Intervals: fault},
+			},
+			want: SeriesLabels{"instance": "node1"},
+		},
+		{
+			name: "no series",
+			series: []rules.EvaluatedSeries{
+				{Metric: map[string]string{"instance": "node1"}, Intervals: before},
+			},
+			want: SeriesLabels{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := result.triggeringLabels(tt.series, 15); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("triggeringLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcknowledgedRevision(t *testing.T) {
+	acknowledged := map[string][]rules.RuleNotification{
+		"a": {
+			{Cluster: "a", DeliveredTime: 100, Revisions: rules.RuleSetRevisions{1: 1, 2: 1}},
+			{Cluster: "a", DeliveredTime: 200, Revisions: rules.RuleSetRevisions{1: 2}},
+		},
+		"b": {
+			{Cluster: "b", DeliveredTime: 150, Revisions: rules.RuleSetRevisions{2: 3}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		clusters []string
+		result   Analysis
+		want     uint
+		wantOK   bool
+	}{
+		{
+			name:     "latest rule set before the result",
+			clusters: []string{"a"},
+			result:   Analysis{RuleID: 1, CreateTime: 250},
+			want:     2,
+			wantOK:   true,
+		},
+		{
+			name:     "rule set acknowledged after the result is ignored",
+			clusters: []string{"a"},
+			result:   Analysis{RuleID: 1, CreateTime: 199},
+			want:     1,
+			wantOK:   true,
+		},
+		{
+			name:     "acknowledged at the time of the result",
+			clusters: []string{"a"},
+			result:   Analysis{RuleID: 1, CreateTime: 200},
+			want:     2,
+			wantOK:   true,
+		},
+		{
+			name:     "older than every rule set",
+			clusters: []string{"a"},
+			result:   Analysis{RuleID: 1, CreateTime: 50},
+		},
+		{
+			name:     "rule left out of the latest rule set",
+			clusters: []string{"a"},
+			result:   Analysis{RuleID: 2, CreateTime: 250},
+		},
+		{
+			name:     "unassigned result takes the first cluster holding the rule",
+			clusters: []string{"a", "b"},
+			result:   Analysis{RuleID: 2, CreateTime: 250},
+			want:     3,
+			wantOK:   true,
+		},
+		{
+			name:     "cluster without rule sets",
+			clusters: []string{"c"},
+			result:   Analysis{RuleID: 1, CreateTime: 250},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := acknowledgedRevision(acknowledged, tt.clusters, &tt.result)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("acknowledgedRevision() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
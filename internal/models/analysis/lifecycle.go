@@ -0,0 +1,120 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors of the incident workflow, the result already being in the state
+// requested.
+var (
+	ErrAlreadyAcknowledged = errors.New("result is already acknowledged")
+	ErrNotAcknowledged     = errors.New("result is not acknowledged")
+	ErrAlreadyAssigned     = errors.New("result is already assigned")
+	ErrAlreadyResolved     = errors.New("result is already resolved")
+)
+
+func (o *operator) AcknowledgeResult(id uint, user string) error {
+	return o.transition(id, &AnalysisEvent{Action: EventActionAcknowledge, User: user}, func(a *Analysis) (map[string]interface{}, error) {
+		if a.AcknowledgeTime != 0 {
+			return nil, ErrAlreadyAcknowledged
+		}
+		return map[string]interface{}{
+			"acknowledged_by":  user,
+			"acknowledge_time": time.Now().Unix(),
+		}, nil
+	})
+}
+
+func (o *operator) UnacknowledgeResult(id uint, user string) error {
+	return o.transition(id, &AnalysisEvent{Action: EventActionUnacknowledge, User: user}, func(a *Analysis) (map[string]interface{}, error) {
+		if a.AcknowledgeTime == 0 {
+			return nil, ErrNotAcknowledged
+		}
+		return map[string]interface{}{
+			"acknowledged_by":  "",
+			"acknowledge_time": 0,
+		}, nil
+	})
+}
+
+func (o *operator) AssignResult(id uint, user, assignee string) error {
+	return o.transition(id, &AnalysisEvent{Action: EventActionAssign, User: user, Assignee: assignee}, func(a *Analysis) (map[string]interface{}, error) {
+		if a.Assignee == assignee {
+			return nil, fmt.Errorf("%w to %s", ErrAlreadyAssigned, assignee)
+		}
+		return map[string]interface{}{"assignee": assignee}, nil
+	})
+}
+
+func (o *operator) ResolveResult(id uint, user, note string) error {
+	return o.transition(id, &AnalysisEvent{Action: EventActionResolve, User: user, Note: note}, func(a *Analysis) (map[string]interface{}, error) {
+		if a.ResolveTime != 0 {
+			return nil, ErrAlreadyResolved
+		}
+		return map[string]interface{}{
+			"resolved_by":     user,
+			"resolve_time":    time.Now().Unix(),
+			"resolution_note": note,
+		}, nil
+	})
+}
+
+func (o *operator) CommentResult(id uint, user, comment string) error {
+	return o.transition(id, &AnalysisEvent{Action: EventActionComment, User: user, Note: comment}, func(a *Analysis) (map[string]interface{}, error) {
+		return nil, nil
+	})
+}
+
+func (o *operator) GetResultEvents(id uint) ([]AnalysisEvent, error) {
+	var events []AnalysisEvent
+	if err := o.db.Where("analysis_id = ?", id).Order("id asc").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// transition locks the result, lets change validate it and return the
+// columns to update, then records event in the audit trail.
+func (o *operator) transition(id uint, event *AnalysisEvent, change func(a *Analysis) (map[string]interface{}, error)) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var a Analysis
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&a, id).Error; err != nil {
+			return err
+		}
+
+		updates, err := change(&a)
+		if err != nil {
+			return err
+		}
+		if len(updates) != 0 {
+			if err := tx.Model(&a).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		event.AnalysisID = id
+		event.CreateTime = time.Now().Unix()
+		return tx.Create(event).Error
+	})
+}
@@ -0,0 +1,112 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTransitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		result     Analysis
+		run        func(o *operator) error
+		wantErr    error
+		wantWrites []string
+	}{
+		{
+			name:       "acknowledge",
+			run:        func(o *operator) error { return o.AcknowledgeResult(1, "alice") },
+			wantWrites: []string{"UPDATE `analysis`", "INSERT INTO `analysis_event`"},
+		},
+		{
+			name:    "acknowledge acknowledged",
+			result:  Analysis{AcknowledgeTime: 100},
+			run:     func(o *operator) error { return o.AcknowledgeResult(1, "alice") },
+			wantErr: ErrAlreadyAcknowledged,
+		},
+		{
+			name:       "unacknowledge",
+			result:     Analysis{AcknowledgeTime: 100},
+			run:        func(o *operator) error { return o.UnacknowledgeResult(1, "alice") },
+			wantWrites: []string{"UPDATE `analysis`", "INSERT INTO `analysis_event`"},
+		},
+		{
+			name:    "unacknowledge not acknowledged",
+			run:     func(o *operator) error { return o.UnacknowledgeResult(1, "alice") },
+			wantErr: ErrNotAcknowledged,
+		},
+		{
+			name:       "assign",
+			result:     Analysis{Assignee: "bob"},
+			run:        func(o *operator) error { return o.AssignResult(1, "alice", "carol") },
+			wantWrites: []string{"UPDATE `analysis`", "INSERT INTO `analysis_event`"},
+		},
+		{
+			name:    "assign to the assignee",
+			result:  Analysis{Assignee: "bob"},
+			run:     func(o *operator) error { return o.AssignResult(1, "alice", "bob") },
+			wantErr: ErrAlreadyAssigned,
+		},
+		{
+			name:       "resolve",
+			run:        func(o *operator) error { return o.ResolveResult(1, "alice", "disk replaced") },
+			wantWrites: []string{"UPDATE `analysis`", "INSERT INTO `analysis_event`"},
+		},
+		{
+			name:    "resolve resolved",
+			result:  Analysis{ResolveTime: 100},
+			run:     func(o *operator) error { return o.ResolveResult(1, "alice", "") },
+			wantErr: ErrAlreadyResolved,
+		},
+		{
+			name:       "comment resolved",
+			result:     Analysis{ResolveTime: 100},
+			run:        func(o *operator) error { return o.CommentResult(1, "alice", "recurring") },
+			wantWrites: []string{"INSERT INTO `analysis_event`"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, db := newFakeOperator(t, func(query string, args []driver.Value) fakeResult {
+				if strings.HasPrefix(query, "SELECT * FROM `analysis`") {
+					return fakeResult{
+						columns: []string{"id", "acknowledge_time", "assignee", "resolve_time"},
+						rows:    [][]driver.Value{{int64(1), tt.result.AcknowledgeTime, tt.result.Assignee, tt.result.ResolveTime}},
+					}
+				}
+				return fakeResult{affected: 1}
+			})
+
+			err := tt.run(o)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if writes := db.writes(); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %q, want %q", writes, tt.wantWrites)
+			}
+			if rejected := tt.wantErr != nil; rejected != (db.rollbacks == 1) || rejected == (db.commits == 1) {
+				t.Errorf("commits = %d, rollbacks = %d", db.commits, db.rollbacks)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// withLock calls fn while holding the named lock of the database, so that a
+// single replica runs a background job at a time. It does nothing if another
+// replica holds the lock. The lock belongs to the connection it was taken on,
+// which is kept until fn returns.
+func (o *operator) withLock(name string, fn func() error) error {
+	return o.db.Connection(func(conn *gorm.DB) error {
+		var acquired sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, 0)", name).Scan(&acquired).Error; err != nil {
+			return err
+		}
+		if acquired.Int64 != 1 {
+			return nil
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", name)
+
+		return fn()
+	})
+}
@@ -0,0 +1,190 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RetentionPolicy decides which results are pruned, see PruneResults.
+type RetentionPolicy struct {
+	// MaxAge prunes the results not updated for that long, 0 keeps them
+	MaxAge time.Duration
+	// MaxRows prunes the least recently updated results beyond that count,
+	// 0 keeps them
+	MaxRows int
+	// KeepFault never prunes fault results, they still count toward MaxRows
+	KeepFault bool
+	// BatchSize is the number of results archived and deleted per transaction
+	BatchSize int
+}
+
+// Archiver stores pruned results before they are deleted. Archive is called
+// within the transaction deleting the results, the ArchiveCommit it returns
+// once the transaction ended.
+type Archiver interface {
+	Archive(tx *gorm.DB, records []AnalysisArchive) (ArchiveCommit, error)
+}
+
+// ArchiveCommit completes an archive, committed reports whether the results
+// archived were deleted.
+type ArchiveCommit func(committed bool) error
+
+// PruneResult counts the results pruned for being older than MaxAge and for
+// exceeding MaxRows.
+type PruneResult struct {
+	Expired int
+	Excess  int
+}
+
+// retentionLock is the lock of the database held while pruning
+const retentionLock = "cpds_analysis_retention"
+
+// PruneResults archives then deletes the results outside of the retention
+// policy, along with their audit trail. A nil archiver deletes them only.
+// Nothing is pruned while another replica is pruning.
+func (o *operator) PruneResults(policy *RetentionPolicy, archiver Archiver) (*PruneResult, error) {
+	result := &PruneResult{}
+	err := o.withLock(retentionLock, func() error {
+		var err error
+		result, err = o.pruneResults(policy, archiver)
+		return err
+	})
+	return result, err
+}
+
+func (o *operator) pruneResults(policy *RetentionPolicy, archiver Archiver) (*PruneResult, error) {
+	result := &PruneResult{}
+
+	if policy.MaxAge > 0 {
+		before := time.Now().Add(-policy.MaxAge).Unix()
+		expired := func(query *gorm.DB) *gorm.DB {
+			return query.Where("update_time < ?", before)
+		}
+
+		var err error
+		if result.Expired, err = o.pruneBatches(policy, archiver, expired, -1); err != nil {
+			return result, err
+		}
+	}
+
+	if policy.MaxRows > 0 {
+		var total int64
+		if err := o.db.Model(&Analysis{}).Count(&total).Error; err != nil {
+			return result, err
+		}
+
+		if excess := int(total) - policy.MaxRows; excess > 0 {
+			var err error
+			if result.Excess, err = o.pruneBatches(policy, archiver, nil, excess); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// pruneBatches prunes the least recently updated results matched by scope,
+// at most limit of them unless limit is negative.
+func (o *operator) pruneBatches(policy *RetentionPolicy, archiver Archiver, scope func(*gorm.DB) *gorm.DB, limit int) (int, error) {
+	pruned := 0
+	for limit < 0 || pruned < limit {
+		size := policy.BatchSize
+		if limit >= 0 && limit-pruned < size {
+			size = limit - pruned
+		}
+
+		n, err := o.pruneBatch(policy, archiver, scope, size)
+		pruned += n
+		if err != nil || n < size {
+			return pruned, err
+		}
+	}
+	return pruned, nil
+}
+
+func (o *operator) pruneBatch(policy *RetentionPolicy, archiver Archiver, scope func(*gorm.DB) *gorm.DB, size int) (int, error) {
+	var pruned int
+	var commit ArchiveCommit
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&Analysis{})
+		if policy.KeepFault {
+			query = query.Where("status <> ?", StatusFault)
+		}
+		if scope != nil {
+			query = scope(query)
+		}
+
+		var records []Analysis
+		if err := query.Order("update_time asc, id asc").Limit(size).Find(&records).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(records))
+		for _, r := range records {
+			ids = append(ids, r.ID)
+		}
+
+		if archiver != nil {
+			var events []AnalysisEvent
+			if err := tx.Where("analysis_id IN ?", ids).Order("id asc").Find(&events).Error; err != nil {
+				return err
+			}
+			trails := make(map[uint]AnalysisEvents, len(records))
+			for _, e := range events {
+				trails[e.AnalysisID] = append(trails[e.AnalysisID], e)
+			}
+
+			now := time.Now().Unix()
+			archived := make([]AnalysisArchive, 0, len(records))
+			for _, r := range records {
+				archived = append(archived, AnalysisArchive{Analysis: r, Events: trails[r.ID], ArchiveTime: now})
+			}
+			var err error
+			if commit, err = archiver.Archive(tx, archived); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("analysis_id IN ?", ids).Delete(&AnalysisEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("analysis_id IN ?", ids).Delete(&AnalysisOccurrence{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&Analysis{}, ids).Error; err != nil {
+			return err
+		}
+		pruned = len(records)
+		return nil
+	})
+	if commit != nil {
+		if commitErr := commit(err == nil); err == nil && commitErr != nil {
+			return pruned, commitErr
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return pruned, nil
+}
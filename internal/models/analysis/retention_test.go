@@ -0,0 +1,181 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"compress/gzip"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneResults(t *testing.T) {
+	deletes := []string{
+		"DELETE FROM `analysis_event`",
+		"DELETE FROM `analysis_occurrence`",
+		"DELETE FROM `analysis`",
+	}
+	archiveName := fmt.Sprintf("%s-1.jsonl.gz", time.Now().Format(archiveFileLayout))
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name       string
+		archive    string
+		failOn     string
+		wantErr    bool
+		wantWrites []string
+		wantFiles  []string
+	}{
+		{
+			name:       "without archive",
+			wantWrites: deletes,
+		},
+		{
+			name:       "table archive",
+			archive:    "table",
+			wantWrites: append([]string{"INSERT INTO `analysis_archive`"}, deletes...),
+		},
+		{
+			name:       "table archive failing",
+			archive:    "table",
+			failOn:     "INSERT INTO `analysis_archive`",
+			wantErr:    true,
+			wantWrites: []string{"INSERT INTO `analysis_archive`"},
+		},
+		{
+			name:       "file archive",
+			archive:    "file",
+			wantWrites: deletes,
+			wantFiles:  []string{archiveName},
+		},
+		{
+			name:       "file archive rolled back",
+			archive:    "file",
+			failOn:     "DELETE FROM `analysis` ",
+			wantErr:    true,
+			wantWrites: deletes,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var archiver Archiver
+			switch tt.archive {
+			case "table":
+				archiver = TableArchiver{}
+			case "file":
+				archiver = FileArchiver{Dir: dir}
+			}
+
+			o, db := newFakeOperator(t, func(query string, args []driver.Value) fakeResult {
+				switch {
+				case tt.failOn != "" && strings.HasPrefix(query, tt.failOn):
+					return fakeResult{err: errFailed}
+				case strings.HasPrefix(query, "SELECT GET_LOCK"):
+					return fakeResult{columns: []string{"GET_LOCK"}, rows: [][]driver.Value{{int64(1)}}}
+				case strings.HasPrefix(query, "SELECT * FROM `analysis` "):
+					return fakeResult{
+						columns: []string{"id", "rule_name", "update_time"},
+						rows:    [][]driver.Value{{int64(1), "cpu_usage", int64(100)}, {int64(2), "cpu_usage", int64(200)}},
+					}
+				case strings.HasPrefix(query, "SELECT * FROM `analysis_event`"):
+					return fakeResult{
+						columns: []string{"id", "analysis_id", "action"},
+						rows:    [][]driver.Value{{int64(1), int64(2), EventActionAcknowledge}},
+					}
+				}
+				return fakeResult{affected: 2}
+			})
+
+			result, err := o.PruneResults(&RetentionPolicy{MaxAge: time.Hour, BatchSize: 10}, archiver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PruneResults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			wantExpired := 2
+			if tt.wantErr {
+				wantExpired = 0
+			}
+			if result.Expired != wantExpired {
+				t.Errorf("expired = %d, want %d", result.Expired, wantExpired)
+			}
+			if writes := db.writes(); !reflect.DeepEqual(writes, tt.wantWrites) {
+				t.Errorf("writes = %q, want %q", writes, tt.wantWrites)
+			}
+			if tt.wantErr != (db.rollbacks == 1) || tt.wantErr == (db.commits == 1) {
+				t.Errorf("commits = %d, rollbacks = %d", db.commits, db.rollbacks)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var files []string
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+			if !reflect.DeepEqual(files, tt.wantFiles) {
+				t.Errorf("files = %q, want %q", files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestFileArchive(t *testing.T) {
+	dir := t.TempDir()
+	records := []AnalysisArchive{
+		{Analysis: Analysis{ID: 7, RuleName: "cpu_usage"}, ArchiveTime: 300},
+		{Analysis: Analysis{ID: 8, RuleName: "cpu_usage"}, Events: AnalysisEvents{{ID: 1, AnalysisID: 8, Action: EventActionResolve}}, ArchiveTime: 300},
+	}
+
+	commit, err := FileArchiver{Dir: dir}.Archive(nil, records)
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	if err := commit(true); err != nil {
+		t.Fatalf("commit error = %v", err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, fmt.Sprintf("%s-7.jsonl.gz", time.Now().Format(archiveFileLayout))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []AnalysisArchive
+	decoder := json.NewDecoder(zr)
+	for decoder.More() {
+		var r AnalysisArchive
+		if err := decoder.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if len(got) != 2 || got[0].ID != 7 || got[1].ID != 8 || len(got[1].Events) != 1 || got[1].Events[0].Action != EventActionResolve {
+		t.Errorf("archived = %+v", got)
+	}
+}
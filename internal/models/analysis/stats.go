@@ -0,0 +1,251 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import "gorm.io/gorm"
+
+const (
+	faultsColumn = "COALESCE(SUM(analysis.status = 'fault'), 0)"
+
+	// transitionsColumn is the state transitions of the rule or instance
+	// grouped by, joined as key_transitions
+	transitionsColumn = "COALESCE(MAX(key_transitions.transitions), 0)"
+)
+
+// GetStats computes the statistics of the results matched by filter and
+// created within the window of options.
+func (o *operator) GetStats(filter *Filter, options *StatsOptions) (*Stats, error) {
+	window := func() *gorm.DB {
+		return filter.apply(joinRule(o.db.Model(&Analysis{}))).
+			Where("analysis.create_time >= ? AND analysis.create_time < ?", options.StartTime, options.EndTime)
+	}
+
+	stats := &Stats{
+		StartTime: options.StartTime,
+		EndTime:   options.EndTime,
+		Bucket:    options.Bucket,
+	}
+
+	var total int64
+	if err := window().Count(&total).Error; err != nil {
+		return nil, err
+	}
+	stats.Total = int(total)
+
+	buckets, err := o.statsBuckets(window(), options)
+	if err != nil {
+		return nil, err
+	}
+	stats.Buckets = buckets
+
+	// occurrences are the state transitions recorded within the window for
+	// the results matched by filter, the results collapsed into a flapping
+	// incident included
+	members := Filter{}
+	if filter != nil {
+		members = *filter
+	}
+	members.ShowFlapping = true
+	occurrences := members.apply(joinRule(o.db.Model(&Analysis{}))).
+		Select("analysis.rule_id AS rule_id, analysis.instance AS instance, analysis_occurrence.transitions AS transitions").
+		Joins("JOIN analysis_occurrence ON analysis_occurrence.analysis_id = analysis.id").
+		Where("analysis_occurrence.time >= ? AND analysis_occurrence.time < ?", options.StartTime, options.EndTime)
+	transitions := func(key string) *gorm.DB {
+		return o.db.Table("(?) AS occurrences", occurrences).
+			Select(key + ", SUM(transitions) AS transitions").
+			Group(key)
+	}
+
+	err = window().
+		Select("analysis.rule_id AS rule_id, analysis.rule_name AS rule_name, COUNT(*) AS incidents, "+
+			faultsColumn+" AS faults, "+transitionsColumn+" AS transitions").
+		Joins("LEFT JOIN (?) AS key_transitions ON key_transitions.rule_id = analysis.rule_id", transitions("rule_id")).
+		Group("analysis.rule_id, analysis.rule_name").
+		Order("transitions desc, incidents desc, rule_name asc").
+		Limit(options.Top).
+		Scan(&stats.TopRules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = window().
+		Select("analysis.instance AS instance, COUNT(*) AS incidents, "+
+			faultsColumn+" AS faults, "+transitionsColumn+" AS transitions").
+		Joins("LEFT JOIN (?) AS key_transitions ON key_transitions.instance = analysis.instance", transitions("instance")).
+		Where("analysis.instance <> ''").
+		Group("analysis.instance").
+		Order("transitions desc, incidents desc, instance asc").
+		Limit(options.Top).
+		Scan(&stats.TopInstances).Error
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := o.reliability(window())
+	if err != nil {
+		return nil, err
+	}
+	stats.MTTR, stats.MTBF = r.mttr.mean(), r.mtbf.mean()
+	for i := range stats.TopRules {
+		stats.TopRules[i].MTTR = r.ruleMTTR[stats.TopRules[i].RuleID].mean()
+	}
+	for i := range stats.TopInstances {
+		instance := stats.TopInstances[i].Instance
+		stats.TopInstances[i].MTTR = r.instanceMTTR[instance].mean()
+		stats.TopInstances[i].MTBF = r.instanceMTBF[instance].mean()
+	}
+
+	return stats, nil
+}
+
+// reliability reads the results of query, by instance then creation, and
+// computes their MTTR and MTBF. Only the columns needed are read, a result at
+// a time.
+func (o *operator) reliability(query *gorm.DB) (*reliability, error) {
+	rows, err := query.
+		Select("analysis.rule_id, analysis.instance, analysis.status, analysis.create_time, analysis.update_time").
+		Order("analysis.instance, analysis.create_time, analysis.id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := newReliability()
+	for rows.Next() {
+		var a Analysis
+		if err := o.db.ScanRows(rows, &a); err != nil {
+			return nil, err
+		}
+		r.add(&a)
+	}
+	return r, rows.Err()
+}
+
+// meanDuration averages durations in seconds.
+type meanDuration struct {
+	sum   int64
+	count int
+}
+
+func (m *meanDuration) add(d int64) {
+	m.sum += d
+	m.count++
+}
+
+// mean returns the mean duration, nil without any duration.
+func (m meanDuration) mean() *float64 {
+	if m.count == 0 {
+		return nil
+	}
+	mean := float64(m.sum) / float64(m.count)
+	return &mean
+}
+
+// reliability accumulates the MTTR and MTBF of results, overall, by rule and
+// by instance. The MTTR averages the duration of the recovered results. The
+// MTBF averages the time between the start of a result and the latest end of
+// the results started before it on its instance, 0 when they overlap.
+// Results are added ordered by instance then creation time.
+type reliability struct {
+	mttr         meanDuration
+	mtbf         meanDuration
+	ruleMTTR     map[uint]meanDuration
+	instanceMTTR map[string]meanDuration
+	instanceMTBF map[string]meanDuration
+
+	// instance is the instance of the results added last, previousEnd the
+	// latest end of these results
+	instance    string
+	previousEnd int64
+}
+
+func newReliability() *reliability {
+	return &reliability{
+		ruleMTTR:     make(map[uint]meanDuration),
+		instanceMTTR: make(map[string]meanDuration),
+		instanceMTBF: make(map[string]meanDuration),
+	}
+}
+
+func (r *reliability) add(a *Analysis) {
+	if a.Status == StatusRecovered {
+		d := a.UpdateTime - a.CreateTime
+		r.mttr.add(d)
+		rule := r.ruleMTTR[a.RuleID]
+		rule.add(d)
+		r.ruleMTTR[a.RuleID] = rule
+		if a.Instance != "" {
+			instance := r.instanceMTTR[a.Instance]
+			instance.add(d)
+			r.instanceMTTR[a.Instance] = instance
+		}
+	}
+	if a.Instance == "" {
+		return
+	}
+
+	if a.Instance != r.instance {
+		r.instance, r.previousEnd = a.Instance, a.UpdateTime
+		return
+	}
+	gap := a.CreateTime - r.previousEnd
+	if gap < 0 {
+		gap = 0
+	}
+	r.mtbf.add(gap)
+	instance := r.instanceMTBF[a.Instance]
+	instance.add(gap)
+	r.instanceMTBF[a.Instance] = instance
+	if a.UpdateTime > r.previousEnd {
+		r.previousEnd = a.UpdateTime
+	}
+}
+
+// statsBuckets counts the results of query per bucket, buckets without
+// results are returned as well.
+func (o *operator) statsBuckets(query *gorm.DB, options *StatsOptions) ([]StatsBucket, error) {
+	var rows []struct {
+		Bucket int64
+		StatsBucket
+	}
+	err := query.
+		Select("FLOOR((analysis.create_time - ?) / ?) AS bucket, "+
+			"COALESCE(SUM(analysis.status = 'subhealth'), 0) AS subhealth, "+
+			"COALESCE(SUM(analysis.status = 'fault'), 0) AS fault, "+
+			"COALESCE(SUM(analysis.status = 'recovered'), 0) AS recovered, "+
+			"COUNT(*) AS total", options.StartTime, options.Bucket).
+		Group("bucket").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	count := (options.EndTime - options.StartTime + options.Bucket - 1) / options.Bucket
+	buckets := make([]StatsBucket, count)
+	for i := range buckets {
+		buckets[i].StartTime = options.StartTime + int64(i)*options.Bucket
+	}
+	for _, row := range rows {
+		if row.Bucket < 0 || row.Bucket >= count {
+			continue
+		}
+		row.StatsBucket.StartTime = buckets[row.Bucket].StartTime
+		buckets[row.Bucket] = row.StatsBucket
+	}
+	return buckets, nil
+}
@@ -0,0 +1,119 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import "testing"
+
+func TestReliability(t *testing.T) {
+	tests := []struct {
+		name             string
+		results          []Analysis
+		wantMTTR         *float64
+		wantMTBF         *float64
+		wantInstanceMTBF map[string]float64
+		wantRuleMTTR     map[uint]float64
+	}{
+		{
+			name: "no results",
+		},
+		{
+			name: "recovered results",
+			results: []Analysis{
+				{RuleID: 1, Instance: "node1", Status: StatusRecovered, CreateTime: 100, UpdateTime: 160},
+				{RuleID: 2, Instance: "node1", Status: StatusFault, CreateTime: 200, UpdateTime: 500},
+				{RuleID: 1, Instance: "node2", Status: StatusRecovered, CreateTime: 100, UpdateTime: 220},
+			},
+			wantMTTR:         float(90),
+			wantMTBF:         float(40),
+			wantInstanceMTBF: map[string]float64{"node1": 40},
+			wantRuleMTTR:     map[uint]float64{1: 90},
+		},
+		{
+			name: "gaps after the latest end",
+			results: []Analysis{
+				{RuleID: 1, Instance: "node1", Status: StatusFault, CreateTime: 100, UpdateTime: 400},
+				{RuleID: 2, Instance: "node1", Status: StatusFault, CreateTime: 150, UpdateTime: 200},
+				{RuleID: 3, Instance: "node1", Status: StatusFault, CreateTime: 300, UpdateTime: 350},
+				{RuleID: 1, Instance: "node1", Status: StatusFault, CreateTime: 600, UpdateTime: 700},
+			},
+			wantMTBF:         float(200.0 / 3),
+			wantInstanceMTBF: map[string]float64{"node1": 200.0 / 3},
+		},
+		{
+			name: "results without instance have no gap",
+			results: []Analysis{
+				{RuleID: 1, Status: StatusRecovered, CreateTime: 100, UpdateTime: 130},
+				{RuleID: 1, Status: StatusRecovered, CreateTime: 200, UpdateTime: 230},
+			},
+			wantMTTR:     float(30),
+			wantRuleMTTR: map[uint]float64{1: 30},
+		},
+		{
+			name: "gaps do not span instances",
+			results: []Analysis{
+				{RuleID: 1, Instance: "node1", Status: StatusFault, CreateTime: 100, UpdateTime: 200},
+				{RuleID: 1, Instance: "node2", Status: StatusFault, CreateTime: 300, UpdateTime: 400},
+				{RuleID: 1, Instance: "node2", Status: StatusFault, CreateTime: 410, UpdateTime: 500},
+			},
+			wantMTBF:         float(10),
+			wantInstanceMTBF: map[string]float64{"node2": 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReliability()
+			for i := range tt.results {
+				r.add(&tt.results[i])
+			}
+
+			if !sameMean(r.mttr.mean(), tt.wantMTTR) {
+				t.Errorf("MTTR = %v, want %v", deref(r.mttr.mean()), deref(tt.wantMTTR))
+			}
+			if !sameMean(r.mtbf.mean(), tt.wantMTBF) {
+				t.Errorf("MTBF = %v, want %v", deref(r.mtbf.mean()), deref(tt.wantMTBF))
+			}
+			for instance, want := range tt.wantInstanceMTBF {
+				if got := r.instanceMTBF[instance].mean(); !sameMean(got, &want) {
+					t.Errorf("MTBF of %s = %v, want %v", instance, deref(got), want)
+				}
+			}
+			for rule, want := range tt.wantRuleMTTR {
+				if got := r.ruleMTTR[rule].mean(); !sameMean(got, &want) {
+					t.Errorf("MTTR of rule %d = %v, want %v", rule, deref(got), want)
+				}
+			}
+		})
+	}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func deref(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func sameMean(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
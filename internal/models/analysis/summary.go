@@ -0,0 +1,107 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package analysis
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// summaryCounts are the columns of SummaryCount
+const summaryCounts = "COALESCE(SUM(analysis.status = 'subhealth'), 0) AS subhealth, " +
+	"COALESCE(SUM(analysis.status = 'fault'), 0) AS fault, COUNT(*) AS total"
+
+// Scan implements sql.Scanner, labels are stored as json text.
+func (l *SeriesLabels) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported labels type %T", value)
+	}
+
+	if len(data) == 0 {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, l)
+}
+
+// Value implements driver.Valuer. Nil labels are not known yet, they are
+// stored as NULL, unlike empty labels.
+func (l SeriesLabels) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// GetSummary counts the open results matched by filter, in total and by
+// instance, rule and severity.
+func (o *operator) GetSummary(filter *Filter) (*Summary, error) {
+	open := func() *gorm.DB {
+		query := filter.apply(joinRule(o.db.Model(&Analysis{})))
+		return query.Where("analysis.status IN ? AND analysis.resolve_time = 0", []string{StatusSubhealth, StatusFault})
+	}
+
+	summary := &Summary{}
+	if err := open().Select(summaryCounts).Scan(&summary.SummaryCount).Error; err != nil {
+		return nil, err
+	}
+
+	err := open().
+		Select("analysis.instance AS instance, " + summaryCounts).
+		Group("analysis.instance").
+		Order("total desc, instance asc").
+		Scan(&summary.Instances).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = open().
+		Select("analysis.rule_id AS rule_id, analysis.rule_name AS rule_name, " + summaryCounts).
+		Group("analysis.rule_id, analysis.rule_name").
+		Order("total desc, rule_name asc").
+		Scan(&summary.Rules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = open().
+		Select("COALESCE(severity.name, '') AS severity, COALESCE(severity.`rank`, 0) AS severity_rank, " + summaryCounts).
+		Group("severity.name, severity.`rank`").
+		Order("severity_rank desc, total desc").
+		Scan(&summary.Severities).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
@@ -16,22 +16,385 @@
 
 package analysis
 
-import "cpds/cpds-analyzer/pkg/prometheus"
+import (
+	"cpds/cpds-analyzer/internal/models/rules"
+	"time"
+)
 
+// Analysis is a diagnostic result written by the detector. RuleRevision is
+// the revision of the rule that produced it, results recorded before rules
+// were versioned are resolved by their create time. The fields from
+// Description to SeverityRank are joined from the rule and are not columns
+// of the table.
+// Labels are filled in by the analyzer once the result is written, nil until
+// then. Instance, Pod and Container are copied from them to be indexed, they
+// are empty for results not tied to one. Cluster
+// is assigned by the analyzer, it is empty until the cluster of the result is
+// known.
 type Analysis struct {
+	ID           uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	RuleID       uint   `json:"rule_id" gorm:"not null"`
+	RuleName     string `json:"rule_name" gorm:"not null"`
+	RuleRevision uint   `json:"rule_revision" gorm:"not null;default:0"`
+	Status       string `json:"status" gorm:"not null"`
+	Count        uint   `json:"count" gorm:"not null"`
+	CreateTime   int64  `json:"create_time" gorm:"not null"`
+	UpdateTime   int64  `json:"update_time" gorm:"not null"`
+	Instance     string `json:"instance" gorm:"not null;default:'';index"`
+	Pod          string `json:"pod" gorm:"not null;default:'';index"`
+	Container    string `json:"container" gorm:"not null;default:'';index"`
+	Cluster      string `json:"cluster" gorm:"type:varchar(64);not null;default:'';index"`
+	// Labels are the labels of the series that triggered the result,
+	// LabelAttempts the evaluations of its rule made to find them
+	Labels        SeriesLabels `json:"labels" gorm:"type:text"`
+	LabelAttempts int          `json:"-" gorm:"not null;default:0"`
+
+	// Flapping is set once the rule flaps on the instance of the result,
+	// FlapID is the first result of the flapping incident
+	Flapping bool `json:"flapping" gorm:"not null;default:false;index"`
+	FlapID   uint `json:"flap_id" gorm:"not null;default:0;index"`
+
+	// IncidentID is the correlated incident the result is grouped into, 0
+	// until it is grouped
+	IncidentID uint `json:"incident_id" gorm:"not null;default:0;index"`
+
+	// incident workflow, left alone by the detector
+	AcknowledgedBy  string `json:"acknowledged_by" gorm:"type:varchar(64);not null;default:''"`
+	AcknowledgeTime int64  `json:"acknowledge_time" gorm:"not null;default:0"`
+	Assignee        string `json:"assignee" gorm:"type:varchar(64);not null;default:'';index"`
+	ResolvedBy      string `json:"resolved_by" gorm:"type:varchar(64);not null;default:''"`
+	ResolveTime     int64  `json:"resolve_time" gorm:"not null;default:0"`
+	ResolutionNote  string `json:"resolution_note" gorm:"type:text"`
+
+	Description  string `json:"description" gorm:"->;-:migration"`
+	RunbookURL   string `json:"runbook_url" gorm:"->;-:migration"`
+	OwnerTeam    string `json:"owner_team" gorm:"->;-:migration"`
+	Remediation  string `json:"remediation" gorm:"->;-:migration"`
+	Severity     string `json:"severity" gorm:"->;-:migration"`
+	SeverityRank int    `json:"severity_rank" gorm:"->;-:migration"`
+
+	// InhibitedBy lists the results inhibiting this one, Inhibited the results
+	// this one inhibits. Which of the two is filled depends on the query.
+	InhibitedBy []uint     `json:"inhibited_by,omitempty" gorm:"-"`
+	Inhibited   []Analysis `json:"inhibited,omitempty" gorm:"-"`
+
+	// FlapResults is the number of results collapsed into this one
+	FlapResults int `json:"flap_results,omitempty" gorm:"-"`
+}
+
+const (
+	StatusSubhealth = rules.ConditionSubhealth
+	StatusFault     = rules.ConditionFault
+	StatusRecovered = "recovered"
+)
+
+var Statuses = []string{StatusSubhealth, StatusFault, StatusRecovered}
+
+// SortFields are the fields results can be sorted by.
+var SortFields = []string{"id", "rule_id", "rule_name", "status", "count", "instance", "pod", "container", "cluster", "create_time", "update_time", "severity_rank"}
+
+// SeriesLabels are the labels of a prometheus series.
+type SeriesLabels map[string]string
+
+// Filter narrows down analysis results. Empty fields match everything, a
+// result matches a list if it matches any of its values and time bounds of 0
+// are left open.
+type Filter struct {
+	RuleName        string
+	RuleIDs         []uint
+	Statuses        []string
+	Instances       []string
+	Pods            []string
+	Containers      []string
+	Clusters        []string
+	Labels          map[string]string
+	Severities      []string
+	MinSeverityRank int
+
+	CreateTimeStart int64
+	CreateTimeEnd   int64
+	UpdateTimeStart int64
+	UpdateTimeEnd   int64
+
+	Acknowledged *bool
+	Resolved     *bool
+	Assignees    []string
+
+	Flapping *bool
+
+	// ShowFlapping lists every result of a flapping incident instead of
+	// collapsing them into the first one.
+	ShowFlapping bool
+
+	// ShowInhibited lists inhibited results along with the others instead of
+	// grouping them under the results inhibiting them.
+	ShowInhibited bool
+}
+
+// Selector selects results by id and by filter, either or both. Unlike the
+// listing, results inhibited by others are selected as well.
+type Selector struct {
+	IDs    []uint
+	Filter *Filter
+}
+
+// inhibition pairs a result in fault with a result it inhibits.
+type inhibition struct {
+	RootID      uint
+	InhibitedID uint
+}
+
+const (
+	// defaultRawDataPoints is the number of points queried when no step is given
+	defaultRawDataPoints = 250
+
+	// maxRawDataPoints is the prometheus limit of points per series
+	maxRawDataPoints = 11000
+)
+
+// RawDataOptions widens the evaluated range around the result, in seconds.
+// A zero Step picks one for about defaultRawDataPoints points.
+type RawDataOptions struct {
+	PaddingBefore int64
+	PaddingAfter  int64
+	Step          int64
+}
+
+// Threshold is a condition of the rule, drawn as a line over the series.
+type Threshold struct {
+	Status        string  `json:"status"`
+	ConditionType string  `json:"condition_type"`
+	Value         float64 `json:"value"`
+}
+
+// RawDataSeries is a series of the rule, Triggered tells whether it could have
+// produced the result.
+type RawDataSeries struct {
+	rules.EvaluatedSeries
+	Triggered bool `json:"triggered"`
+}
+
+// RawData is the rule of a result evaluated around the time of the result.
+type RawData struct {
+	RuleID            uint            `json:"rule_id"`
+	RuleRevision      uint            `json:"rule_revision"`
+	Expression        string          `json:"expression"`
+	StartTime         int64           `json:"start_time"`
+	EndTime           int64           `json:"end_time"`
+	Step              int64           `json:"step"`
+	IncidentStartTime int64           `json:"incident_start_time"`
+	IncidentEndTime   int64           `json:"incident_end_time"`
+	Thresholds        []Threshold     `json:"thresholds"`
+	Series            []RawDataSeries `json:"series"`
+}
+
+const (
+	EventActionAcknowledge   = "acknowledge"
+	EventActionUnacknowledge = "unacknowledge"
+	EventActionAssign        = "assign"
+	EventActionResolve       = "resolve"
+	EventActionComment       = "comment"
+)
+
+// AnalysisEvent is an entry of the audit trail of a result, one per state
+// change or comment.
+type AnalysisEvent struct {
 	ID         uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
-	RuleID     uint   `json:"rule_id" gorm:"not null"`
-	RuleName   string `json:"rule_name" gorm:"not null"`
-	Status     string `json:"status" gorm:"not null"`
-	Count      uint   `json:"count" gorm:"not null"`
+	AnalysisID uint   `json:"analysis_id" gorm:"not null;index"`
+	Action     string `json:"action" gorm:"not null"`
+	User       string `json:"user" gorm:"type:varchar(64);not null"`
+	Assignee   string `json:"assignee,omitempty" gorm:"type:varchar(64)"`
+	Note       string `json:"note,omitempty" gorm:"type:text"`
 	CreateTime int64  `json:"create_time" gorm:"not null"`
-	UpdateTime int64  `json:"update_time" gorm:"not null"`
 }
 
-type detectorRawDataResponse struct {
-	Status    int                `json:"status"`
-	Code      int                `json:"code"`
-	Message   string             `json:"message"`
-	Data      *prometheus.Metric `json:"data"`
-	Timestamp int64              `json:"timestamp"`
+// SummaryCount counts the open results, those that neither recovered nor
+// were resolved.
+type SummaryCount struct {
+	Subhealth int `json:"subhealth"`
+	Fault     int `json:"fault"`
+	Total     int `json:"total"`
+}
+
+type InstanceSummary struct {
+	Instance string `json:"instance"`
+	SummaryCount
+}
+
+type RuleSummary struct {
+	RuleID   uint   `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	SummaryCount
+}
+
+type SeveritySummary struct {
+	Severity     string `json:"severity"`
+	SeverityRank int    `json:"severity_rank"`
+	SummaryCount
+}
+
+// Summary breaks the open results down by instance, rule and severity, the
+// most affected first.
+type Summary struct {
+	SummaryCount
+	Instances  []InstanceSummary `json:"instances"`
+	Rules      []RuleSummary     `json:"rules"`
+	Severities []SeveritySummary `json:"severities"`
+}
+
+// StatsOptions is the window of the statistics, in unix seconds, split into
+// buckets of Bucket seconds. Top bounds the rules and instances returned.
+type StatsOptions struct {
+	StartTime int64
+	EndTime   int64
+	Bucket    int64
+	Top       int
+}
+
+// StatsBucket counts the results created within a bucket, by their current
+// status.
+type StatsBucket struct {
+	StartTime int64 `json:"start_time"`
+	Subhealth int   `json:"subhealth"`
+	Fault     int   `json:"fault"`
+	Recovered int   `json:"recovered"`
+	Total     int   `json:"total"`
+}
+
+// RuleStats and InstanceStats count the results of a rule or an instance,
+// each result being an incident. Transitions are the state transitions of
+// its results within the window, what the flapping detection counts. MTTR
+// and MTBF are in seconds, nil when there is not enough data.
+type RuleStats struct {
+	RuleID      uint     `json:"rule_id"`
+	RuleName    string   `json:"rule_name"`
+	Transitions int      `json:"transitions"`
+	Incidents   int      `json:"incidents"`
+	Faults      int      `json:"faults"`
+	MTTR        *float64 `json:"mttr"`
+}
+
+type InstanceStats struct {
+	Instance    string   `json:"instance"`
+	Transitions int      `json:"transitions"`
+	Incidents   int      `json:"incidents"`
+	Faults      int      `json:"faults"`
+	MTTR        *float64 `json:"mttr"`
+	MTBF        *float64 `json:"mtbf"`
+}
+
+// Stats are the statistics of the results created within a window. MTTR is
+// the mean duration of the recovered results, MTBF the mean time between the
+// end of a result and the start of the next one on the same instance.
+type Stats struct {
+	StartTime    int64           `json:"start_time"`
+	EndTime      int64           `json:"end_time"`
+	Bucket       int64           `json:"bucket"`
+	Total        int             `json:"total"`
+	MTTR         *float64        `json:"mttr"`
+	MTBF         *float64        `json:"mtbf"`
+	Buckets      []StatsBucket   `json:"buckets"`
+	TopRules     []RuleStats     `json:"top_rules"`
+	TopInstances []InstanceStats `json:"top_instances"`
+}
+
+// AnalysisOccurrence is a state transition of a result seen by the flapping
+// detection: the result started, changed status or its count grew.
+// Transitions is 1 for a status change and the count growth otherwise.
+type AnalysisOccurrence struct {
+	ID          uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	AnalysisID  uint   `json:"analysis_id" gorm:"not null;index"`
+	RuleID      uint   `json:"rule_id" gorm:"not null;index:idx_analysis_occurrence_key"`
+	Instance    string `json:"instance" gorm:"not null;default:'';index:idx_analysis_occurrence_key"`
+	Status      string `json:"status" gorm:"not null"`
+	Count       uint   `json:"count" gorm:"not null"`
+	Transitions int    `json:"transitions" gorm:"not null"`
+	Time        int64  `json:"time" gorm:"not null;index"`
+}
+
+// FlappingPolicy makes a rule flap on an instance when its results make at
+// least Transitions state transitions within Window.
+type FlappingPolicy struct {
+	Window      time.Duration
+	Transitions int
+}
+
+// Timeline is the flapping incident of a result: every result of the
+// incident and their state transitions, oldest first. It is the result alone
+// if it does not flap.
+type Timeline struct {
+	FlapID      uint                 `json:"flap_id"`
+	Flapping    bool                 `json:"flapping"`
+	Results     []Analysis           `json:"results"`
+	Occurrences []AnalysisOccurrence `json:"occurrences"`
+}
+
+const (
+	IncidentStatusOpen   = "open"
+	IncidentStatusClosed = "closed"
+)
+
+var IncidentStatuses = []string{IncidentStatusOpen, IncidentStatusClosed}
+
+// Incident groups the results of rules and nodes failing together: results
+// sharing an instance or a pod that are active within the grouping window
+// of each other. It is open while any of its results is active.
+// RootCauseID is the result suggested as the cause of the others and
+// RootCauseReason tells why it was picked.
+type Incident struct {
+	ID              uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Status          string `json:"status" gorm:"type:varchar(16);not null;index"`
+	StartTime       int64  `json:"start_time" gorm:"not null;index"`
+	EndTime         int64  `json:"end_time" gorm:"not null"`
+	RootCauseID     uint   `json:"root_cause_id" gorm:"not null;default:0"`
+	RootCauseRule   string `json:"root_cause_rule" gorm:"not null;default:''"`
+	RootCauseReason string `json:"root_cause_reason" gorm:"type:varchar(255);not null;default:''"`
+	CreateTime      int64  `json:"create_time" gorm:"not null"`
+	UpdateTime      int64  `json:"update_time" gorm:"not null"`
+
+	// Results are the members of the incident, oldest first
+	Results []Analysis `json:"results" gorm:"-"`
+}
+
+// IncidentPolicy groups results active within Window of each other. At most
+// BatchSize results are grouped per run.
+type IncidentPolicy struct {
+	Window    time.Duration
+	BatchSize int
+}
+
+// IncidentFilter selects the incidents listed by GetIncidents, an incident
+// matches Instances, Pods and Clusters if any of its results does. Empty fields match
+// every incident.
+type IncidentFilter struct {
+	Statuses      []string
+	Instances     []string
+	Pods          []string
+	Clusters      []string
+	StartTimeFrom int64
+	StartTimeTo   int64
+}
+
+// ContextEntity is a node, a pod or a container around a result. Results are
+// the other results on the entity itself active along with the result,
+// Faulty is set when there is any.
+type ContextEntity struct {
+	Kind     string           `json:"kind"`
+	Name     string           `json:"name"`
+	Faulty   bool             `json:"faulty"`
+	Results  []uint           `json:"results,omitempty"`
+	Children []*ContextEntity `json:"children,omitempty"`
+}
+
+// ResultContext places a result in the node, pod and container topology.
+// Kind is the kind of the entity of the result, empty for results tied to
+// none. Parents are the entities above it, node first, without their
+// children; ParentFaulty is set when any of them is faulty, the result being
+// likely a consequence. Topology is the tree of the node of the result.
+type ResultContext struct {
+	Result       Analysis        `json:"result"`
+	Kind         string          `json:"kind"`
+	Parents      []ContextEntity `json:"parents"`
+	ParentFaulty bool            `json:"parent_faulty"`
+	Topology     *ContextEntity  `json:"topology"`
 }
@@ -0,0 +1,135 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/pkg/cache"
+	cacheconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/prometheus"
+	"fmt"
+	"time"
+)
+
+// the caches are shared by every operator, their keys start with the
+// address of the detector
+var (
+	targetsCache         = cache.New("monitor_targets")
+	nodeInfoCache        = cache.New("monitor_node_info")
+	nodeStatusCache      = cache.New("monitor_node_status")
+	containerStatusCache = cache.New("monitor_container_status")
+	resourcesCache       = cache.New("monitor_resources")
+)
+
+// cachedOperator caches the responses of the detector. The topology is read
+// from the prometheus operator, which has its own cache.
+type cachedOperator struct {
+	Operator
+	detector string
+
+	targetsTTL         time.Duration
+	nodeInfoTTL        time.Duration
+	nodeStatusTTL      time.Duration
+	containerStatusTTL time.Duration
+	resourcesTTL       time.Duration
+}
+
+func newCachedOperator(o Operator, detector string, options *cacheconfig.Options) Operator {
+	return &cachedOperator{
+		Operator:           o,
+		detector:           detector,
+		targetsTTL:         cache.TTL(options.Targets),
+		nodeInfoTTL:        cache.TTL(options.NodeInfo),
+		nodeStatusTTL:      cache.TTL(options.NodeStatus),
+		containerStatusTTL: cache.TTL(options.ContainerStatus),
+		resourcesTTL:       cache.TTL(options.Resources),
+	}
+}
+
+func (o *cachedOperator) GetMonitorTargets(ctx context.Context) (*MonitorTargets, error) {
+	v, err := targetsCache.Get(ctx, o.detector, o.targetsTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.GetMonitorTargets(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*MonitorTargets), nil
+}
+
+func (o *cachedOperator) GetNodeInfo(ctx context.Context, instance string) ([]NodeInfo, error) {
+	v, err := nodeInfoCache.Get(ctx, o.detector+"|"+instance, o.nodeInfoTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.GetNodeInfo(ctx, instance)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]NodeInfo), nil
+}
+
+func (o *cachedOperator) GetNodeStatus(ctx context.Context, instance string) ([]NodeStatus, error) {
+	v, err := nodeStatusCache.Get(ctx, o.detector+"|"+instance, o.nodeStatusTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.GetNodeStatus(ctx, instance)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]NodeStatus), nil
+}
+
+func (o *cachedOperator) GetNodeContainerStatus(ctx context.Context, instance string) ([]prometheus.Metric, error) {
+	v, err := containerStatusCache.Get(ctx, o.detector+"|"+instance, o.containerStatusTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.GetNodeContainerStatus(ctx, instance)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]prometheus.Metric), nil
+}
+
+func (o *cachedOperator) GetNodeResources(ctx context.Context, instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.getResources(ctx, "node_resources|"+instance, startTime, endTime, step, func(ctx context.Context, startTime, endTime time.Time) ([]prometheus.Metric, error) {
+		return o.Operator.GetNodeResources(ctx, instance, startTime, endTime, step)
+	})
+}
+
+func (o *cachedOperator) GetClusterResource(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.getResources(ctx, "cluster_resources", startTime, endTime, step, func(ctx context.Context, startTime, endTime time.Time) ([]prometheus.Metric, error) {
+		return o.Operator.GetClusterResource(ctx, startTime, endTime, step)
+	})
+}
+
+func (o *cachedOperator) GetClusterContainerStatus(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.getResources(ctx, "cluster_container_status", startTime, endTime, step, func(ctx context.Context, startTime, endTime time.Time) ([]prometheus.Metric, error) {
+		return o.Operator.GetClusterContainerStatus(ctx, startTime, endTime, step)
+	})
+}
+
+// getResources aligns the range to the step and loads it through the cache,
+// endpoint being the endpoint along with its parameters other than the range.
+func (o *cachedOperator) getResources(ctx context.Context, endpoint string, startTime, endTime time.Time, step int64,
+	load func(ctx context.Context, startTime, endTime time.Time) ([]prometheus.Metric, error)) ([]prometheus.Metric, error) {
+	start, end := cache.AlignRange(startTime.Unix(), endTime.Unix(), step)
+	key := fmt.Sprintf("%s|%s|%d|%d|%d", o.detector, endpoint, start, end, step)
+
+	v, err := resourcesCache.Get(ctx, key, o.resourcesTTL, func(ctx context.Context) (interface{}, error) {
+		return load(ctx, time.Unix(start, 0), time.Unix(end, 0))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]prometheus.Metric), nil
+}
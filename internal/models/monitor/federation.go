@@ -0,0 +1,264 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/prometheus"
+	"time"
+)
+
+// Federation reads the monitor data of the clusters. The data of the clusters
+// is merged, every target, node, metric value and topology node labelled with
+// its cluster.
+type Federation struct {
+	clusters  cluster.Clusters
+	operators map[string]Operator
+}
+
+// NewFederation returns a federation of the detectors of clusters.
+func NewFederation(clusters cluster.Clusters, cache *cache.Options) *Federation {
+	f := &Federation{
+		clusters:  clusters,
+		operators: make(map[string]Operator, len(clusters)),
+	}
+	for _, c := range clusters {
+		f.operators[c.Name] = NewOperator(c.Detector, c.Datasource, cache)
+	}
+	return f
+}
+
+// Clusters returns the clusters of the federation.
+func (f *Federation) Clusters() cluster.Clusters {
+	return f.clusters
+}
+
+// Operator returns the operator of the cluster named name.
+func (f *Federation) Operator(name string) (Operator, error) {
+	if _, err := f.clusters.Get(name); err != nil {
+		return nil, err
+	}
+	return f.operators[name], nil
+}
+
+// each calls fn with the operator of every cluster of clusters concurrently.
+func (f *Federation) each(clusters cluster.Clusters, fn func(i int, o Operator) error) error {
+	return clusters.Each(func(i int, c cluster.Cluster) error {
+		o, err := f.Operator(c.Name)
+		if err != nil {
+			return err
+		}
+		return fn(i, o)
+	})
+}
+
+func (f *Federation) GetMonitorTargets(ctx context.Context, clusters cluster.Clusters) (*MonitorTargets, error) {
+	results := make([]*MonitorTargets, len(clusters))
+	err := f.each(clusters, func(i int, o Operator) (err error) {
+		results[i], err = o.GetMonitorTargets(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &MonitorTargets{}
+	for i, targets := range results {
+		if targets == nil {
+			continue
+		}
+		// the targets may be shared with the cache, they are copied
+		for _, target := range targets.Targets {
+			target.Cluster = clusters[i].Name
+			merged.Targets = append(merged.Targets, target)
+		}
+	}
+	return merged, nil
+}
+
+// clustersOf returns the clusters of clusters monitoring instance, all of
+// them when none does so that the detectors answer as usual.
+func (f *Federation) clustersOf(ctx context.Context, clusters cluster.Clusters, instance string) (cluster.Clusters, error) {
+	if instance == "" || len(clusters) < 2 {
+		return clusters, nil
+	}
+
+	targets, err := f.GetMonitorTargets(ctx, clusters)
+	if err != nil {
+		return nil, err
+	}
+
+	var found cluster.Clusters
+	for _, c := range clusters {
+		for _, target := range targets.Targets {
+			if target.Cluster == c.Name && target.Instance == instance {
+				found = append(found, c)
+				break
+			}
+		}
+	}
+	if len(found) == 0 {
+		return clusters, nil
+	}
+	return found, nil
+}
+
+func (f *Federation) GetNodeInfo(ctx context.Context, clusters cluster.Clusters, instance string) ([]NodeInfo, error) {
+	clusters, err := f.clustersOf(ctx, clusters, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]NodeInfo, len(clusters))
+	err = f.each(clusters, func(i int, o Operator) (err error) {
+		results[i], err = o.GetNodeInfo(ctx, instance)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := []NodeInfo{}
+	for i, infos := range results {
+		for _, info := range infos {
+			info.Cluster = clusters[i].Name
+			merged = append(merged, info)
+		}
+	}
+	return merged, nil
+}
+
+func (f *Federation) GetNodeStatus(ctx context.Context, clusters cluster.Clusters, instance string) ([]NodeStatus, error) {
+	clusters, err := f.clustersOf(ctx, clusters, instance)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]NodeStatus, len(clusters))
+	err = f.each(clusters, func(i int, o Operator) (err error) {
+		results[i], err = o.GetNodeStatus(ctx, instance)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := []NodeStatus{}
+	for i, statuses := range results {
+		for _, status := range statuses {
+			status.Cluster = clusters[i].Name
+			merged = append(merged, status)
+		}
+	}
+	return merged, nil
+}
+
+func (f *Federation) GetNodeResources(ctx context.Context, clusters cluster.Clusters, instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	clusters, err := f.clustersOf(ctx, clusters, instance)
+	if err != nil {
+		return nil, err
+	}
+	return f.metrics(clusters, func(o Operator) ([]prometheus.Metric, error) {
+		return o.GetNodeResources(ctx, instance, startTime, endTime, step)
+	})
+}
+
+func (f *Federation) GetNodeContainerStatus(ctx context.Context, clusters cluster.Clusters, instance string) ([]prometheus.Metric, error) {
+	clusters, err := f.clustersOf(ctx, clusters, instance)
+	if err != nil {
+		return nil, err
+	}
+	return f.metrics(clusters, func(o Operator) ([]prometheus.Metric, error) {
+		return o.GetNodeContainerStatus(ctx, instance)
+	})
+}
+
+func (f *Federation) GetClusterResource(ctx context.Context, clusters cluster.Clusters, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return f.metrics(clusters, func(o Operator) ([]prometheus.Metric, error) {
+		return o.GetClusterResource(ctx, startTime, endTime, step)
+	})
+}
+
+func (f *Federation) GetClusterContainerStatus(ctx context.Context, clusters cluster.Clusters, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return f.metrics(clusters, func(o Operator) ([]prometheus.Metric, error) {
+		return o.GetClusterContainerStatus(ctx, startTime, endTime, step)
+	})
+}
+
+// metrics merges the metrics of clusters by name, in the order they first
+// appear.
+func (f *Federation) metrics(clusters cluster.Clusters, get func(o Operator) ([]prometheus.Metric, error)) ([]prometheus.Metric, error) {
+	results := make([][]prometheus.Metric, len(clusters))
+	err := f.each(clusters, func(i int, o Operator) (err error) {
+		results[i], err = get(o)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := []prometheus.Metric{}
+	index := make(map[string]int)
+	for i, metrics := range results {
+		for _, metric := range metrics {
+			values := prometheusmodel.LabelValues(metric.MetricValues, clusters[i].Name)
+
+			j, ok := index[metric.MetricName]
+			if !ok {
+				index[metric.MetricName] = len(merged)
+				metric.MetricValues = values
+				merged = append(merged, metric)
+				continue
+			}
+
+			m := &merged[j]
+			if m.MetricType == "" {
+				m.MetricType = metric.MetricType
+			}
+			if m.Error == "" {
+				m.Error = metric.Error
+			}
+			m.MetricValues = append(m.MetricValues, values...)
+		}
+	}
+	return merged, nil
+}
+
+// GetTopology returns the topology of clusters, the nodes of a cluster
+// following the ones of the clusters before it.
+func (f *Federation) GetTopology(ctx context.Context, clusters cluster.Clusters, instance, pod string, timestamp int64) ([]Entity, error) {
+	results := make([][]Entity, len(clusters))
+	err := f.each(clusters, func(i int, o Operator) (err error) {
+		results[i], err = o.GetTopology(ctx, instance, pod, timestamp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	topology := []Entity{}
+	for i, nodes := range results {
+		for _, node := range nodes {
+			node.Cluster = clusters[i].Name
+			topology = append(topology, node)
+		}
+	}
+	return topology, nil
+}
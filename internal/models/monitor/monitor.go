@@ -17,215 +17,167 @@
 package monitor
 
 import (
-	"cpds/cpds-analyzer/internal/pkg/detector/monitor"
+	"context"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/pkg/detector"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	detectorconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
 	"cpds/cpds-analyzer/pkg/prometheus"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
+	"sort"
 	"strconv"
 	"time"
-
-	jsoniter "github.com/json-iterator/go"
 )
 
 type Operator interface {
-	GetMonitorTargets() (*MonitorTargets, error)
+	GetMonitorTargets(ctx context.Context) (*MonitorTargets, error)
 
-	GetNodeInfo(instance string) ([]NodeInfo, error)
+	GetNodeInfo(ctx context.Context, instance string) ([]NodeInfo, error)
 
-	GetNodeStatus(instance string) ([]NodeStatus, error)
+	GetNodeStatus(ctx context.Context, instance string) ([]NodeStatus, error)
 
-	GetNodeResources(instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
+	GetNodeResources(ctx context.Context, instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
 
-	GetNodeContainerStatus(instance string) ([]prometheus.Metric, error)
+	GetNodeContainerStatus(ctx context.Context, instance string) ([]prometheus.Metric, error)
 
-	GetClusterResource(startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
+	GetClusterResource(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
 
-	GetClusterContainerStatus(startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
-}
+	GetClusterContainerStatus(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error)
 
-type operator struct {
-	detectorConfig *detectorConfig
+	GetTopology(ctx context.Context, instance, pod string, timestamp int64) ([]Entity, error)
 }
 
-type detectorConfig struct {
-	host string
-	port int
+type operator struct {
+	detector   detector.Client
+	prometheus prometheusmodel.Operator
 }
 
-func NewOperator(detectorHost string, detectorPort int) Operator {
-	return &operator{
-		detectorConfig: &detectorConfig{
-			host: detectorHost,
-			port: detectorPort,
-		},
+// NewOperator returns an operator reading the monitor data from the detector.
+// The queries run by the analyzer itself go to the datasource of the options.
+// Responses are cached when the cache is enabled.
+func NewOperator(detectorOptions *detectorconfig.Options, datasource *datasource.Options, cache *cache.Options) Operator {
+	o := &operator{
+		detector:   detector.NewClient(detectorOptions),
+		prometheus: prometheusmodel.NewOperator(detectorOptions, datasource, cache),
 	}
-}
 
-func (o *operator) GetMonitorTargets() (*MonitorTargets, error) {
-	url := fmt.Sprintf("http://%s:%d/api/v1/monitor/targets", o.detectorConfig.host, o.detectorConfig.port)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var response map[string]interface{}
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-
-	if response["status"] != float64(200) {
-		return nil, errors.New("cannot get monitor data from detector")
+	if cache == nil || !cache.Enabled {
+		return o
 	}
+	return newCachedOperator(o, detector.Address(detectorOptions), cache)
+}
 
-	var mt MonitorTargets
-	dataBytes, err := jsoniter.Marshal(response["data"])
-	if err != nil {
-		return nil, err
-	}
-	if err := json.Unmarshal(dataBytes, &mt); err != nil {
-		return nil, err
-	}
+func (o *operator) GetMonitorTargets(ctx context.Context) (*MonitorTargets, error) {
+	return o.detector.GetMonitorTargets(ctx)
+}
 
-	return &mt, nil
+func (o *operator) GetNodeInfo(ctx context.Context, instance string) ([]NodeInfo, error) {
+	return o.detector.GetNodeInfo(ctx, instance)
 }
 
-func (o *operator) GetNodeInfo(instance string) ([]NodeInfo, error) {
-	var url string
-	if instance == "" {
-		url = fmt.Sprintf("http://%s:%d/api/v1/monitor/node_info", o.detectorConfig.host, o.detectorConfig.port)
-	} else {
-		url = fmt.Sprintf("http://%s:%d/api/v1/monitor/node_info?instance=%s", o.detectorConfig.host, o.detectorConfig.port, instance)
-	}
+func (o *operator) GetNodeStatus(ctx context.Context, instance string) ([]NodeStatus, error) {
+	return o.detector.GetNodeStatus(ctx, instance)
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func (o *operator) GetNodeResources(ctx context.Context, instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.detector.GetNodeResources(ctx, instance, newRangeRequest(startTime, endTime, step))
+}
 
-	var response map[string]interface{}
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-	if response["status"] != float64(200) {
-		return nil, errors.New("cannot get monitor data from detector")
-	}
+func (o *operator) GetNodeContainerStatus(ctx context.Context, instance string) ([]prometheus.Metric, error) {
+	return o.detector.GetNodeContainerStatus(ctx, instance)
+}
 
-	var n []NodeInfo
-	for _, data := range response["data"].([]interface{}) {
-		var ni NodeInfo
-		dataBytes, err := jsoniter.Marshal(data)
-		if err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(dataBytes, &ni); err != nil {
-			return nil, err
-		}
-		n = append(n, ni)
-	}
+func (o *operator) GetClusterResource(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.detector.GetClusterResources(ctx, newRangeRequest(startTime, endTime, step))
+}
 
-	return n, nil
+func (o *operator) GetClusterContainerStatus(ctx context.Context, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
+	return o.detector.GetClusterContainerStatus(ctx, newRangeRequest(startTime, endTime, step))
 }
 
-func (o *operator) GetNodeStatus(instance string) ([]NodeStatus, error) {
-	var url string
-	if instance == "" {
-		url = fmt.Sprintf("http://%s:%d/api/v1/monitor/node_status", o.detectorConfig.host, o.detectorConfig.port)
-	} else {
-		url = fmt.Sprintf("http://%s:%d/api/v1/monitor/node_status?instance=%s", o.detectorConfig.host, o.detectorConfig.port, instance)
-	}
+func newRangeRequest(startTime, endTime time.Time, step int64) detector.RangeRequest {
+	return detector.RangeRequest{StartTime: startTime.Unix(), EndTime: endTime.Unix(), Step: step}
+}
 
-	resp, err := http.Get(url)
+// topologyQuery selects the pods and containers of the cpds metrics, a series
+// with a pod label and no container label being a pod. %s are the matchers
+// scoping the query.
+const topologyQuery = `count by (instance, pod, container) ` +
+	`({__name__=~"cpds_(pod|container)_.+", pod!="", %[1]s} or {__name__=~"cpds_container_.+", container!="", %[1]s})`
+
+// GetTopology returns the nodes running at timestamp with their pods and
+// containers, read from the instance, pod and container labels of the cpds
+// metrics. The nodes are limited to instance, or to the nodes running pod
+// when instance is empty.
+func (o *operator) GetTopology(ctx context.Context, instance, pod string, timestamp int64) ([]Entity, error) {
+	var matcher string
+	switch {
+	case instance != "":
+		matcher = "instance=" + strconv.Quote(instance)
+	case pod != "":
+		matcher = "pod=" + strconv.Quote(pod)
+	default:
+		matcher = `instance!=""`
+	}
+
+	data, err := o.prometheus.Query(ctx, fmt.Sprintf(topologyQuery, matcher), timestamp)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	var response map[string]interface{}
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-	if response["status"] != float64(200) {
-		return nil, errors.New("cannot get monitor data from detector")
-	}
-
-	var n []NodeStatus
-	for _, data := range response["data"].([]interface{}) {
-		var ns NodeStatus
-		dataBytes, err := jsoniter.Marshal(data)
-		if err != nil {
-			return nil, err
-		}
-		if err := json.Unmarshal(dataBytes, &ns); err != nil {
-			return nil, err
+	type podKey struct{ node, pod string }
+	nodes := make(map[string]*Entity)
+	pods := make(map[podKey]*Entity)
+	for _, v := range data.MetricValues {
+		nodeName, podName, containerName := v.Metadata["instance"], v.Metadata["pod"], v.Metadata["container"]
+		if nodeName == "" {
+			continue
 		}
-		n = append(n, ns)
-	}
 
-	return n, nil
-}
+		node, ok := nodes[nodeName]
+		if !ok {
+			node = &Entity{Kind: EntityNode, Name: nodeName}
+			nodes[nodeName] = node
+		}
 
-func (o *operator) GetNodeResources(instance string, startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
-	url := fmt.Sprintf(
-		"http://%s:%d/api/v1/monitor/node_resources?instance=%s&start_time=%s&end_time=%s&step=%d",
-		o.detectorConfig.host,
-		o.detectorConfig.port,
-		instance,
-		strconv.FormatInt(startTime.Unix(), 10),
-		strconv.FormatInt(endTime.Unix(), 10),
-		step,
-	)
-	metrics, err := monitor.GetMonitorDataFromDetector(url)
-	if err != nil {
-		return nil, err
+		parent := node
+		if podName != "" {
+			key := podKey{nodeName, podName}
+			if parent, ok = pods[key]; !ok {
+				parent = &Entity{Kind: EntityPod, Name: podName}
+				pods[key] = parent
+			}
+		}
+		if containerName != "" {
+			parent.Children = append(parent.Children, Entity{Kind: EntityContainer, Name: containerName})
+		}
 	}
 
-	return metrics, nil
-}
-
-func (o *operator) GetNodeContainerStatus(instance string) ([]prometheus.Metric, error) {
-	url := fmt.Sprintf("http://%s:%d/api/v1/monitor/node_container_status?instance=%s", o.detectorConfig.host, o.detectorConfig.port, instance)
-	metrics, err := monitor.GetMonitorDataFromDetector(url)
-	if err != nil {
-		return nil, err
+	// pods are attached once complete, children are copied
+	for key, p := range pods {
+		node := nodes[key.node]
+		node.Children = append(node.Children, *p)
 	}
 
-	return metrics, nil
-}
-
-func (o *operator) GetClusterResource(startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
-	url := fmt.Sprintf(
-		"http://%s:%d/api/v1/monitor/cluster_resources?start_time=%s&end_time=%s&step=%d",
-		o.detectorConfig.host,
-		o.detectorConfig.port,
-		strconv.FormatInt(startTime.Unix(), 10),
-		strconv.FormatInt(endTime.Unix(), 10),
-		step,
-	)
-	metrics, err := monitor.GetMonitorDataFromDetector(url)
-	if err != nil {
-		return nil, err
+	topology := make([]Entity, 0, len(nodes))
+	for _, node := range nodes {
+		topology = append(topology, *node)
 	}
-
-	return metrics, nil
+	sortEntities(topology)
+	return topology, nil
 }
 
-func (o *operator) GetClusterContainerStatus(startTime time.Time, endTime time.Time, step int64) ([]prometheus.Metric, error) {
-	url := fmt.Sprintf(
-		"http://%s:%d/api/v1/monitor/cluster_container_status?start_time=%s&end_time=%s&step=%d",
-		o.detectorConfig.host,
-		o.detectorConfig.port,
-		strconv.FormatInt(startTime.Unix(), 10),
-		strconv.FormatInt(endTime.Unix(), 10),
-		step,
-	)
-	metrics, err := monitor.GetMonitorDataFromDetector(url)
-	if err != nil {
-		return nil, err
+// sortEntities sorts entities and their children, pods before containers
+// and by name.
+func sortEntities(entities []Entity) {
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].Kind != entities[j].Kind {
+			return entities[i].Kind == EntityPod
+		}
+		return entities[i].Name < entities[j].Name
+	})
+	for i := range entities {
+		sortEntities(entities[i].Children)
 	}
-
-	return metrics, nil
 }
@@ -16,43 +16,30 @@
 
 package monitor
 
-type MonitorTargets struct {
-	Targets []struct {
-		Instance string `json:"instance"`
-		Status   string `json:"status"`
-	} `json:"targets"`
-}
+import "cpds/cpds-analyzer/internal/pkg/detector"
 
-type NodeInfo struct {
-	Instance      string `json:"instance"`
-	Arch          string `json:"arch"`
-	KernelVersion string `json:"kernal_version"`
-	OSVersion     string `json:"os_version"`
-}
+const (
+	EntityNode      = "node"
+	EntityPod       = "pod"
+	EntityContainer = "container"
+)
 
-type NodeStatus struct {
-	Instance  string `json:"instance"`
-	Container struct {
-		Running int `json:"running"`
-		Total   int `json:"total"`
-	} `json:"container"`
-	Cpu struct {
-		Usage     float64 `json:"usage"`
-		UsedCore  float64 `json:"used_core"`
-		TotalCore float64 `json:"total_core"`
-		NumberCores float64 `json:"number_cores"`
-	} `json:"cpu"`
-	Memory struct {
-		Usage      float64 `json:"usage"`
-		UsedBytes  float64 `json:"used_bytes"`
-		TotalBytes float64 `json:"total_bytes"`
-	} `json:"memory"`
-	Disk struct {
-		Usage      float64 `json:"usage"`
-		UsedBytes  float64 `json:"used_bytes"`
-		TotalBytes float64 `json:"total_bytes"`
-	} `json:"disk"`
+// Entity is a node, a pod or a container, with the pods and containers it
+// runs as children. Cluster is set on the nodes of a federation.
+type Entity struct {
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name"`
+	Cluster  string   `json:"cluster,omitempty"`
+	Children []Entity `json:"children,omitempty"`
 }
+
+// The monitor data is the one of the detector api.
+type (
+	MonitorTargets = detector.MonitorTargets
+	NodeInfo       = detector.NodeInfo
+	NodeStatus     = detector.NodeStatus
+)
+
 type NodeResource struct {
 }
 
@@ -0,0 +1,76 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/pkg/cache"
+	cacheconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/prometheus"
+	"fmt"
+	"time"
+)
+
+// the caches are shared by every operator, their keys start with the
+// datasource
+var (
+	queryCache      = cache.New("prometheus_query")
+	queryRangeCache = cache.New("prometheus_query_range")
+)
+
+// cachedOperator caches the responses of the datasource.
+type cachedOperator struct {
+	Operator
+	source string
+
+	queryTTL      time.Duration
+	queryRangeTTL time.Duration
+}
+
+func newCachedOperator(o Operator, source string, options *cacheconfig.Options) Operator {
+	return &cachedOperator{
+		Operator:      o,
+		source:        source,
+		queryTTL:      cache.TTL(options.Query),
+		queryRangeTTL: cache.TTL(options.QueryRange),
+	}
+}
+
+func (o *cachedOperator) Query(ctx context.Context, expr string, timestamp int64) (*prometheus.MetricData, error) {
+	key := fmt.Sprintf("%s|%d|%s", o.source, timestamp, expr)
+	v, err := queryCache.Get(ctx, key, o.queryTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.Query(ctx, expr, timestamp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*prometheus.MetricData), nil
+}
+
+// QueryRange aligns the range to the step, so that the same window queried
+// a few seconds apart is read from the cache.
+func (o *cachedOperator) QueryRange(ctx context.Context, expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error) {
+	startTime, endTime = cache.AlignRange(startTime, endTime, step)
+	key := fmt.Sprintf("%s|%d|%d|%d|%s", o.source, startTime, endTime, step, expr)
+	v, err := queryRangeCache.Get(ctx, key, o.queryRangeTTL, func(ctx context.Context) (interface{}, error) {
+		return o.Operator.QueryRange(ctx, expr, startTime, endTime, step)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*prometheus.MetricData), nil
+}
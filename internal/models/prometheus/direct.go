@@ -0,0 +1,81 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	"cpds/cpds-analyzer/pkg/prometheus"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"errors"
+	"time"
+)
+
+// directOperator queries a Prometheus compatible api without going through
+// the detector. Queries are bounded by ctx and by the timeout of the
+// datasource.
+type directOperator struct {
+	client prometheus.Client
+	// err is the error creating the client, returned by every query
+	err error
+}
+
+func newDirectOperator(options *datasource.Options) Operator {
+	timeout, err := timeutil.ParseDuration(options.Timeout)
+	if err != nil {
+		return &directOperator{err: err}
+	}
+
+	client, err := prometheus.NewClient(&prometheus.ClientOptions{
+		URL:                options.URL,
+		Username:           options.Username,
+		Password:           options.Password,
+		BearerToken:        options.BearerToken,
+		BearerTokenFile:    options.BearerTokenFile,
+		Timeout:            timeout,
+		CAFile:             options.TLS.CAFile,
+		CertFile:           options.TLS.CertFile,
+		KeyFile:            options.TLS.KeyFile,
+		ServerName:         options.TLS.ServerName,
+		InsecureSkipVerify: options.TLS.InsecureSkipVerify,
+	})
+	return &directOperator{client: client, err: err}
+}
+
+func (o *directOperator) Query(ctx context.Context, expr string, timestamp int64) (*prometheus.MetricData, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	metric := o.client.GetSingleMetric(ctx, expr, time.Unix(timestamp, 0))
+	if metric.Error != "" {
+		return nil, errors.New(metric.Error)
+	}
+	return &metric.MetricData, nil
+}
+
+func (o *directOperator) QueryRange(ctx context.Context, expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+
+	metric := o.client.GetSingleMetricOverTime(ctx, expr, time.Unix(startTime, 0), time.Unix(endTime, 0), time.Duration(step)*time.Second)
+	if metric.Error != "" {
+		return nil, errors.New(metric.Error)
+	}
+	return &metric.MetricData, nil
+}
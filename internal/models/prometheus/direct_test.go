@@ -0,0 +1,128 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectOperator(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		options    datasource.Options
+		rangeQuery bool
+		body       string
+		wantAuth   string
+		wantErr    bool
+		wantValues int
+	}{
+		{
+			name:       "instant query with bearer token",
+			options:    datasource.Options{BearerToken: "token"},
+			body:       `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"instance":"node1"},"value":[100,"1"]},{"metric":{"instance":"node2"},"value":[100,"0"]}]}}`,
+			wantAuth:   "Bearer token",
+			wantValues: 2,
+		},
+		{
+			name:       "range query with basic auth",
+			options:    datasource.Options{Username: "cpds", Password: "secret"},
+			rangeQuery: true,
+			body:       `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"instance":"node1"},"values":[[100,"1"],[115,"0"]]}]}}`,
+			wantAuth:   "Basic Y3BkczpzZWNyZXQ=",
+			wantValues: 1,
+		},
+		{
+			name:       "bearer token file",
+			options:    datasource.Options{BearerTokenFile: tokenFile},
+			body:       `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			wantAuth:   "Bearer file-token",
+			wantValues: 0,
+		},
+		{
+			name:    "query rejected",
+			body:    `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid timeout",
+			options: datasource.Options{Timeout: "soon"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auth, query string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth, query = r.Header.Get("Authorization"), r.FormValue("query")
+				if tt.rangeQuery != (r.URL.Path == "/api/v1/query_range") {
+					t.Errorf("unexpected request %s", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				if tt.wantErr {
+					w.WriteHeader(http.StatusBadRequest)
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			options := tt.options
+			options.Type, options.URL = datasource.TypePrometheus, server.URL
+			if options.Timeout == "" {
+				options.Timeout = "5s"
+			}
+			o := newDirectOperator(&options)
+
+			var values int
+			var err error
+			if tt.rangeQuery {
+				data, queryErr := o.QueryRange(context.Background(), "up", 100, 200, 15)
+				if err = queryErr; err == nil {
+					values = len(data.MetricValues)
+				}
+			} else {
+				data, queryErr := o.Query(context.Background(), "up", 100)
+				if err = queryErr; err == nil {
+					values = len(data.MetricValues)
+				}
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if query != "up" || auth != tt.wantAuth {
+				t.Errorf("query = %q with authorization %q, want %q", query, auth, tt.wantAuth)
+			}
+			if values != tt.wantValues {
+				t.Errorf("values = %d, want %d", values, tt.wantValues)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/prometheus"
+)
+
+// ClusterLabel is the label of the values of a federation naming their
+// cluster. It replaces a label of the same name set by the datasource.
+const ClusterLabel = "cluster"
+
+// Federation queries the datasources of the clusters.
+type Federation struct {
+	clusters  cluster.Clusters
+	operators map[string]Operator
+}
+
+// NewFederation returns a federation of the datasources of clusters.
+func NewFederation(clusters cluster.Clusters, cache *cache.Options) *Federation {
+	f := &Federation{
+		clusters:  clusters,
+		operators: make(map[string]Operator, len(clusters)),
+	}
+	for _, c := range clusters {
+		f.operators[c.Name] = NewOperator(c.Detector, c.Datasource, cache)
+	}
+	return f
+}
+
+// Clusters returns the clusters of the federation.
+func (f *Federation) Clusters() cluster.Clusters {
+	return f.clusters
+}
+
+// Operator returns the operator of the cluster named name.
+func (f *Federation) Operator(name string) (Operator, error) {
+	if _, err := f.clusters.Get(name); err != nil {
+		return nil, err
+	}
+	return f.operators[name], nil
+}
+
+// Query runs expr on clusters and merges the values, labelled with their
+// cluster.
+func (f *Federation) Query(ctx context.Context, clusters cluster.Clusters, expr string, timestamp int64) (*prometheus.MetricData, error) {
+	return f.fanOut(clusters, func(o Operator) (*prometheus.MetricData, error) {
+		return o.Query(ctx, expr, timestamp)
+	})
+}
+
+// QueryRange runs expr over the range on clusters and merges the values,
+// labelled with their cluster.
+func (f *Federation) QueryRange(ctx context.Context, clusters cluster.Clusters, expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error) {
+	return f.fanOut(clusters, func(o Operator) (*prometheus.MetricData, error) {
+		return o.QueryRange(ctx, expr, startTime, endTime, step)
+	})
+}
+
+func (f *Federation) fanOut(clusters cluster.Clusters, query func(o Operator) (*prometheus.MetricData, error)) (*prometheus.MetricData, error) {
+	results := make([]*prometheus.MetricData, len(clusters))
+	err := clusters.Each(func(i int, c cluster.Cluster) error {
+		o, err := f.Operator(c.Name)
+		if err != nil {
+			return err
+		}
+		results[i], err = query(o)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &prometheus.MetricData{MetricValues: prometheus.MetricValues{}}
+	for i, data := range results {
+		if data == nil {
+			continue
+		}
+		if merged.MetricType == "" {
+			merged.MetricType = data.MetricType
+		}
+		merged.MetricValues = append(merged.MetricValues, LabelValues(data.MetricValues, clusters[i].Name)...)
+	}
+	return merged, nil
+}
+
+// LabelValues returns a copy of values labelled with their cluster, values
+// may be shared with a cache.
+func LabelValues(values prometheus.MetricValues, cluster string) prometheus.MetricValues {
+	labelled := make(prometheus.MetricValues, len(values))
+	for i, v := range values {
+		metadata := make(map[string]string, len(v.Metadata)+1)
+		for name, value := range v.Metadata {
+			metadata[name] = value
+		}
+		metadata[ClusterLabel] = cluster
+
+		v.Metadata = metadata
+		labelled[i] = v
+	}
+	return labelled
+}
@@ -17,100 +17,51 @@
 package prometheus
 
 import (
+	"context"
+	"cpds/cpds-analyzer/internal/pkg/detector"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	detectorconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
 	"cpds/cpds-analyzer/pkg/prometheus"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"net/http"
-
-	jsoniter "github.com/json-iterator/go"
 )
 
 type Operator interface {
-	Query(expr string, timestamp int64) (*prometheus.MetricData, error)
+	Query(ctx context.Context, expr string, timestamp int64) (*prometheus.MetricData, error)
 
-	QueryRange(expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error)
+	QueryRange(ctx context.Context, expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error)
 }
 
 type operator struct {
-	detectorConfig *detectorConfig
-}
-
-type detectorConfig struct {
-	host string
-	port int
-}
-
-func NewOperator(detectorHost string, detectorPort int) Operator {
-	return &operator{
-		detectorConfig: &detectorConfig{
-			host: detectorHost,
-			port: detectorPort,
-		},
-	}
+	detector detector.Client
 }
 
-func (o operator) Query(expr string, timestamp int64) (*prometheus.MetricData, error) {
-	url := fmt.Sprintf("http://%s:%d/api/v1/prometheus/query?query=%s&time=%d", o.detectorConfig.host, o.detectorConfig.port, expr, timestamp)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
+// NewOperator returns an operator querying the datasource of the options,
+// the detector unless it is of the prometheus type. Responses are cached
+// when the cache is enabled.
+func NewOperator(detectorOptions *detectorconfig.Options, options *datasource.Options, cache *cache.Options) Operator {
+	var o Operator
+	var source string
+	if options != nil && options.Type == datasource.TypePrometheus {
+		o = newDirectOperator(options)
+		source = options.URL
+	} else {
+		o = &operator{detector: detector.NewClient(detectorOptions)}
+		source = detector.Address(detectorOptions)
 	}
-	defer resp.Body.Close()
 
-	var response map[string]interface{}
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-
-	if response["status"] != float64(200) {
-		return nil, errors.New("cannot get data from detector")
-	}
-
-	var m prometheus.MetricData
-	dataBytes, err := jsoniter.Marshal(response["data"])
-	if err != nil {
-		return nil, err
-	}
-	if err := json.Unmarshal(dataBytes, &m); err != nil {
-		return nil, err
+	if cache == nil || !cache.Enabled {
+		return o
 	}
-
-	return &m, nil
+	return newCachedOperator(o, source, cache)
 }
 
-func (o operator) QueryRange(expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error) {
-	url := fmt.Sprintf("http://%s:%d/api/v1/prometheus/query_range?query=%s&start_time=%d&end_time=%d&step=%d",
-		o.detectorConfig.host,
-		o.detectorConfig.port,
-		expr,
-		startTime,
-		endTime,
-		step,
-	)
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var response map[string]interface{}
-	if err := jsoniter.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-
-	if response["status"] != float64(200) {
-		return nil, errors.New("cannot get data from detector")
-	}
-
-	var m prometheus.MetricData
-	dataBytes, err := jsoniter.Marshal(response["data"])
-	if err != nil {
-		return nil, err
-	}
-	if err := json.Unmarshal(dataBytes, &m); err != nil {
-		return nil, err
-	}
+func (o *operator) Query(ctx context.Context, expr string, timestamp int64) (*prometheus.MetricData, error) {
+	return o.detector.Query(ctx, detector.QueryRequest{Query: expr, Time: timestamp})
+}
 
-	return &m, nil
+func (o *operator) QueryRange(ctx context.Context, expr string, startTime, endTime int64, step int64) (*prometheus.MetricData, error) {
+	return o.detector.QueryRange(ctx, detector.QueryRangeRequest{
+		Query:        expr,
+		RangeRequest: detector.RangeRequest{StartTime: startTime, EndTime: endTime, Step: step},
+	})
 }
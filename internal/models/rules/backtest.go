@@ -0,0 +1,104 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"cpds/cpds-analyzer/pkg/prometheus"
+	"math"
+)
+
+var conditionOperators = map[string]func(value, threshold float64) bool{
+	">":  func(value, threshold float64) bool { return value > threshold },
+	">=": func(value, threshold float64) bool { return value >= threshold },
+	"<":  func(value, threshold float64) bool { return value < threshold },
+	"<=": func(value, threshold float64) bool { return value <= threshold },
+	"==": func(value, threshold float64) bool { return value == threshold },
+	"!=": func(value, threshold float64) bool { return value != threshold },
+}
+
+// MatchCondition reports whether value satisfies the condition described by
+// conditionType and threshold. An empty or unknown condition type never matches.
+func MatchCondition(conditionType string, value, threshold float64) bool {
+	compare, ok := conditionOperators[conditionType]
+	if !ok || math.IsNaN(value) {
+		return false
+	}
+	return compare(value, threshold)
+}
+
+// Classify returns the condition met by value, fault taking precedence over
+// subhealth. An empty string is returned if the value is healthy.
+func (r *Rule) Classify(value float64) string {
+	if MatchCondition(r.FaultConditionType, value, r.FaultThresholds) {
+		return ConditionFault
+	}
+	if MatchCondition(r.SubhealthConditionType, value, r.SubhealthThresholds) {
+		return ConditionSubhealth
+	}
+	return ""
+}
+
+// EvaluateSeries walks the points of a single series and returns the intervals
+// during which the rule would have reported subhealth or fault. A condition
+// has to hold for at least hold seconds before an interval is reported, and
+// a gap larger than step between two points breaks the interval.
+func EvaluateSeries(rule *Rule, points []prometheus.Point, step, hold int64) []BacktestInterval {
+	intervals := make([]BacktestInterval, 0)
+
+	var status string
+	var start, last float64
+	flush := func() {
+		if status == "" || int64(last-start) < hold {
+			return
+		}
+		intervals = append(intervals, BacktestInterval{
+			Status:    status,
+			StartTime: int64(start),
+			FireTime:  int64(start) + hold,
+			EndTime:   int64(last),
+		})
+	}
+
+	for _, point := range points {
+		s := rule.Classify(point.Value())
+		if s != status || (status != "" && int64(point.Timestamp()-last) > step) {
+			flush()
+			status = s
+			start = point.Timestamp()
+		}
+		last = point.Timestamp()
+	}
+	flush()
+
+	return intervals
+}
+
+// MarkSeries returns the points of a series meeting a condition of the rule,
+// regardless of how long the condition held.
+func MarkSeries(rule *Rule, points []prometheus.Point) []ConditionMark {
+	marks := make([]ConditionMark, 0)
+	for _, point := range points {
+		if status := rule.Classify(point.Value()); status != "" {
+			marks = append(marks, ConditionMark{
+				Time:   int64(point.Timestamp()),
+				Value:  point.Value(),
+				Status: status,
+			})
+		}
+	}
+	return marks
+}
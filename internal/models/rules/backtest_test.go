@@ -0,0 +1,82 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"cpds/cpds-analyzer/pkg/prometheus"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateSeries(t *testing.T) {
+	rule := &Rule{
+		SubhealthConditionType: ">",
+		SubhealthThresholds:    0.7,
+		FaultConditionType:     ">",
+		FaultThresholds:        0.9,
+	}
+
+	points := []prometheus.Point{
+		{0, 0.1},
+		{10, 0.8},
+		{20, 0.8},
+		{30, 0.8}, // subhealth held for 20s
+		{40, 0.95},
+		{50, 0.1}, // fault held for 0s
+		{60, 0.8},
+		{70, 0.8},
+		{100, 0.8}, // gap breaks the interval
+	}
+
+	tests := []struct {
+		name string
+		hold int64
+		want []BacktestInterval
+	}{
+		{
+			name: "no hold time",
+			hold: 0,
+			want: []BacktestInterval{
+				{Status: ConditionSubhealth, StartTime: 10, FireTime: 10, EndTime: 30},
+				{Status: ConditionFault, StartTime: 40, FireTime: 40, EndTime: 40},
+				{Status: ConditionSubhealth, StartTime: 60, FireTime: 60, EndTime: 70},
+				{Status: ConditionSubhealth, StartTime: 100, FireTime: 100, EndTime: 100},
+			},
+		},
+		{
+			name: "hold time drops short intervals",
+			hold: 20,
+			want: []BacktestInterval{
+				{Status: ConditionSubhealth, StartTime: 10, FireTime: 30, EndTime: 30},
+			},
+		},
+		{
+			name: "hold time longer than any interval",
+			hold: 60,
+			want: []BacktestInterval{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EvaluateSeries(rule, points, 10, tt.hold)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateSeries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
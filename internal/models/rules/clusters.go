@@ -0,0 +1,86 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Scan implements sql.Scanner, names are stored as a json array so that the
+// rule queries can match them with JSON_CONTAINS.
+func (n *ClusterNames) Scan(value interface{}) error {
+	return (*RuleNames)(n).Scan(value)
+}
+
+// Value implements driver.Valuer.
+func (n ClusterNames) Value() (driver.Value, error) {
+	return RuleNames(n).Value()
+}
+
+// AssignedTo reports whether the rule is assigned to the cluster named name.
+func (r *Rule) AssignedTo(name string) bool {
+	if len(r.Clusters) == 0 {
+		return true
+	}
+	for _, c := range r.Clusters {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) lintClusters() LintIssues {
+	issues := make(LintIssues, 0)
+
+	seen := make(map[string]bool, len(r.Clusters))
+	for _, name := range r.Clusters {
+		switch {
+		case name == "":
+			issues.add("clusters", LintLevelError, "empty cluster name")
+		case seen[name]:
+			issues.add("clusters", LintLevelError, fmt.Sprintf("duplicate cluster %s", name))
+		}
+		seen[name] = true
+	}
+
+	return issues
+}
+
+// lintClusterNames rejects the clusters of the rule the analyzer does not
+// manage.
+func (o *operator) lintClusterNames(rule *Rule) LintIssues {
+	issues := make(LintIssues, 0)
+	for _, name := range rule.Clusters {
+		if name == "" {
+			continue
+		}
+		if _, err := o.clusters.Get(name); err != nil {
+			issues.add("clusters", LintLevelError, err.Error())
+		}
+	}
+	return issues
+}
+
+// applyClusterFilter narrows query down to the rules assigned to the cluster
+// named name, the rules without clusters being assigned to every cluster.
+func applyClusterFilter(query *gorm.DB, name string) *gorm.DB {
+	return query.Where("(clusters IS NULL OR clusters = '' OR JSON_CONTAINS(clusters, JSON_QUOTE(?)))", name)
+}
@@ -0,0 +1,237 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	stringutil "cpds/cpds-analyzer/pkg/utils/string"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// prometheusRuleGroupName is the group exported rules are written to
+	prometheusRuleGroupName = "cpds"
+
+	// prometheusConditionLabel tells whether an alerting rule is the
+	// subhealth or the fault condition of a rule
+	prometheusConditionLabel = "cpds_condition"
+
+	// prometheusClusterLabel is the cluster an alerting rule is expanded for
+	prometheusClusterLabel = "cpds_cluster"
+)
+
+// MarshalRules encodes rules as a YAML rule file.
+func MarshalRules(rules []Rule) ([]byte, error) {
+	return yaml.Marshal(&RuleFile{Rules: rules})
+}
+
+// MarshalPrometheusRules encodes expanded rules as a Prometheus rule file.
+// The parameter values of a templated rule are added to the alert labels.
+func MarshalPrometheusRules(rules []ExpandedRule) ([]byte, error) {
+	return yaml.Marshal(toPrometheusRuleFile(rules))
+}
+
+// UnmarshalRules decodes rules from a file in the given format.
+func UnmarshalRules(data []byte, format string) ([]Rule, error) {
+	switch format {
+	case FileFormatYAML:
+		var file RuleFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, err
+		}
+		return file.Rules, nil
+	case FileFormatPrometheus:
+		var file prometheusRuleFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, err
+		}
+		return fromPrometheusRuleFile(&file)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func toPrometheusRuleFile(rules []ExpandedRule) *prometheusRuleFile {
+	group := prometheusRuleGroup{
+		Name:  prometheusRuleGroupName,
+		Rules: make([]prometheusAlertRule, 0),
+	}
+
+	for _, rule := range rules {
+		if rule.SubhealthConditionType != "" {
+			group.Rules = append(group.Rules, toPrometheusAlertRule(&rule, ConditionSubhealth, rule.SubhealthConditionType, rule.SubhealthThresholds))
+		}
+		if rule.FaultConditionType != "" {
+			group.Rules = append(group.Rules, toPrometheusAlertRule(&rule, ConditionFault, rule.FaultConditionType, rule.FaultThresholds))
+		}
+	}
+
+	return &prometheusRuleFile{Groups: []prometheusRuleGroup{group}}
+}
+
+func toPrometheusAlertRule(rule *ExpandedRule, condition, conditionType string, threshold float64) prometheusAlertRule {
+	labels := make(map[string]string, len(rule.Labels)+len(rule.Arguments)+3)
+	for name, value := range rule.Labels {
+		labels[name] = value
+	}
+	for name, value := range rule.Arguments {
+		labels[name] = value
+	}
+	labels["severity"] = rule.Severity
+	labels[prometheusConditionLabel] = condition
+	if rule.Cluster != "" {
+		labels[prometheusClusterLabel] = rule.Cluster
+	}
+
+	return prometheusAlertRule{
+		Alert:       rule.Name,
+		Expr:        fmt.Sprintf("(%s) %s %s", rule.Expression, conditionType, strconv.FormatFloat(threshold, 'f', -1, 64)),
+		For:         rule.Duration,
+		Labels:      labels,
+		Annotations: toPrometheusAnnotations(&rule.Rule),
+	}
+}
+
+// toPrometheusAnnotations maps the context of a rule to the annotations
+// conventionally used by alerting rules.
+func toPrometheusAnnotations(rule *Rule) map[string]string {
+	annotations := make(map[string]string)
+	for name, value := range map[string]string{
+		"description": rule.Description,
+		"runbook_url": rule.RunbookURL,
+		"owner_team":  rule.OwnerTeam,
+		"remediation": rule.Remediation,
+	} {
+		if value != "" {
+			annotations[name] = value
+		}
+	}
+	return annotations
+}
+
+// fromPrometheusRuleFile merges the alerting rules sharing a name into a
+// single rule. Every alert has to compare the rule expression with a number.
+func fromPrometheusRuleFile(file *prometheusRuleFile) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	index := make(map[string]int)
+
+	for _, group := range file.Groups {
+		for _, alert := range group.Rules {
+			if alert.Alert == "" {
+				continue // recording rules have no counterpart
+			}
+
+			expr, conditionType, threshold, err := splitAlertExpr(alert.Expr)
+			if err != nil {
+				return nil, fmt.Errorf("alert %s: %s", alert.Alert, err)
+			}
+
+			i, ok := index[alert.Alert]
+			if !ok {
+				duration := alert.For
+				if duration == "" {
+					duration = "0s"
+				}
+				rules = append(rules, Rule{
+					Name:        alert.Alert,
+					Expression:  expr,
+					Labels:      ruleLabelsFromAlert(alert.Labels),
+					Severity:    alert.Labels["severity"],
+					Duration:    duration,
+					Description: alert.Annotations["description"],
+					RunbookURL:  alert.Annotations["runbook_url"],
+					OwnerTeam:   alert.Annotations["owner_team"],
+					Remediation: alert.Annotations["remediation"],
+				})
+				i = len(rules) - 1
+				index[alert.Alert] = i
+			}
+
+			rule := &rules[i]
+			if rule.Expression != expr {
+				return nil, fmt.Errorf("alert %s: subhealth and fault conditions must share the expression", alert.Alert)
+			}
+			if c := alert.Labels[prometheusClusterLabel]; c != "" && !stringutil.IsStringInArray(c, rule.Clusters) {
+				rule.Clusters = append(rule.Clusters, c)
+			}
+
+			switch alert.Labels[prometheusConditionLabel] {
+			case ConditionSubhealth:
+				rule.SubhealthConditionType = conditionType
+				rule.SubhealthThresholds = threshold
+			case ConditionFault, "":
+				rule.FaultConditionType = conditionType
+				rule.FaultThresholds = threshold
+			default:
+				return nil, fmt.Errorf("alert %s: invalid %s label", alert.Alert, prometheusConditionLabel)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// ruleLabelsFromAlert keeps the alert labels that are not derived from the
+// rule fields.
+func ruleLabelsFromAlert(alertLabels map[string]string) RuleLabels {
+	labels := make(RuleLabels)
+	for name, value := range alertLabels {
+		if name == "severity" || name == prometheusConditionLabel || name == prometheusClusterLabel {
+			continue
+		}
+		labels[name] = value
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// splitAlertExpr splits an alerting expression such as "(expr) > 0.85" into
+// the expression, the comparison operator and the threshold.
+func splitAlertExpr(alertExpr string) (string, string, float64, error) {
+	expr, err := parser.ParseExpr(alertExpr)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	binary, ok := expr.(*parser.BinaryExpr)
+	if !ok || !binary.Op.IsComparisonOperator() || binary.ReturnBool {
+		return "", "", 0, errors.New("expression must end with a comparison against a number")
+	}
+
+	threshold, ok := unwrapParenExpr(binary.RHS).(*parser.NumberLiteral)
+	if !ok {
+		return "", "", 0, errors.New("expression must end with a comparison against a number")
+	}
+
+	return unwrapParenExpr(binary.LHS).String(), binary.Op.String(), threshold.Val, nil
+}
+
+func unwrapParenExpr(expr parser.Expr) parser.Expr {
+	for {
+		paren, ok := expr.(*parser.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = paren.Expr
+	}
+}
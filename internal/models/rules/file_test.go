@@ -0,0 +1,218 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAlertExpr(t *testing.T) {
+	tests := []struct {
+		name          string
+		alertExpr     string
+		wantExpr      string
+		wantCondition string
+		wantThreshold float64
+		wantErr       bool
+	}{
+		{
+			name:          "plain",
+			alertExpr:     `cpds_node_lvm_state != 1`,
+			wantExpr:      `cpds_node_lvm_state`,
+			wantCondition: "!=",
+			wantThreshold: 1,
+		},
+		{
+			name:          "parenthesised lhs",
+			alertExpr:     `(cpds_node_memory_usage_bytes / cpds_node_memory_total_bytes) > 0.7`,
+			wantExpr:      `cpds_node_memory_usage_bytes / cpds_node_memory_total_bytes`,
+			wantCondition: ">",
+			wantThreshold: 0.7,
+		},
+		{
+			name:          "nested parentheses",
+			alertExpr:     `((up)) == 0`,
+			wantExpr:      `up`,
+			wantCondition: "==",
+			wantThreshold: 0,
+		},
+		{
+			name:          "parenthesised rhs",
+			alertExpr:     `up{job="node"} <= (0.5)`,
+			wantExpr:      `up{job="node"}`,
+			wantCondition: "<=",
+			wantThreshold: 0.5,
+		},
+		{
+			name:          "lhs comparison",
+			alertExpr:     `(up > 0) >= 1`,
+			wantExpr:      `up > 0`,
+			wantCondition: ">=",
+			wantThreshold: 1,
+		},
+		{
+			name:      "bool comparison",
+			alertExpr: `up > bool 0`,
+			wantErr:   true,
+		},
+		{
+			name:      "vector rhs",
+			alertExpr: `up > node_load1`,
+			wantErr:   true,
+		},
+		{
+			name:      "string rhs",
+			alertExpr: `up > "0"`,
+			wantErr:   true,
+		},
+		{
+			name:      "arithmetic",
+			alertExpr: `up + 1`,
+			wantErr:   true,
+		},
+		{
+			name:      "no comparison",
+			alertExpr: `(up)`,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid",
+			alertExpr: `up >`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, condition, threshold, err := splitAlertExpr(tt.alertExpr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitAlertExpr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if expr != tt.wantExpr || condition != tt.wantCondition || threshold != tt.wantThreshold {
+				t.Errorf("splitAlertExpr() = %s, %s, %v, want %s, %s, %v", expr, condition, threshold, tt.wantExpr, tt.wantCondition, tt.wantThreshold)
+			}
+		})
+	}
+}
+
+func TestPrometheusRulesRoundTrip(t *testing.T) {
+	rules := []Rule{
+		{
+			Name:                   "memory_usage",
+			Expression:             `cpds_node_memory_usage_bytes / cpds_node_memory_total_bytes`,
+			Labels:                 RuleLabels{"team": "node"},
+			SubhealthConditionType: ">",
+			SubhealthThresholds:    0.7,
+			FaultConditionType:     ">",
+			FaultThresholds:        0.9,
+			Severity:               "critical",
+			Duration:               "1m",
+			Description:            "memory usage is high",
+			RunbookURL:             "https://runbooks.example.com/memory",
+		},
+		{
+			Name:               "lvm",
+			Expression:         `cpds_node_lvm_state`,
+			FaultConditionType: "!=",
+			FaultThresholds:    1,
+			Severity:           "warning",
+			Duration:           "0s",
+		},
+	}
+
+	expanded := make([]ExpandedRule, 0, len(rules))
+	for _, rule := range rules {
+		expanded = append(expanded, ExpandedRule{Rule: rule})
+	}
+	data, err := MarshalPrometheusRules(expanded)
+	if err != nil {
+		t.Fatalf("MarshalPrometheusRules() error = %v", err)
+	}
+
+	got, err := UnmarshalRules(data, FileFormatPrometheus)
+	if err != nil {
+		t.Fatalf("UnmarshalRules() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, rules) {
+		t.Errorf("UnmarshalRules() = %+v, want %+v", got, rules)
+	}
+}
+
+func TestPrometheusRulesClusters(t *testing.T) {
+	rule := Rule{
+		Name:               "lvm",
+		Expression:         `cpds_node_lvm_state`,
+		FaultConditionType: "!=",
+		FaultThresholds:    1,
+		Severity:           "warning",
+		Duration:           "1m",
+	}
+	data, err := MarshalPrometheusRules([]ExpandedRule{
+		{Rule: rule, Cluster: "east"},
+		{Rule: rule, Cluster: "west"},
+		{Rule: rule, Cluster: "east"},
+	})
+	if err != nil {
+		t.Fatalf("MarshalPrometheusRules() error = %v", err)
+	}
+
+	got, err := UnmarshalRules(data, FileFormatPrometheus)
+	if err != nil {
+		t.Fatalf("UnmarshalRules() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("UnmarshalRules() = %d rules, want 1", len(got))
+	}
+	if want := (ClusterNames{"east", "west"}); !reflect.DeepEqual(got[0].Clusters, want) {
+		t.Errorf("Clusters = %v, want %v", got[0].Clusters, want)
+	}
+}
+
+func TestRulesRoundTrip(t *testing.T) {
+	enabled := false
+	rules := []Rule{
+		{
+			Name:                   "node_etcd_service",
+			Expression:             `absent(cpds_container_service_etcd_status{instance="{{ .instance }}"} == 1)`,
+			Parameters:             RuleParameters{{Name: "instance", Source: ParameterSourceTargets}},
+			Labels:                 RuleLabels{"component": "etcd"},
+			Inhibits:               RuleNames{"container_breakdown"},
+			Clusters:               ClusterNames{"east"},
+			Enabled:                &enabled,
+			SubhealthConditionType: "==",
+			SubhealthThresholds:    1,
+			Severity:               "critical",
+			Duration:               "1m",
+			OwnerTeam:              "platform",
+			Remediation:            "restart etcd",
+		},
+	}
+
+	data, err := MarshalRules(rules)
+	if err != nil {
+		t.Fatalf("MarshalRules() error = %v", err)
+	}
+
+	got, err := UnmarshalRules(data, FileFormatYAML)
+	if err != nil {
+		t.Fatalf("UnmarshalRules() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, rules) {
+		t.Errorf("UnmarshalRules() = %+v, want %+v", got, rules)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Scan implements sql.Scanner, names are stored as a json array so that the
+// analysis queries can match them with JSON_CONTAINS.
+func (n *RuleNames) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*n = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported rule names type %T", value)
+	}
+
+	if len(data) == 0 {
+		*n = nil
+		return nil
+	}
+	return json.Unmarshal(data, n)
+}
+
+// Value implements driver.Valuer.
+func (n RuleNames) Value() (driver.Value, error) {
+	if len(n) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (r *Rule) lintInhibits() LintIssues {
+	issues := make(LintIssues, 0)
+
+	seen := make(map[string]bool, len(r.Inhibits))
+	for _, name := range r.Inhibits {
+		switch {
+		case !ruleNameRegexp.MatchString(name):
+			issues.add("inhibits", LintLevelError, fmt.Sprintf("invalid rule name %q", name))
+		case name == r.Name:
+			issues.add("inhibits", LintLevelError, "a rule cannot inhibit itself")
+		case seen[name]:
+			issues.add("inhibits", LintLevelError, fmt.Sprintf("duplicate rule %s", name))
+		}
+		seen[name] = true
+	}
+
+	return issues
+}
+
+// lintInhibitionGraph checks the inhibited rules against the stored ones: it
+// warns about unknown rules and rejects cycles, in which rules in fault
+// would hide each other.
+func (o *operator) lintInhibitionGraph(rule *Rule) (LintIssues, error) {
+	issues := make(LintIssues, 0)
+	if len(rule.Inhibits) == 0 {
+		return issues, nil
+	}
+
+	var records []Rule
+	if err := o.db.Select("name", "inhibits").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	graph := make(map[string][]string, len(records)+1)
+	for _, record := range records {
+		graph[record.Name] = record.Inhibits
+	}
+	for _, name := range rule.Inhibits {
+		if _, ok := graph[name]; !ok {
+			issues.add("inhibits", LintLevelWarning, fmt.Sprintf("rule %s does not exist", name))
+		}
+	}
+	graph[rule.Name] = rule.Inhibits
+
+	if cycle := findInhibitionCycle(graph, rule.Name); cycle != nil {
+		issues.add("inhibits", LintLevelError, fmt.Sprintf("inhibition cycle %s", strings.Join(cycle, " -> ")))
+	}
+
+	return issues, nil
+}
+
+// findInhibitionCycle returns the path of a cycle going back to start, or nil.
+func findInhibitionCycle(graph map[string][]string, start string) []string {
+	visited := make(map[string]bool)
+
+	var walk func(path []string) []string
+	walk = func(path []string) []string {
+		for _, next := range graph[path[len(path)-1]] {
+			if next == start {
+				return append(path, next)
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if cycle := walk(append(path, next)); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+
+	return walk([]string{start})
+}
@@ -0,0 +1,193 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var labelNameRegexp = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// Scan implements sql.Scanner, labels are stored as json text.
+func (l *RuleLabels) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported labels type %T", value)
+	}
+
+	if len(data) == 0 {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(data, l)
+}
+
+// Value implements driver.Valuer.
+func (l RuleLabels) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// ValidateLabels checks that label names follow the prometheus label naming.
+func ValidateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// ParseLabelSelector parses a selector such as "group=node,team=infra". A
+// label may only be selected once.
+func ParseLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if strings.TrimSpace(selector) == "" {
+		return labels, nil
+	}
+
+	for _, matcher := range strings.Split(selector, ",") {
+		name, value, ok := strings.Cut(matcher, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label selector %q", matcher)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("label %q is selected more than once", name)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// IsEnabled reports whether the rule is enabled, rules are enabled unless
+// explicitly disabled.
+func (r *Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+func (r *Rule) setDefaults() {
+	if r.Enabled == nil {
+		enabled := true
+		r.Enabled = &enabled
+	}
+}
+
+// apply narrows query down to the rules matched by the filter.
+func (f *RuleFilter) apply(query *gorm.DB) *gorm.DB {
+	if f == nil {
+		return query
+	}
+
+	if f.Name != "" {
+		query = query.Where("name LIKE ?", "%"+f.Name+"%")
+	}
+	if f.Enabled != nil {
+		query = query.Where("enabled = ?", *f.Enabled)
+	}
+	if f.Cluster != "" {
+		query = applyClusterFilter(query, f.Cluster)
+	}
+	return applyLabelSelector(query, f.Labels)
+}
+
+func applyLabelSelector(query *gorm.DB, labels map[string]string) *gorm.DB {
+	for name, value := range labels {
+		// label names are validated, quoting them keeps the json path well formed
+		query = query.Where("JSON_UNQUOTE(JSON_EXTRACT(labels, ?)) = ?", fmt.Sprintf("$.%q", name), value)
+	}
+	return query
+}
+
+func (o *operator) SetRulesEnabled(selector *RuleSelector, enabled bool) ([]string, error) {
+	if selector == nil || (len(selector.IDs) == 0 && len(selector.Labels) == 0) {
+		return nil, errors.New("empty rule selector")
+	}
+
+	changed := make([]string, 0)
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("enabled = ?", !enabled)
+		if len(selector.IDs) != 0 {
+			query = query.Where("id IN ?", selector.IDs)
+		}
+		query = applyLabelSelector(query, selector.Labels)
+
+		var records []Rule
+		if err := query.Find(&records).Error; err != nil {
+			return err
+		}
+
+		for i := range records {
+			rule := &records[i]
+			rule.Enabled = &enabled
+			rule.Revision++
+			rule.UpdateTime = time.Now().Unix()
+			if err := tx.Model(rule).Updates(map[string]interface{}{
+				"enabled":     enabled,
+				"revision":    rule.Revision,
+				"update_time": rule.UpdateTime,
+			}).Error; err != nil {
+				return err
+			}
+
+			if err := RecordRevision(tx, rule, RevisionActionUpdate); err != nil {
+				return err
+			}
+			changed = append(changed, rule.Name)
+		}
+
+		if len(changed) == 0 {
+			return nil
+		}
+		action := "disable"
+		if enabled {
+			action = "enable"
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("%s %d rules", action, len(changed)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
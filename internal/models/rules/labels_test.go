@@ -0,0 +1,109 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector string
+		want     map[string]string
+		wantErr  bool
+	}{
+		{
+			name:     "empty",
+			selector: "",
+			want:     map[string]string{},
+		},
+		{
+			name:     "blank",
+			selector: "  ",
+			want:     map[string]string{},
+		},
+		{
+			name:     "single",
+			selector: "group=node",
+			want:     map[string]string{"group": "node"},
+		},
+		{
+			name:     "several with spaces",
+			selector: "group = node, team=infra",
+			want:     map[string]string{"group": "node", "team": "infra"},
+		},
+		{
+			name:     "empty value",
+			selector: "team=",
+			want:     map[string]string{"team": ""},
+		},
+		{
+			name:     "value with equal sign",
+			selector: "expr=a=b",
+			want:     map[string]string{"expr": "a=b"},
+		},
+		{
+			name:     "missing equal sign",
+			selector: "group",
+			wantErr:  true,
+		},
+		{
+			name:     "empty pair",
+			selector: "group=node,,team=infra",
+			wantErr:  true,
+		},
+		{
+			name:     "trailing comma",
+			selector: "group=node,",
+			wantErr:  true,
+		},
+		{
+			name:     "empty name",
+			selector: "=node",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid name",
+			selector: "owner-team=infra",
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate key",
+			selector: "group=node,group=container",
+			wantErr:  true,
+		},
+		{
+			name:     "duplicate key with spaces",
+			selector: "group=node, group =node",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabelSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLabelSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseLabelSelector() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/severity"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var ruleNameRegexp = regexp.MustCompile("^[A-Za-z0-9_]{1,64}$")
+
+var ownerTeamRegexp = regexp.MustCompile("^[A-Za-z0-9_.-]{1,64}$")
+
+const (
+	maxDescriptionLength = 1024
+	maxRemediationLength = 4096
+	maxRunbookURLLength  = 512
+)
+
+// metricLookback is how far back the metric names of an expression are
+// looked up when linting a rule
+const metricLookback = "1d"
+
+// metricCheckTimeout bounds the metric lookups of a lint, they are skipped
+// with a warning beyond it rather than holding up the save
+const metricCheckTimeout = 3 * time.Second
+
+// Lint runs the checks that need nothing but the rule itself.
+func (r *Rule) Lint() LintIssues {
+	issues := make(LintIssues, 0)
+
+	if !ruleNameRegexp.MatchString(r.Name) {
+		issues.add("name", LintLevelError, "must match [A-Za-z0-9_]{1,64}")
+	}
+
+	if err := r.ValidateParameters(); err != nil {
+		issues.add("parameters", LintLevelError, err.Error())
+	}
+
+	if err := ValidateLabels(r.Labels); err != nil {
+		issues.add("labels", LintLevelError, err.Error())
+	}
+
+	issues = append(issues, r.lintInhibits()...)
+	issues = append(issues, r.lintClusters()...)
+
+	if expr, err := r.parseSample(); err != nil {
+		issues.add("expression", LintLevelError, err.Error())
+	} else {
+		switch expr.Type() {
+		case parser.ValueTypeMatrix:
+			issues.add("expression", LintLevelWarning, "expression returns a range vector, an instant vector is expected")
+		case parser.ValueTypeString:
+			issues.add("expression", LintLevelWarning, "expression returns a string, an instant vector is expected")
+		}
+	}
+
+	issues = append(issues, r.lintConditions()...)
+
+	if r.Severity == "" && r.SeverityID == 0 {
+		issues.add("severity", LintLevelError, "severity is required")
+	}
+
+	if !timeutil.IsValidDuration(r.Duration) {
+		issues.add("duration", LintLevelError, "invalid duration")
+	}
+
+	issues = append(issues, r.lintContext()...)
+
+	return issues
+}
+
+// lintContext checks the fields telling on-call engineers what to do about
+// a result of the rule.
+func (r *Rule) lintContext() LintIssues {
+	issues := make(LintIssues, 0)
+
+	if len(r.Description) > maxDescriptionLength {
+		issues.add("description", LintLevelError, fmt.Sprintf("must not exceed %d characters", maxDescriptionLength))
+	}
+
+	if r.RunbookURL != "" {
+		u, err := url.Parse(r.RunbookURL)
+		switch {
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			issues.add("runbook_url", LintLevelError, "must be an absolute http or https url")
+		case len(r.RunbookURL) > maxRunbookURLLength:
+			issues.add("runbook_url", LintLevelError, fmt.Sprintf("must not exceed %d characters", maxRunbookURLLength))
+		}
+	}
+
+	if r.OwnerTeam != "" && !ownerTeamRegexp.MatchString(r.OwnerTeam) {
+		issues.add("owner_team", LintLevelError, "must match [A-Za-z0-9_.-]{1,64}")
+	}
+
+	if len(r.Remediation) > maxRemediationLength {
+		issues.add("remediation", LintLevelError, fmt.Sprintf("must not exceed %d characters", maxRemediationLength))
+	}
+
+	return issues
+}
+
+// lintConditions checks the operators and thresholds of both conditions, and
+// that the subhealth condition is reached before the fault condition.
+func (r *Rule) lintConditions() LintIssues {
+	issues := make(LintIssues, 0)
+
+	if r.SubhealthConditionType == "" && r.FaultConditionType == "" {
+		issues.add("fault_condition_type", LintLevelError, "at least one of subhealth or fault condition is required")
+		return issues
+	}
+
+	valid := true
+	conditions := []struct {
+		field, conditionType string
+		threshold            float64
+	}{
+		{"subhealth", r.SubhealthConditionType, r.SubhealthThresholds},
+		{"fault", r.FaultConditionType, r.FaultThresholds},
+	}
+	for _, c := range conditions {
+		if math.IsNaN(c.threshold) || math.IsInf(c.threshold, 0) {
+			issues.add(c.field+"_thresholds", LintLevelError, "invalid threshold")
+			valid = false
+		}
+		if c.conditionType == "" {
+			continue
+		}
+		if _, ok := conditionOperators[c.conditionType]; !ok {
+			issues.add(c.field+"_condition_type", LintLevelError, fmt.Sprintf("unknown operator %q", c.conditionType))
+			valid = false
+		}
+	}
+
+	if !valid || r.SubhealthConditionType == "" || r.FaultConditionType == "" {
+		return issues
+	}
+
+	subhealthDirection := conditionDirection(r.SubhealthConditionType)
+	faultDirection := conditionDirection(r.FaultConditionType)
+	switch {
+	case subhealthDirection != faultDirection:
+		issues.add("fault_condition_type", LintLevelError, "subhealth and fault conditions must compare in the same direction")
+	case subhealthDirection > 0 && r.SubhealthThresholds >= r.FaultThresholds:
+		issues.add("subhealth_thresholds", LintLevelError, "must be lower than the fault threshold")
+	case subhealthDirection < 0 && r.SubhealthThresholds <= r.FaultThresholds:
+		issues.add("subhealth_thresholds", LintLevelError, "must be higher than the fault threshold")
+	case subhealthDirection == 0 && r.SubhealthConditionType == r.FaultConditionType && r.SubhealthThresholds == r.FaultThresholds:
+		issues.add("subhealth_thresholds", LintLevelError, "subhealth condition is the same as the fault condition")
+	}
+
+	return issues
+}
+
+// conditionDirection returns 1 for operators matching high values, -1 for
+// operators matching low values and 0 for equality operators.
+func conditionDirection(conditionType string) int {
+	switch conditionType {
+	case ">", ">=":
+		return 1
+	case "<", "<=":
+		return -1
+	default:
+		return 0
+	}
+}
+
+func (r *Rule) parseSample() (parser.Expr, error) {
+	rendered, err := r.RenderSample()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression template: %s", err)
+	}
+	return parser.ParseExpr(rendered)
+}
+
+// LintRule lints the rule, checks its severity, clusters and inhibited rules
+// against the stored ones and warns about the metrics the datasources of its
+// clusters have no samples of.
+func (o *operator) LintRule(ctx context.Context, rule *Rule) LintIssues {
+	issues := rule.Lint()
+
+	if rule.Severity != "" || rule.SeverityID != 0 {
+		if _, err := severity.Resolve(o.db, rule.SeverityID, rule.Severity); err != nil {
+			issues.add("severity", LintLevelError, err.Error())
+		}
+	}
+
+	issues = append(issues, o.lintClusterNames(rule)...)
+
+	graphIssues, err := o.lintInhibitionGraph(rule)
+	if err != nil {
+		issues.add("inhibits", LintLevelWarning, fmt.Sprintf("unable to check inhibited rules: %s", err))
+	}
+	issues = append(issues, graphIssues...)
+
+	expr, err := rule.parseSample()
+	if err != nil {
+		return issues
+	}
+
+	var clusters cluster.Clusters
+	for _, c := range o.clusters {
+		if rule.AssignedTo(c.Name) {
+			clusters = append(clusters, c)
+		}
+	}
+
+	names := metricNames(expr)
+	if len(names) == 0 || len(clusters) == 0 {
+		return issues
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, metricCheckTimeout)
+	defer cancel()
+
+	now := time.Now().Unix()
+	for _, name := range names {
+		// range functions drop the metric name, so every name is queried on its own
+		data, err := o.prometheus.Query(ctx, clusters, fmt.Sprintf("count(count_over_time(%s[%s]))", name, metricLookback), now)
+		if err != nil && ctx.Err() != nil {
+			issues.add("expression", LintLevelWarning, fmt.Sprintf("the remaining metrics were not checked within %s", metricCheckTimeout))
+			break
+		}
+		if err != nil {
+			issues.add("expression", LintLevelWarning, fmt.Sprintf("unable to check metric %s: %s", name, err))
+			continue
+		}
+		if len(data.MetricValues) == 0 {
+			issues.add("expression", LintLevelWarning, fmt.Sprintf("metric %s has no samples in the last %s", name, metricLookback))
+		}
+	}
+
+	return issues
+}
+
+// metricNames returns the sorted metric names selected by expr.
+func metricNames(expr parser.Expr) []string {
+	found := make(map[string]bool)
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		if selector.Name != "" {
+			found[selector.Name] = true
+			return nil
+		}
+		for _, m := range selector.LabelMatchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+				found[m.Value] = true
+			}
+		}
+		return nil
+	})
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *LintIssues) add(field, level, message string) {
+	*l = append(*l, LintIssue{Field: field, Level: level, Message: message})
+}
+
+// HasErrors reports whether any issue is an error rather than a warning.
+func (l LintIssues) HasErrors() bool {
+	for _, issue := range l {
+		if issue.Level == LintLevelError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the issues as an error if any of them is an error, nil otherwise.
+func (l LintIssues) Err() error {
+	if !l.HasErrors() {
+		return nil
+	}
+	return l
+}
+
+// Error joins the error level issues, warnings are left out.
+func (l LintIssues) Error() string {
+	messages := make([]string, 0, len(l))
+	for _, issue := range l {
+		if issue.Level == LintLevelError {
+			messages = append(messages, fmt.Sprintf("%s: %s", issue.Field, issue.Message))
+		}
+	}
+	return strings.Join(messages, "; ")
+}
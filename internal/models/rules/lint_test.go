@@ -0,0 +1,120 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	base := Rule{
+		Name:                   "cpu_usage",
+		Expression:             "cpds_node_cpu_usage",
+		SubhealthConditionType: ">",
+		SubhealthThresholds:    0.7,
+		FaultConditionType:     ">",
+		FaultThresholds:        0.85,
+		Severity:               "critical",
+		Duration:               "1m",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(r *Rule)
+		want   LintIssues
+	}{
+		{
+			name:   "valid",
+			modify: func(r *Rule) {},
+			want:   LintIssues{},
+		},
+		{
+			name:   "unknown operator",
+			modify: func(r *Rule) { r.FaultConditionType = "=>" },
+			want:   LintIssues{{Field: "fault_condition_type", Level: LintLevelError, Message: `unknown operator "=>"`}},
+		},
+		{
+			name:   "unparsable threshold",
+			modify: func(r *Rule) { r.FaultThresholds = math.NaN() },
+			want:   LintIssues{{Field: "fault_thresholds", Level: LintLevelError, Message: "invalid threshold"}},
+		},
+		{
+			name: "unparsable threshold without condition",
+			modify: func(r *Rule) {
+				r.SubhealthConditionType, r.SubhealthThresholds = "", math.NaN()
+			},
+			want: LintIssues{{Field: "subhealth_thresholds", Level: LintLevelError, Message: "invalid threshold"}},
+		},
+		{
+			name:   "subhealth more severe than fault",
+			modify: func(r *Rule) { r.SubhealthThresholds = 0.9 },
+			want:   LintIssues{{Field: "subhealth_thresholds", Level: LintLevelError, Message: "must be lower than the fault threshold"}},
+		},
+		{
+			name: "lower is worse",
+			modify: func(r *Rule) {
+				r.SubhealthConditionType, r.SubhealthThresholds = "<", 0.3
+				r.FaultConditionType, r.FaultThresholds = "<=", 0.1
+			},
+			want: LintIssues{},
+		},
+		{
+			name:   "opposite directions",
+			modify: func(r *Rule) { r.SubhealthConditionType = "<" },
+			want:   LintIssues{{Field: "fault_condition_type", Level: LintLevelError, Message: "subhealth and fault conditions must compare in the same direction"}},
+		},
+		{
+			name:   "relative runbook url",
+			modify: func(r *Rule) { r.RunbookURL = "/runbooks/cpu_usage" },
+			want:   LintIssues{{Field: "runbook_url", Level: LintLevelError, Message: "must be an absolute http or https url"}},
+		},
+		{
+			name:   "range vector",
+			modify: func(r *Rule) { r.Expression = "cpds_node_cpu_usage[1m]" },
+			want:   LintIssues{{Field: "expression", Level: LintLevelWarning, Message: "expression returns a range vector, an instant vector is expected"}},
+		},
+		{
+			name:   "duplicate cluster",
+			modify: func(r *Rule) { r.Clusters = ClusterNames{"east", "west", "east"} },
+			want:   LintIssues{{Field: "clusters", Level: LintLevelError, Message: "duplicate cluster east"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := base
+			tt.modify(&rule)
+			if got := rule.Lint(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignedTo(t *testing.T) {
+	rule := Rule{}
+	if !rule.AssignedTo("east") {
+		t.Error("a rule without clusters is not assigned to every cluster")
+	}
+
+	rule.Clusters = ClusterNames{"east"}
+	if !rule.AssignedTo("east") || rule.AssignedTo("west") {
+		t.Errorf("rule assigned to %v, want only east", rule.Clusters)
+	}
+}
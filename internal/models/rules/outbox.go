@@ -0,0 +1,328 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"cpds/cpds-analyzer/internal/pkg/detector"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	notificationMinBackoff = time.Second
+	notificationMaxBackoff = 5 * time.Minute
+
+	// deliveryLock is the advisory lock held while delivering notifications,
+	// so that a single analyzer replica delivers them
+	deliveryLock = "cpds_rule_notifications"
+)
+
+// enqueueNotification records, in the transaction changing the rules, that
+// the detector of every cluster has to reload them. A cluster has its own
+// notifications, their id is the version of its rule set.
+func (o *operator) enqueueNotification(tx *gorm.DB, reason string) error {
+	return enqueueClusterNotifications(tx, o.clusters.Names(), reason)
+}
+
+func enqueueClusterNotifications(tx *gorm.DB, clusters []string, reason string) error {
+	now := time.Now().Unix()
+	notifications := make([]RuleNotification, 0, len(clusters))
+	for _, name := range clusters {
+		notifications = append(notifications, RuleNotification{
+			Cluster:    name,
+			Reason:     reason,
+			CreateTime: now,
+		})
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return tx.Create(&notifications).Error
+}
+
+// DeliverNotifications sends its rule set to the detector of every cluster
+// with pending notifications. Clusters are delivered independently, a failed
+// delivery is only retried for its cluster once its backoff elapsed. A
+// cluster that never had a notification, such as a new one, gets one.
+// Nothing is done while another replica is delivering.
+func (o *operator) DeliverNotifications(ctx context.Context) error {
+	return o.withDeliveryLock(func() error {
+		return o.clusters.Each(func(_ int, c cluster.Cluster) error {
+			return o.deliver(ctx, c)
+		})
+	})
+}
+
+// withDeliveryLock calls fn while holding the delivery lock, it does nothing
+// if another replica holds it. The lock belongs to the connection it was
+// taken on, which is kept until fn returns.
+func (o *operator) withDeliveryLock(fn func() error) error {
+	return o.db.Connection(func(conn *gorm.DB) error {
+		var acquired sql.NullInt64
+		if err := conn.Raw("SELECT GET_LOCK(?, 0)", deliveryLock).Scan(&acquired).Error; err != nil {
+			return err
+		}
+		if acquired.Int64 != 1 {
+			return nil
+		}
+		defer conn.Exec("SELECT RELEASE_LOCK(?)", deliveryLock)
+
+		return fn()
+	})
+}
+
+// deliver notifies the detector of c once for its pending notifications,
+// they are delivered once it acknowledged them. Only the notifications read
+// are updated: one committed meanwhile, even with a lower id, may change
+// rules the rule set sent missed and is delivered on its own. Of the
+// notifications delivered at once only the latest is kept, it records the
+// revisions of the rule set acknowledged, the history of which tells the
+// revision a result was produced with.
+func (o *operator) deliver(ctx context.Context, c cluster.Cluster) error {
+	var pending []RuleNotification
+	if err := o.db.Where("cluster = ? AND delivered_time = 0", c.Name).Order("id asc").Find(&pending).Error; err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		var count int64
+		if err := o.db.Model(&RuleNotification{}).Where("cluster = ?", c.Name).Count(&count).Error; err != nil || count != 0 {
+			return err
+		}
+		return enqueueClusterNotifications(o.db, []string{c.Name}, "add cluster")
+	}
+
+	now := time.Now()
+	oldest, latest := pending[0], pending[len(pending)-1]
+	if oldest.NextAttemptTime > now.Unix() {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(pending))
+	for _, n := range pending {
+		ids = append(ids, n.ID)
+	}
+
+	var d string
+	rules, skipped, revisions, err := o.ruleSet(ctx, c, latest.ID)
+	if err == nil {
+		d, err = digest(rules)
+	}
+	if err == nil {
+		err = o.detectors[c.Name].RuleUpdated(ctx, rules)
+	}
+	if err != nil {
+		backoff := notificationBackoff(oldest.Attempts + 1)
+		if updateErr := o.db.Model(&RuleNotification{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"attempts":          gorm.Expr("attempts + 1"),
+				"next_attempt_time": now.Add(backoff).Unix(),
+				"last_error":        err.Error(),
+			}).Error; updateErr != nil {
+			return updateErr
+		}
+		return fmt.Errorf("notify detector of rule set version %d: %s, retrying in %s", latest.ID, err, backoff)
+	}
+
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&RuleNotification{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"delivered_time": now.Unix(),
+				"last_error":     "",
+				"digest":         d,
+				"skipped":        skipped,
+				"revisions":      revisions,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ? AND id <> ?", ids, latest.ID).Delete(&RuleNotification{}).Error
+	})
+}
+
+// ruleSet returns the rule set the detector of c evaluates at version: the
+// enabled rules assigned to c, expanded for c, along with the rules that could
+// not be expanded and the revision of every rule sent. Disabled rules are
+// never sent.
+func (o *operator) ruleSet(ctx context.Context, c cluster.Cluster, version uint) (*detector.RuleSet, SkippedRules, RuleSetRevisions, error) {
+	expanded, skipped, err := o.ExpandRules(ctx, cluster.Clusters{c})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	rules := &detector.RuleSet{Version: version, Rules: make([]detector.Rule, 0, len(expanded))}
+	revisions := make(RuleSetRevisions)
+	for _, r := range expanded {
+		revisions[r.ID] = r.Revision
+		rules.Rules = append(rules.Rules, detector.Rule{
+			ID:                     r.ID,
+			Name:                   r.Name,
+			Expression:             r.Expression,
+			SubhealthConditionType: r.SubhealthConditionType,
+			SubhealthThresholds:    r.SubhealthThresholds,
+			FaultConditionType:     r.FaultConditionType,
+			FaultThresholds:        r.FaultThresholds,
+			Severity:               r.Severity,
+			Duration:               r.Duration,
+			Arguments:              r.Arguments,
+		})
+	}
+	return rules, skipped, revisions, nil
+}
+
+// Scan implements sql.Scanner, revisions are stored as json text.
+func (r *RuleSetRevisions) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported revisions type %T", value)
+	}
+
+	if len(data) == 0 {
+		*r = nil
+		return nil
+	}
+	return json.Unmarshal(data, r)
+}
+
+// Value implements driver.Valuer.
+func (r RuleSetRevisions) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// digest identifies the rules of a rule set, whatever its version.
+func digest(rules *detector.RuleSet) (string, error) {
+	data, err := json.Marshal(rules.Rules)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RefreshRuleSets queues a notification for every cluster whose rule set
+// changed without a rule changing, such as when the monitor targets the
+// rules are expanded for change. Clusters with pending notifications are
+// left alone, their rule set is sent anyway. Like deliveries, refreshes are
+// done by a single replica.
+func (o *operator) RefreshRuleSets(ctx context.Context) error {
+	return o.withDeliveryLock(func() error {
+		return o.clusters.Each(func(_ int, c cluster.Cluster) error {
+			return o.refresh(ctx, c)
+		})
+	})
+}
+
+// refresh queues a notification for c if its rule set changed since it was
+// last delivered.
+func (o *operator) refresh(ctx context.Context, c cluster.Cluster) error {
+	var latest RuleNotification
+	if err := o.db.Where("cluster = ?", c.Name).Order("id desc").Limit(1).Find(&latest).Error; err != nil {
+		return err
+	}
+	if latest.ID == 0 || latest.DeliveredTime == 0 {
+		return nil
+	}
+
+	rules, _, _, err := o.ruleSet(ctx, c, latest.ID)
+	if err != nil {
+		return err
+	}
+	d, err := digest(rules)
+	if err != nil || d == latest.Digest {
+		return err
+	}
+	return enqueueClusterNotifications(o.db, []string{c.Name}, "refresh expanded rules")
+}
+
+func notificationBackoff(attempts int) time.Duration {
+	backoff := notificationMinBackoff
+	for i := 1; i < attempts && backoff < notificationMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > notificationMaxBackoff {
+		backoff = notificationMaxBackoff
+	}
+	return backoff
+}
+
+// GetSyncStatus returns the synchronisation of the rule set of every
+// cluster, in sync when every cluster is.
+func (o *operator) GetSyncStatus() (*SyncStatus, error) {
+	status := &SyncStatus{InSync: true, Clusters: make([]ClusterSyncStatus, 0, len(o.clusters))}
+	for _, c := range o.clusters {
+		s, err := o.clusterSyncStatus(c.Name)
+		if err != nil {
+			return nil, err
+		}
+		status.InSync = status.InSync && s.InSync
+		status.Pending += s.Pending
+		status.Clusters = append(status.Clusters, *s)
+	}
+	return status, nil
+}
+
+func (o *operator) clusterSyncStatus(name string) (*ClusterSyncStatus, error) {
+	status := &ClusterSyncStatus{Cluster: name}
+
+	var acknowledged RuleNotification
+	if err := o.db.Where("cluster = ? AND delivered_time <> 0", name).Order("id desc").Limit(1).Find(&acknowledged).Error; err != nil {
+		return nil, err
+	}
+	status.AcknowledgedVersion = acknowledged.ID
+	status.AcknowledgedTime = acknowledged.DeliveredTime
+	status.Skipped = acknowledged.Skipped
+	status.Version = acknowledged.ID
+
+	var pending []RuleNotification
+	if err := o.db.Where("cluster = ? AND delivered_time = 0", name).Order("id asc").Find(&pending).Error; err != nil {
+		return nil, err
+	}
+	status.Pending = len(pending)
+	if len(pending) != 0 {
+		status.Version = pending[len(pending)-1].ID
+		status.Attempts = pending[0].Attempts
+		status.NextAttemptTime = pending[0].NextAttemptTime
+		status.LastError = pending[0].LastError
+	}
+	status.InSync = status.Pending == 0
+
+	return status, nil
+}
@@ -0,0 +1,123 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"cpds/cpds-analyzer/internal/pkg/detector"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotificationBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{9, 256 * time.Second},
+		{10, 5 * time.Minute},
+		{1000, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := notificationBackoff(tt.attempts); got != tt.want {
+			t.Errorf("notificationBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	base := detector.RuleSet{
+		Version: 3,
+		Rules: []detector.Rule{
+			{ID: 1, Name: "node_cpu", Expression: `cpu{instance="node1"}`, FaultConditionType: ">", FaultThresholds: 0.9, Arguments: map[string]string{"instance": "node1"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(rules *detector.RuleSet)
+		wantSame bool
+	}{
+		{
+			name:     "new version only",
+			modify:   func(rules *detector.RuleSet) { rules.Version = 4 },
+			wantSame: true,
+		},
+		{
+			name: "threshold changed",
+			modify: func(rules *detector.RuleSet) {
+				rules.Rules[0].FaultThresholds = 0.8
+			},
+		},
+		{
+			name: "expanded for another target",
+			modify: func(rules *detector.RuleSet) {
+				rules.Rules[0].Expression = `cpu{instance="node2"}`
+				rules.Rules[0].Arguments = map[string]string{"instance": "node2"}
+			},
+		},
+		{
+			name: "rule added",
+			modify: func(rules *detector.RuleSet) {
+				rules.Rules = append(rules.Rules, detector.Rule{ID: 2, Name: "node_memory"})
+			},
+		},
+	}
+	want, err := digest(&base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := base
+			rules.Rules = []detector.Rule{base.Rules[0]}
+			tt.modify(&rules)
+
+			got, err := digest(&rules)
+			if err != nil {
+				t.Fatalf("digest() error = %v", err)
+			}
+			if (got == want) != tt.wantSame {
+				t.Errorf("digest() = %s, base digest %s, want same %v", got, want, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestRuleSetRevisions(t *testing.T) {
+	revisions := RuleSetRevisions{1: 3, 12: 1}
+
+	value, err := revisions.Value()
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+	var got RuleSetRevisions
+	if err := got.Scan(value); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, revisions) {
+		t.Errorf("Scan(Value()) = %v, want %v", got, revisions)
+	}
+
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Errorf("Scan(nil) = %v, %v, want no revisions", got, err)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// fields that change on every revision and are left out of diffs
+var revisionDiffIgnoredFields = []string{"revision", "update_time"}
+
+// RecordRevision stores a snapshot of rule under its current revision number.
+// It is meant to be called inside the transaction that changed the rule.
+func RecordRevision(tx *gorm.DB, rule *Rule, action string) error {
+	snapshot, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&RuleRevision{
+		RuleID:     rule.ID,
+		Revision:   rule.Revision,
+		Action:     action,
+		Snapshot:   string(snapshot),
+		CreateTime: time.Now().Unix(),
+	}).Error
+}
+
+func (o *operator) GetRuleHistory(id uint) ([]RuleRevision, error) {
+	var revisions []RuleRevision
+	if err := o.db.Where("rule_id = ?", id).Order("revision desc").Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	for i := range revisions {
+		if err := revisions[i].decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return revisions, nil
+}
+
+func (o *operator) DiffRuleRevisions(id uint, from, to uint) ([]RuleFieldChange, error) {
+	fromRevision, err := getRevision(o.db, id, from)
+	if err != nil {
+		return nil, err
+	}
+
+	toRevision, err := getRevision(o.db, id, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var fromFields, toFields map[string]interface{}
+	if err := json.Unmarshal([]byte(fromRevision.Snapshot), &fromFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(toRevision.Snapshot), &toFields); err != nil {
+		return nil, err
+	}
+
+	for _, field := range revisionDiffIgnoredFields {
+		delete(fromFields, field)
+		delete(toFields, field)
+	}
+
+	fields := make([]string, 0, len(toFields))
+	for field := range toFields {
+		fields = append(fields, field)
+	}
+	for field := range fromFields {
+		if _, ok := toFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]RuleFieldChange, 0)
+	for _, field := range fields {
+		if reflect.DeepEqual(fromFields[field], toFields[field]) {
+			continue
+		}
+		changes = append(changes, RuleFieldChange{
+			Field: field,
+			From:  fromFields[field],
+			To:    toFields[field],
+		})
+	}
+
+	return changes, nil
+}
+
+func (o *operator) RollbackRule(id uint, revision uint) (*Rule, error) {
+	var rule *Rule
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		target, err := getRevision(tx, id, revision)
+		if err != nil {
+			return err
+		}
+
+		var latest RuleRevision
+		if err := tx.Where("rule_id = ?", id).Order("revision desc").First(&latest).Error; err != nil {
+			return err
+		}
+
+		if err := target.decode(); err != nil {
+			return err
+		}
+		rule = target.Rule
+		rule.ID = id
+		rule.setDefaults()
+		if err := resolveSeverity(tx, rule); err != nil {
+			return err
+		}
+		rule.Revision = latest.Revision + 1
+		rule.UpdateTime = time.Now().Unix()
+
+		// Save falls back to an insert when the rule has been deleted since
+		if err := tx.Save(rule).Error; err != nil {
+			return err
+		}
+
+		if err := RecordRevision(tx, rule, RevisionActionRollback); err != nil {
+			return err
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("rollback rule %s to revision %d", rule.Name, revision))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// GetRuleRevision returns the rule as it was at revision.
+func (o *operator) GetRuleRevision(id uint, revision uint) (*Rule, error) {
+	r, err := getRevision(o.db, id, revision)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decode(); err != nil {
+		return nil, err
+	}
+	return r.Rule, nil
+}
+
+func getRevision(db *gorm.DB, id uint, revision uint) (*RuleRevision, error) {
+	var r RuleRevision
+	if err := db.Where("rule_id = ? AND revision = ?", id, revision).First(&r).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("revision not found")
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (r *RuleRevision) decode() error {
+	var rule Rule
+	if err := json.Unmarshal([]byte(r.Snapshot), &rule); err != nil {
+		return err
+	}
+	r.Rule = &rule
+	return nil
+}
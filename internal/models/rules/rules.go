@@ -17,8 +17,14 @@
 package rules
 
 import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/monitor"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/models/severity"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
 	"cpds/cpds-analyzer/internal/pkg/detector"
-	"encoding/json"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
 	"errors"
 	"fmt"
 	"strconv"
@@ -28,44 +34,72 @@ import (
 )
 
 type Operator interface {
-	GetRules(filter, sortField, sortOrder string, pageNo, pageSize int) ([]Rules, error)
+	GetRules(filter *RuleFilter, sortField, sortOrder string, pageNo, pageSize int) ([]Rules, error)
 
 	CreateRule(rule *Rule) error
 
 	UpdateRule(rule *Rule) error
 
-	SendRuleUpdatedRequset() error
+	DeliverNotifications(ctx context.Context) error
+
+	RefreshRuleSets(ctx context.Context) error
+
+	GetSyncStatus() (*SyncStatus, error)
 
 	DeleteRuleByID(id int) error
 
-	GetTotalPages(filter string) int
+	GetTotalPages(filter *RuleFilter) int
+
+	Backtest(ctx context.Context, clusters cluster.Clusters, rule *Rule, startTime, endTime, step int64) (*BacktestResult, error)
+
+	EvaluateRule(ctx context.Context, clusters cluster.Clusters, rule *Rule, startTime, endTime, step int64) ([]EvaluatedSeries, error)
+
+	GetRuleHistory(id uint) ([]RuleRevision, error)
+
+	GetRuleRevision(id uint, revision uint) (*Rule, error)
+
+	DiffRuleRevisions(id uint, from, to uint) ([]RuleFieldChange, error)
+
+	RollbackRule(id uint, revision uint) (*Rule, error)
+
+	ExportRules() ([]Rule, error)
+
+	ImportRules(rules []Rule, policy string) (*ImportResult, error)
+
+	ExpandRules(ctx context.Context, clusters cluster.Clusters) ([]ExpandedRule, SkippedRules, error)
+
+	SetRulesEnabled(selector *RuleSelector, enabled bool) ([]string, error)
+
+	LintRule(ctx context.Context, rule *Rule) LintIssues
 }
 
 type operator struct {
-	detectorConfig *detectorConfig
-	db             *gorm.DB
+	clusters   cluster.Clusters
+	detectors  map[string]detector.Client
+	db         *gorm.DB
+	prometheus *prometheusmodel.Federation
+	monitor    *monitor.Federation
 }
 
-type detectorConfig struct {
-	host string
-	port int
-}
+// NewOperator returns an operator of the rules of clusters, the rules being
+// evaluated on the datasource of every cluster they are assigned to.
+func NewOperator(clusters cluster.Clusters, cache *cache.Options, db *gorm.DB) Operator {
+	detectors := make(map[string]detector.Client, len(clusters))
+	for _, c := range clusters {
+		detectors[c.Name] = detector.NewClient(c.Detector)
+	}
 
-func NewOperator(detectorHost string, detectorPort int, db *gorm.DB) Operator {
 	return &operator{
-		db: db.Session(&gorm.Session{}),
-		detectorConfig: &detectorConfig{
-			host: detectorHost,
-			port: detectorPort,
-		},
+		clusters:   clusters,
+		detectors:  detectors,
+		db:         db.Session(&gorm.Session{}),
+		prometheus: prometheusmodel.NewFederation(clusters, cache),
+		monitor:    monitor.NewFederation(clusters, cache),
 	}
 }
 
-func (o *operator) GetRules(filter, sortField, sortOrder string, pageNo, pageSize int) ([]Rules, error) {
-	var query = o.db
-	if filter != "" {
-		query = query.Where("name LIKE ?", "%"+filter+"%")
-	}
+func (o *operator) GetRules(filter *RuleFilter, sortField, sortOrder string, pageNo, pageSize int) ([]Rules, error) {
+	var query = filter.apply(o.db)
 
 	query = query.Order(fmt.Sprintf("%s %s", sortField, sortOrder))
 
@@ -86,12 +120,23 @@ func (o *operator) GetRules(filter, sortField, sortOrder string, pageNo, pageSiz
 			CreateTime: rule.CreateTime,
 			UpdateTime: rule.UpdateTime,
 			Duration: rule.Duration,
+			Description: rule.Description,
+			RunbookURL: rule.RunbookURL,
+			OwnerTeam: rule.OwnerTeam,
+			Remediation: rule.Remediation,
 			Expression: rule.Expression,
+			Parameters: rule.Parameters,
+			Labels: rule.Labels,
+			Inhibits: rule.Inhibits,
+			Clusters: rule.Clusters,
+			Enabled: rule.Enabled,
 			SubhealthConditionType: rule.SubhealthConditionType,
 			SubhealthThresholds:strconv.FormatFloat(rule.SubhealthThresholds, 'f', -1, 64),
 			FaultConditionType: rule.FaultConditionType,
 			FaultThresholds: strconv.FormatFloat(rule.FaultThresholds, 'f', -1, 64),
 			Severity: rule.Severity,
+			SeverityID: rule.SeverityID,
+			Revision: rule.Revision,
 		})
 	}
 	return ruleData, nil
@@ -100,53 +145,258 @@ func (o *operator) GetRules(filter, sortField, sortOrder string, pageNo, pageSiz
 func (o *operator) CreateRule(rule *Rule) error {
 	rule.CreateTime = time.Now().Unix()
 	rule.UpdateTime = time.Now().Unix()
+	rule.Revision = 1
+	rule.setDefaults()
 
-	if err := o.db.Create(rule).Error; err != nil {
-		return err
-	}
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		if err := resolveSeverity(tx, rule); err != nil {
+			return err
+		}
 
-	return nil
+		if err := tx.Create(rule).Error; err != nil {
+			return err
+		}
+
+		if err := RecordRevision(tx, rule, RevisionActionCreate); err != nil {
+			return err
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("create rule %s", rule.Name))
+	})
 }
 
 func (o *operator) UpdateRule(rule *Rule) error {
-	b,_ :=json.Marshal(rule)
-	ruleMap :=make(map[string]interface{})
-	json.Unmarshal(b, &ruleMap)
-	result := o.db.Model(&rule).Updates(ruleMap)
-	if result.Error != nil {
-		return result.Error
-	} else if result.RowsAffected == 0 {
-		return errors.New("nothing changed")
+	omitted := []string{"id", "create_time", "update_time", "revision"}
+	if rule.Enabled == nil {
+		omitted = append(omitted, "enabled")
 	}
-	o.db.Model(&rule).Update("update_time", time.Now().Unix())
 
-	return nil
-}
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		if err := resolveSeverity(tx, rule); err != nil {
+			return err
+		}
 
-func (o *operator) DeleteRuleByID(id int) error {
-	result := o.db.Delete(&Rule{}, id)
-	if result.Error != nil {
-		return result.Error
-	}
+		result := tx.Model(rule).Select("*").Omit(omitted...).Updates(rule)
+		if result.Error != nil {
+			return result.Error
+		} else if result.RowsAffected == 0 {
+			return errors.New("nothing changed")
+		}
 
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
-	}
+		if err := tx.Model(rule).Updates(map[string]interface{}{
+			"revision":    gorm.Expr("revision + 1"),
+			"update_time": time.Now().Unix(),
+		}).Error; err != nil {
+			return err
+		}
 
-	return nil
+		if err := tx.First(rule, rule.ID).Error; err != nil {
+			return err
+		}
+
+		if err := RecordRevision(tx, rule, RevisionActionUpdate); err != nil {
+			return err
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("update rule %s", rule.Name))
+	})
 }
 
-func (o *operator) SendRuleUpdatedRequset() error {
-	if err := detector.SendRuleUpdatedRequset(o.detectorConfig.host, o.detectorConfig.port); err != nil {
+// resolveSeverity sets both the severity id and name of rule from whichever
+// of them is known.
+func resolveSeverity(db *gorm.DB, rule *Rule) error {
+	s, err := severity.Resolve(db, rule.SeverityID, rule.Severity)
+	if err != nil {
 		return err
 	}
 
+	rule.SeverityID = s.ID
+	rule.Severity = s.Name
 	return nil
 }
 
-func (o *operator) GetTotalPages(filter string) int {
+func (o *operator) DeleteRuleByID(id int) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var rule Rule
+		if err := tx.First(&rule, id).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&Rule{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		rule.Revision++
+		if err := RecordRevision(tx, &rule, RevisionActionDelete); err != nil {
+			return err
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("delete rule %s", rule.Name))
+	})
+}
+
+func (o *operator) GetTotalPages(filter *RuleFilter) int {
 	var tableCount int64
 	var query = o.db
-	query = query.Model(&Rule{}).Where("name LIKE ?", "%"+filter+"%").Count(&tableCount)
+	query = filter.apply(query.Model(&Rule{})).Count(&tableCount)
 	return int(tableCount)
 }
+
+func (o *operator) Backtest(ctx context.Context, clusters cluster.Clusters, rule *Rule, startTime, endTime, step int64) (*BacktestResult, error) {
+	evaluated, err := o.EvaluateRule(ctx, clusters, rule, startTime, endTime, step)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BacktestResult{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Step:      step,
+		Series:    make([]BacktestSeries, 0),
+	}
+	for _, series := range evaluated {
+		if len(series.Intervals) == 0 {
+			continue
+		}
+
+		for _, interval := range series.Intervals {
+			if interval.Status == ConditionFault {
+				result.FaultCount++
+			} else {
+				result.SubhealthCount++
+			}
+		}
+		result.Series = append(result.Series, BacktestSeries{
+			Metric:    series.Metric,
+			Arguments: series.Arguments,
+			Intervals: series.Intervals,
+		})
+	}
+
+	return result, nil
+}
+
+// EvaluateRule queries every expansion of the rule over the range, on the
+// clusters of clusters the rule is assigned to, and evaluates the conditions
+// of the rule on each returned series. Series are labelled with their cluster.
+func (o *operator) EvaluateRule(ctx context.Context, clusters cluster.Clusters, rule *Rule, startTime, endTime, step int64) ([]EvaluatedSeries, error) {
+	hold, err := timeutil.ParseDuration(rule.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluated := make([]EvaluatedSeries, 0)
+	for _, c := range clusters {
+		if !rule.AssignedTo(c.Name) {
+			continue
+		}
+
+		expanded, err := o.expand(ctx, c, rule)
+		if err != nil {
+			return nil, err
+		}
+
+		datasource, err := o.prometheus.Operator(c.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range expanded {
+			data, err := datasource.QueryRange(ctx, e.Expression, startTime, endTime, step)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+			}
+
+			for _, value := range prometheusmodel.LabelValues(data.MetricValues, c.Name) {
+				evaluated = append(evaluated, EvaluatedSeries{
+					Metric:    value.Metadata,
+					Arguments: e.Arguments,
+					Values:    value.Series,
+					Marks:     MarkSeries(rule, value.Series),
+					Intervals: EvaluateSeries(rule, value.Series, step, int64(hold.Seconds())),
+				})
+			}
+		}
+	}
+
+	return evaluated, nil
+}
+
+func (o *operator) ExportRules() ([]Rule, error) {
+	var rules []Rule
+	if err := o.db.Order("name asc").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (o *operator) ImportRules(rules []Rule, policy string) (*ImportResult, error) {
+	result := &ImportResult{
+		Created: make([]string, 0),
+		Updated: make([]string, 0),
+		Skipped: make([]string, 0),
+	}
+
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		for i := range rules {
+			rule := &rules[i]
+			rule.setDefaults()
+			if err := resolveSeverity(tx, rule); err != nil {
+				return fmt.Errorf("rule %s: %s", rule.Name, err)
+			}
+			now := time.Now().Unix()
+
+			var existing Rule
+			err := tx.Where("name = ?", rule.Name).First(&existing).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				rule.ID = 0
+				rule.CreateTime = now
+				rule.UpdateTime = now
+				rule.Revision = 1
+				if err := tx.Create(rule).Error; err != nil {
+					return err
+				}
+				if err := RecordRevision(tx, rule, RevisionActionCreate); err != nil {
+					return err
+				}
+				result.Created = append(result.Created, rule.Name)
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			switch policy {
+			case ImportPolicySkip:
+				result.Skipped = append(result.Skipped, rule.Name)
+				continue
+			case ImportPolicyOverwrite:
+			default:
+				return fmt.Errorf("rule %s already exists", rule.Name)
+			}
+
+			rule.ID = existing.ID
+			rule.CreateTime = existing.CreateTime
+			rule.UpdateTime = now
+			rule.Revision = existing.Revision + 1
+			if err := tx.Save(rule).Error; err != nil {
+				return err
+			}
+			if err := RecordRevision(tx, rule, RevisionActionUpdate); err != nil {
+				return err
+			}
+			result.Updated = append(result.Updated, rule.Name)
+		}
+
+		if len(result.Created) == 0 && len(result.Updated) == 0 {
+			return nil
+		}
+		return o.enqueueNotification(tx, fmt.Sprintf("import %d rules", len(result.Created)+len(result.Updated)))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,344 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"context"
+	"cpds/cpds-analyzer/internal/models/monitor"
+	prometheusmodel "cpds/cpds-analyzer/internal/models/prometheus"
+	"cpds/cpds-analyzer/internal/pkg/cluster"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+var parameterNameRegexp = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// placeholderParameterValue is used to render discovered parameters when
+// validating an expression, where the actual values are not needed.
+const placeholderParameterValue = "placeholder"
+
+// Scan implements sql.Scanner, parameters are stored as json text.
+func (p *RuleParameters) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported parameters type %T", value)
+	}
+
+	if len(data) == 0 {
+		*p = nil
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
+
+// Value implements driver.Valuer.
+func (p RuleParameters) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner, skipped rules are stored as json text.
+func (s *SkippedRules) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported skipped rules type %T", value)
+	}
+
+	if len(data) == 0 {
+		*s = nil
+		return nil
+	}
+	return json.Unmarshal(data, s)
+}
+
+// Value implements driver.Valuer.
+func (s SkippedRules) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Render executes the rule expression as a template with the given parameter
+// values. Values are escaped as the content of a double quoted PromQL string,
+// such as the value of a label matcher. Rules without parameters are returned
+// unchanged.
+func (r *Rule) Render(values map[string]string) (string, error) {
+	if len(r.Parameters) == 0 {
+		return r.Expression, nil
+	}
+
+	tmpl, err := template.New(r.Name).Option("missingkey=error").Parse(r.Expression)
+	if err != nil {
+		return "", err
+	}
+
+	escaped := make(map[string]string, len(values))
+	for name, value := range values {
+		quoted := strconv.Quote(value)
+		escaped[name] = quoted[1 : len(quoted)-1]
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, escaped); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// RenderSample renders the expression with the first allowed value of every
+// parameter, or a placeholder for discovered ones.
+func (r *Rule) RenderSample() (string, error) {
+	values := make(map[string]string, len(r.Parameters))
+	for _, p := range r.Parameters {
+		if len(p.Values) != 0 {
+			values[p.Name] = p.Values[0]
+		} else {
+			values[p.Name] = placeholderParameterValue
+		}
+	}
+	return r.Render(values)
+}
+
+// ValidateParameters checks the parameter declarations of a rule.
+func (r *Rule) ValidateParameters() error {
+	names := make(map[string]bool, len(r.Parameters))
+	for _, p := range r.Parameters {
+		if !parameterNameRegexp.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		names[p.Name] = true
+
+		switch {
+		case len(p.Values) != 0 && p.Source != "":
+			return fmt.Errorf("parameter %s cannot have both values and source", p.Name)
+		case len(p.Values) == 0 && p.Source == "":
+			return fmt.Errorf("parameter %s needs values or a source", p.Name)
+		case p.Source != "" && p.Source != ParameterSourceTargets && p.Source != ParameterSourceQuery:
+			return fmt.Errorf("parameter %s has unknown source %s", p.Name, p.Source)
+		case p.Source == ParameterSourceQuery && p.Query == "":
+			return fmt.Errorf("parameter %s needs a query", p.Name)
+		case p.Source != ParameterSourceQuery && p.Query != "":
+			return fmt.Errorf("parameter %s can only have a query with the %s source", p.Name, ParameterSourceQuery)
+		}
+		if p.Query != "" {
+			if _, err := parser.ParseExpr(p.Query); err != nil {
+				return fmt.Errorf("parameter %s has an invalid query: %s", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Expand renders the rule once for every combination of parameter values.
+// discover is called to resolve the values of parameters with a source, a
+// parameter without values expands the rule to none.
+func (r *Rule) Expand(discover func(p *RuleParameter) ([]string, error)) ([]ExpandedRule, error) {
+	if len(r.Parameters) == 0 {
+		return []ExpandedRule{{Rule: *r}}, nil
+	}
+
+	combinations := []map[string]string{{}}
+	for i := range r.Parameters {
+		p := &r.Parameters[i]
+		values := p.Values
+		if p.Source != "" {
+			var err error
+			if values, err = discover(p); err != nil {
+				return nil, err
+			}
+		}
+
+		next := make([]map[string]string, 0, len(combinations)*len(values))
+		for _, c := range combinations {
+			for _, v := range values {
+				arguments := make(map[string]string, len(c)+1)
+				for k, cv := range c {
+					arguments[k] = cv
+				}
+				arguments[p.Name] = v
+				next = append(next, arguments)
+			}
+		}
+		combinations = next
+	}
+
+	expanded := make([]ExpandedRule, 0, len(combinations))
+	for _, arguments := range combinations {
+		expr, err := r.Render(arguments)
+		if err != nil {
+			return nil, err
+		}
+
+		e := ExpandedRule{Rule: *r, Arguments: arguments}
+		e.Expression = expr
+		expanded = append(expanded, e)
+	}
+	return expanded, nil
+}
+
+// ExpandRules expands every enabled rule for every cluster of clusters it is
+// assigned to, this is the rule set sent to the detectors of clusters. A rule
+// that cannot be expanded for a cluster is left out of its rule set and
+// returned as skipped, so that it does not hold the other rules back.
+func (o *operator) ExpandRules(ctx context.Context, clusters cluster.Clusters) ([]ExpandedRule, SkippedRules, error) {
+	var records []Rule
+	if err := o.db.Where("enabled = ?", true).Order("name asc").Find(&records).Error; err != nil {
+		return nil, nil, err
+	}
+
+	expanded := make([]ExpandedRule, 0, len(records))
+	skipped := make(SkippedRules, 0)
+	for _, c := range clusters {
+		m, err := o.monitor.Operator(c.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		datasource, err := o.prometheus.Operator(c.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		discover := discoverer(ctx, m, datasource)
+		for i := range records {
+			if !records[i].AssignedTo(c.Name) {
+				continue
+			}
+
+			e, err := records[i].Expand(discover)
+			if err != nil {
+				skipped = append(skipped, SkippedRule{Cluster: c.Name, Name: records[i].Name, Error: err.Error()})
+				continue
+			}
+			for j := range e {
+				e[j].Cluster = c.Name
+			}
+			expanded = append(expanded, e...)
+		}
+	}
+	return expanded, skipped, nil
+}
+
+// expand expands the rule for the cluster c.
+func (o *operator) expand(ctx context.Context, c cluster.Cluster, rule *Rule) ([]ExpandedRule, error) {
+	m, err := o.monitor.Operator(c.Name)
+	if err != nil {
+		return nil, err
+	}
+	datasource, err := o.prometheus.Operator(c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded, err := rule.Expand(discoverer(ctx, m, datasource))
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", c.Name, err)
+	}
+	for i := range expanded {
+		expanded[i].Cluster = c.Name
+	}
+	return expanded, nil
+}
+
+// discoverer returns a function resolving parameter sources, the targets
+// being the ones of the monitor and queries being run on datasource. Sources
+// are only queried once per returned function.
+func discoverer(ctx context.Context, m monitor.Operator, datasource prometheusmodel.Operator) func(p *RuleParameter) ([]string, error) {
+	type key struct{ source, query, label string }
+	discovered := make(map[key][]string)
+	return func(p *RuleParameter) ([]string, error) {
+		k := key{p.Source, p.Query, p.Name}
+		if values, ok := discovered[k]; ok {
+			return values, nil
+		}
+
+		var values []string
+		switch p.Source {
+		case ParameterSourceTargets:
+			targets, err := m.GetMonitorTargets(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if targets != nil {
+				for _, target := range targets.Targets {
+					values = append(values, target.Instance)
+				}
+			}
+		case ParameterSourceQuery:
+			data, err := datasource.Query(ctx, p.Query, time.Now().Unix())
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range data.MetricValues {
+				if v := value.Metadata[p.Name]; v != "" {
+					values = append(values, v)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown parameter source %s", p.Source)
+		}
+
+		sort.Strings(values)
+		unique := make([]string, 0, len(values))
+		for i, v := range values {
+			if i == 0 || v != values[i-1] {
+				unique = append(unique, v)
+			}
+		}
+		discovered[k] = unique
+		return unique, nil
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package rules
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "no parameters",
+			rule: Rule{Expression: `up{instance="{{ .instance }}"}`},
+			want: `up{instance="{{ .instance }}"}`,
+		},
+		{
+			name:   "parameter",
+			rule:   Rule{Expression: `up{instance="{{ .instance }}"}`, Parameters: RuleParameters{{Name: "instance", Source: ParameterSourceTargets}}},
+			values: map[string]string{"instance": "192.168.0.10:20001"},
+			want:   `up{instance="192.168.0.10:20001"}`,
+		},
+		{
+			name:   "value with quotes",
+			rule:   Rule{Expression: `up{job="{{ .job }}"}`, Parameters: RuleParameters{{Name: "job", Values: []string{"x"}}}},
+			values: map[string]string{"job": `a"} or vector(1) or up{job="b\`},
+			want:   `up{job="a\"} or vector(1) or up{job=\"b\\"}`,
+		},
+		{
+			name:    "missing parameter",
+			rule:    Rule{Expression: `up{instance="{{ .instance }}"}`, Parameters: RuleParameters{{Name: "instance", Source: ParameterSourceTargets}}},
+			values:  map[string]string{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			rule:    Rule{Expression: `up{instance="{{ .instance }"}`, Parameters: RuleParameters{{Name: "instance", Source: ParameterSourceTargets}}},
+			values:  map[string]string{"instance": "node1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rule.Render(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters RuleParameters
+		wantErr    bool
+	}{
+		{name: "none"},
+		{name: "values", parameters: RuleParameters{{Name: "mount", Values: []string{"/", "/var"}}}},
+		{name: "source", parameters: RuleParameters{{Name: "instance", Source: ParameterSourceTargets}}},
+		{name: "invalid name", parameters: RuleParameters{{Name: "1st", Values: []string{"a"}}}, wantErr: true},
+		{name: "duplicate", parameters: RuleParameters{{Name: "a", Values: []string{"a"}}, {Name: "a", Values: []string{"b"}}}, wantErr: true},
+		{name: "values and source", parameters: RuleParameters{{Name: "a", Values: []string{"a"}, Source: ParameterSourceTargets}}, wantErr: true},
+		{name: "neither values nor source", parameters: RuleParameters{{Name: "a"}}, wantErr: true},
+		{name: "unknown source", parameters: RuleParameters{{Name: "a", Source: "pods"}}, wantErr: true},
+		{name: "query", parameters: RuleParameters{{Name: "instance", Source: ParameterSourceQuery, Query: `count by (instance) (up)`}}},
+		{name: "query without query", parameters: RuleParameters{{Name: "instance", Source: ParameterSourceQuery}}, wantErr: true},
+		{name: "invalid query", parameters: RuleParameters{{Name: "instance", Source: ParameterSourceQuery, Query: `count by (`}}, wantErr: true},
+		{name: "query with targets", parameters: RuleParameters{{Name: "instance", Source: ParameterSourceTargets, Query: `up`}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := Rule{Parameters: tt.parameters}
+			if err := rule.ValidateParameters(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateParameters() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	discover := func(p *RuleParameter) ([]string, error) {
+		return []string{"node1", `node"2`}, nil
+	}
+
+	rule := Rule{
+		Expression: `up{instance="{{ .instance }}",mount="{{ .mount }}"}`,
+		Parameters: RuleParameters{
+			{Name: "instance", Source: ParameterSourceTargets},
+			{Name: "mount", Values: []string{"/"}},
+		},
+	}
+	expanded, err := rule.Expand(discover)
+	if err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+
+	var got []string
+	for _, e := range expanded {
+		got = append(got, e.Expression)
+	}
+	want := []string{`up{instance="node1",mount="/"}`, `up{instance="node\"2",mount="/"}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand() expressions = %v, want %v", got, want)
+	}
+	if expanded[1].Arguments["instance"] != `node"2` {
+		t.Errorf("Expand() arguments = %v, want the values unescaped", expanded[1].Arguments)
+	}
+
+	plain := Rule{Expression: "up"}
+	if expanded, err := plain.Expand(discover); err != nil || len(expanded) != 1 || expanded[0].Expression != "up" {
+		t.Errorf("Expand() = %v, %v, want the rule unchanged", expanded, err)
+	}
+
+	failing := func(p *RuleParameter) ([]string, error) {
+		return nil, errors.New("detector unavailable")
+	}
+	if _, err := rule.Expand(failing); err == nil {
+		t.Errorf("Expand() error = nil, want the discovery error")
+	}
+
+	none := func(p *RuleParameter) ([]string, error) {
+		return nil, nil
+	}
+	if expanded, err := rule.Expand(none); err != nil || len(expanded) != 0 {
+		t.Errorf("Expand() = %v, %v, want no rules when nothing is discovered", expanded, err)
+	}
+}
@@ -16,30 +16,292 @@
 
 package rules
 
+import "cpds/cpds-analyzer/pkg/prometheus"
+
+// Rule is a diagnostic rule. The yaml tags define the schema used by rule
+// import and export, see docs/rule_file.md.
 type Rule struct {
-	ID                     uint    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
-	Name                   string  `json:"name" gorm:"unique;not null"`
-	Expression             string  `json:"expression" gorm:"not null;type:varchar(1024)"`
-	SubhealthConditionType string  `json:"subhealth_condition_type"`
-	SubhealthThresholds    float64 `json:"subhealth_thresholds"`
-	FaultConditionType     string  `json:"fault_condition_type"`
-	FaultThresholds        float64 `json:"fault_thresholds"`
-	Severity               string  `json:"severity" gorm:"not null"`
-	Duration               string  `json:"duration" gorm:"not null"`
-	CreateTime             int64   `json:"create_time" gorm:"not null"`
-	UpdateTime             int64   `json:"update_time" gorm:"not null"`
+	ID                     uint           `json:"id" yaml:"-" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name                   string         `json:"name" yaml:"name" gorm:"unique;not null"`
+	Expression             string         `json:"expression" yaml:"expression" gorm:"not null;type:varchar(1024)"`
+	Parameters             RuleParameters `json:"parameters" yaml:"parameters,omitempty" gorm:"type:text"`
+	Labels                 RuleLabels     `json:"labels" yaml:"labels,omitempty" gorm:"type:text"`
+	Inhibits               RuleNames      `json:"inhibits" yaml:"inhibits,omitempty" gorm:"type:text"`
+	Clusters               ClusterNames   `json:"clusters" yaml:"clusters,omitempty" gorm:"type:text"`
+	Enabled                *bool          `json:"enabled" yaml:"enabled,omitempty" gorm:"not null;default:true"`
+	SubhealthConditionType string         `json:"subhealth_condition_type" yaml:"subhealth_condition_type,omitempty"`
+	SubhealthThresholds    float64        `json:"subhealth_thresholds" yaml:"subhealth_thresholds,omitempty"`
+	FaultConditionType     string         `json:"fault_condition_type" yaml:"fault_condition_type,omitempty"`
+	FaultThresholds        float64        `json:"fault_thresholds" yaml:"fault_thresholds,omitempty"`
+	Severity               string         `json:"severity" yaml:"severity" gorm:"not null"`
+	SeverityID             uint           `json:"severity_id" yaml:"-" gorm:"not null;default:0;index"`
+	Duration               string         `json:"duration" yaml:"duration" gorm:"not null"`
+	Description            string         `json:"description" yaml:"description,omitempty" gorm:"type:text"`
+	RunbookURL             string         `json:"runbook_url" yaml:"runbook_url,omitempty" gorm:"type:varchar(512)"`
+	OwnerTeam              string         `json:"owner_team" yaml:"owner_team,omitempty" gorm:"type:varchar(64)"`
+	Remediation            string         `json:"remediation" yaml:"remediation,omitempty" gorm:"type:text"`
+	CreateTime             int64          `json:"create_time" yaml:"-" gorm:"not null"`
+	UpdateTime             int64          `json:"update_time" yaml:"-" gorm:"not null"`
+	Revision               uint           `json:"revision" yaml:"-" gorm:"not null;default:0"`
 }
 
 type Rules struct {
-	ID                     uint    `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
-	Name                   string  `json:"name" gorm:"unique;not null"`
-	Expression             string  `json:"expression" gorm:"not null;type:varchar(1024)"`
-	SubhealthConditionType string  `json:"subhealth_condition_type"`
-	SubhealthThresholds    string `json:"subhealth_thresholds"`
-	FaultConditionType     string  `json:"fault_condition_type"`
-	FaultThresholds        string `json:"fault_thresholds"`
-	Severity               string  `json:"severity" gorm:"not null"`
-	Duration               string  `json:"duration" gorm:"not null"`
-	CreateTime             int64   `json:"create_time" gorm:"not null"`
-	UpdateTime             int64   `json:"update_time" gorm:"not null"`
+	ID                     uint           `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name                   string         `json:"name" gorm:"unique;not null"`
+	Expression             string         `json:"expression" gorm:"not null;type:varchar(1024)"`
+	Parameters             RuleParameters `json:"parameters" gorm:"type:text"`
+	Labels                 RuleLabels     `json:"labels" gorm:"type:text"`
+	Inhibits               RuleNames      `json:"inhibits" gorm:"type:text"`
+	Clusters               ClusterNames   `json:"clusters" gorm:"type:text"`
+	Enabled                *bool          `json:"enabled" gorm:"not null;default:true"`
+	SubhealthConditionType string         `json:"subhealth_condition_type"`
+	SubhealthThresholds    string         `json:"subhealth_thresholds"`
+	FaultConditionType     string         `json:"fault_condition_type"`
+	FaultThresholds        string         `json:"fault_thresholds"`
+	Severity               string         `json:"severity" gorm:"not null"`
+	SeverityID             uint           `json:"severity_id" gorm:"not null;default:0;index"`
+	Duration               string         `json:"duration" gorm:"not null"`
+	Description            string         `json:"description" gorm:"type:text"`
+	RunbookURL             string         `json:"runbook_url" gorm:"type:varchar(512)"`
+	OwnerTeam              string         `json:"owner_team" gorm:"type:varchar(64)"`
+	Remediation            string         `json:"remediation" gorm:"type:text"`
+	CreateTime             int64          `json:"create_time" gorm:"not null"`
+	UpdateTime             int64          `json:"update_time" gorm:"not null"`
+	Revision               uint           `json:"revision" gorm:"not null;default:0"`
+}
+
+type RuleLabels map[string]string
+
+// RuleNames lists rules by name, such as the rules inhibited by a rule in fault.
+type RuleNames []string
+
+// ClusterNames lists the clusters a rule is assigned to, every cluster when
+// empty.
+type ClusterNames []string
+
+// RuleFilter selects the rules listed by GetRules. Nil fields match every rule.
+// Cluster matches the rules assigned to the cluster.
+type RuleFilter struct {
+	Name    string
+	Labels  map[string]string
+	Enabled *bool
+	Cluster string
+}
+
+// RuleSelector selects the rules affected by a bulk change, either by id, by
+// labels or both.
+type RuleSelector struct {
+	IDs    []uint            `json:"ids"`
+	Labels map[string]string `json:"labels"`
+}
+
+const (
+	// ParameterSourceTargets discovers the instances of the monitor targets
+	ParameterSourceTargets = "targets"
+
+	// ParameterSourceQuery discovers the values of the label named after the
+	// parameter in the series returned by Query
+	ParameterSourceQuery = "query"
+)
+
+// RuleParameter declares a template variable of a rule expression, such as
+// {{ .instance }}. Its values are either listed in Values or discovered from
+// Source, Query being the PromQL query of the query source.
+type RuleParameter struct {
+	Name   string   `json:"name" yaml:"name"`
+	Values []string `json:"values,omitempty" yaml:"values,omitempty"`
+	Source string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Query  string   `json:"query,omitempty" yaml:"query,omitempty"`
+}
+
+type RuleParameters []RuleParameter
+
+// SkippedRule is a rule left out of the rule set of a cluster because it
+// could not be expanded for it, such as when discovering its parameter values
+// failed.
+type SkippedRule struct {
+	Cluster string `json:"cluster"`
+	Name    string `json:"name"`
+	Error   string `json:"error"`
+}
+
+type SkippedRules []SkippedRule
+
+// ExpandedRule is a rule rendered with one combination of parameter values,
+// for the cluster it is evaluated on.
+type ExpandedRule struct {
+	Rule
+	Cluster   string            `json:"cluster"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+const (
+	RevisionActionCreate   = "create"
+	RevisionActionUpdate   = "update"
+	RevisionActionDelete   = "delete"
+	RevisionActionRollback = "rollback"
+)
+
+// RuleRevision keeps a snapshot of a rule as it was after every change. The
+// snapshot is the json encoded Rule so that it follows the rule model as it grows.
+type RuleRevision struct {
+	ID         uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	RuleID     uint   `json:"rule_id" gorm:"not null;index:idx_rule_revision,unique"`
+	Revision   uint   `json:"revision" gorm:"not null;index:idx_rule_revision,unique"`
+	Action     string `json:"action" gorm:"not null"`
+	Snapshot   string `json:"-" gorm:"not null;type:text"`
+	Rule       *Rule  `json:"rule" gorm:"-"`
+	CreateTime int64  `json:"create_time" gorm:"not null"`
+}
+
+type RuleFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+const (
+	ConditionSubhealth = "subhealth"
+	ConditionFault     = "fault"
+)
+
+type BacktestInterval struct {
+	Status    string `json:"status"`
+	StartTime int64  `json:"start_time"`
+	FireTime  int64  `json:"fire_time"`
+	EndTime   int64  `json:"end_time"`
+}
+
+type BacktestSeries struct {
+	Metric    map[string]string  `json:"metric"`
+	Arguments map[string]string  `json:"arguments,omitempty"`
+	Intervals []BacktestInterval `json:"intervals"`
+}
+
+// ConditionMark is a point of a series meeting the subhealth or fault
+// condition of a rule.
+type ConditionMark struct {
+	Time   int64   `json:"time"`
+	Value  float64 `json:"value"`
+	Status string  `json:"status"`
+}
+
+// EvaluatedSeries is a series returned by an expansion of a rule, along with
+// the points meeting a condition and the intervals the rule would report.
+type EvaluatedSeries struct {
+	Metric    map[string]string  `json:"metric"`
+	Arguments map[string]string  `json:"arguments,omitempty"`
+	Values    []prometheus.Point `json:"values"`
+	Marks     []ConditionMark    `json:"marks"`
+	Intervals []BacktestInterval `json:"intervals"`
+}
+
+type BacktestResult struct {
+	StartTime      int64            `json:"start_time"`
+	EndTime        int64            `json:"end_time"`
+	Step           int64            `json:"step"`
+	SubhealthCount int              `json:"subhealth_count"`
+	FaultCount     int              `json:"fault_count"`
+	Series         []BacktestSeries `json:"series"`
+}
+
+const (
+	FileFormatYAML       = "yaml"
+	FileFormatPrometheus = "prometheus"
+)
+
+const (
+	ImportPolicySkip      = "skip"
+	ImportPolicyOverwrite = "overwrite"
+	ImportPolicyFail      = "fail"
+)
+
+type RuleFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+type ImportResult struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Skipped []string `json:"skipped"`
+}
+
+type prometheusRuleFile struct {
+	Groups []prometheusRuleGroup `yaml:"groups"`
+}
+
+type prometheusRuleGroup struct {
+	Name  string                `yaml:"name"`
+	Rules []prometheusAlertRule `yaml:"rules"`
+}
+
+type prometheusAlertRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+const (
+	LintLevelError   = "error"
+	LintLevelWarning = "warning"
+)
+
+// LintIssue is a problem found on a single field of a rule. Errors prevent the
+// rule from being saved, warnings do not.
+type LintIssue struct {
+	Field   string `json:"field"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+type LintIssues []LintIssue
+
+// RuleNotification is an outbox entry telling the detector of a cluster to
+// reload the rules. It is written in the transaction that changes the rules
+// and delivered in the background, its id is the version of the rule set of
+// the cluster. Digest identifies the rules delivered.
+type RuleNotification struct {
+	ID              uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Cluster         string `json:"cluster" gorm:"type:varchar(64);not null;default:'';index"`
+	Reason          string `json:"reason" gorm:"not null"`
+	Attempts        int    `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptTime int64  `json:"next_attempt_time" gorm:"not null;default:0"`
+	LastError       string `json:"last_error" gorm:"type:text"`
+	CreateTime      int64  `json:"create_time" gorm:"not null"`
+	DeliveredTime   int64  `json:"delivered_time" gorm:"not null;default:0;index"`
+	Digest          string `json:"digest" gorm:"type:varchar(64);not null;default:''"`
+	// Skipped lists the rules left out of the delivered rule set, Revisions
+	// the revision of every rule it held
+	Skipped   SkippedRules     `json:"skipped" gorm:"type:text"`
+	Revisions RuleSetRevisions `json:"revisions" gorm:"type:text"`
+}
+
+// RuleSetRevisions maps the rules of a rule set to their revision.
+type RuleSetRevisions map[uint]uint
+
+// SyncStatus tells whether the detector of every cluster acknowledged the
+// latest version of its rule set, Pending counting the notifications not
+// delivered yet.
+type SyncStatus struct {
+	InSync   bool                `json:"in_sync"`
+	Pending  int                 `json:"pending"`
+	Clusters []ClusterSyncStatus `json:"clusters"`
+}
+
+// ClusterSyncStatus tells which version of the rule set the detector of a
+// cluster has acknowledged and how delivery of the pending versions is going.
+type ClusterSyncStatus struct {
+	Cluster             string `json:"cluster"`
+	Version             uint   `json:"version"`
+	AcknowledgedVersion uint   `json:"acknowledged_version"`
+	AcknowledgedTime    int64  `json:"acknowledged_time"`
+	InSync              bool   `json:"in_sync"`
+	Pending             int    `json:"pending"`
+	Attempts            int    `json:"attempts"`
+	NextAttemptTime     int64  `json:"next_attempt_time"`
+	LastError           string `json:"last_error"`
+	// Skipped are the rules left out of the acknowledged rule set
+	Skipped SkippedRules `json:"skipped"`
 }
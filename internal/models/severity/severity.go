@@ -0,0 +1,128 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package severity
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ruleTable is the table of the rules referencing severities, the rules model
+// depends on this package so it cannot be imported here
+const ruleTable = "rule"
+
+type Operator interface {
+	GetSeverities() ([]Severity, error)
+
+	CreateSeverity(severity *Severity) error
+
+	UpdateSeverity(severity *Severity) error
+
+	DeleteSeverityByID(id uint) error
+}
+
+type operator struct {
+	db *gorm.DB
+}
+
+func NewOperator(db *gorm.DB) Operator {
+	return &operator{
+		db: db.Session(&gorm.Session{}),
+	}
+}
+
+func (o *operator) GetSeverities() ([]Severity, error) {
+	var severities []Severity
+	if err := o.db.Order("`rank` desc").Find(&severities).Error; err != nil {
+		return nil, err
+	}
+	return severities, nil
+}
+
+func (o *operator) CreateSeverity(severity *Severity) error {
+	severity.ID = 0
+	severity.CreateTime = time.Now().Unix()
+	severity.UpdateTime = severity.CreateTime
+	return o.db.Create(severity).Error
+}
+
+// UpdateSeverity updates a severity, renaming it renames it on the rules
+// referencing it as well.
+func (o *operator) UpdateSeverity(severity *Severity) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var current Severity
+		if err := tx.First(&current, severity.ID).Error; err != nil {
+			return err
+		}
+
+		severity.CreateTime = current.CreateTime
+		severity.UpdateTime = time.Now().Unix()
+		if err := tx.Save(severity).Error; err != nil {
+			return err
+		}
+
+		if current.Name == severity.Name {
+			return nil
+		}
+		return tx.Table(ruleTable).Where("severity_id = ?", severity.ID).Update("severity", severity.Name).Error
+	})
+}
+
+// DeleteSeverityByID deletes a severity unless a rule still references it.
+func (o *operator) DeleteSeverityByID(id uint) error {
+	return o.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Table(ruleTable).Where("severity_id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 0 {
+			return fmt.Errorf("severity is used by %d rules", count)
+		}
+
+		result := tx.Delete(&Severity{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// Resolve looks a severity up by id, falling back to name when id is 0 or no
+// longer exists.
+func Resolve(db *gorm.DB, id uint, name string) (*Severity, error) {
+	var severities []Severity
+	if id != 0 {
+		if err := db.Where("id = ?", id).Limit(1).Find(&severities).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(severities) == 0 {
+		if err := db.Where("name = ?", name).Limit(1).Find(&severities).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if len(severities) == 0 {
+		return nil, fmt.Errorf("unknown severity %s", name)
+	}
+	return &severities[0], nil
+}
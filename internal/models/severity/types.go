@@ -0,0 +1,44 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package severity
+
+const (
+	NotificationPolicyNone   = "none"
+	NotificationPolicyNotify = "notify"
+	NotificationPolicyPage   = "page"
+)
+
+var NotificationPolicies = []string{NotificationPolicyNone, NotificationPolicyNotify, NotificationPolicyPage}
+
+// Severity is referenced by rules. Rank orders severities, the higher the
+// rank the more severe.
+type Severity struct {
+	ID                 uint   `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name               string `json:"name" gorm:"unique;not null"`
+	Rank               int    `json:"rank" gorm:"not null"`
+	Color              string `json:"color" gorm:"not null"`
+	NotificationPolicy string `json:"notification_policy" gorm:"not null"`
+	CreateTime         int64  `json:"create_time" gorm:"not null"`
+	UpdateTime         int64  `json:"update_time" gorm:"not null"`
+}
+
+// Defaults are the severities seeded into an empty table.
+var Defaults = []Severity{
+	{Name: "warning", Rank: 10, Color: "#faad14", NotificationPolicy: NotificationPolicyNotify},
+	{Name: "error", Rank: 20, Color: "#fa541c", NotificationPolicy: NotificationPolicyNotify},
+	{Name: "critical", Rank: 30, Color: "#f5222d", NotificationPolicy: NotificationPolicyPage},
+}
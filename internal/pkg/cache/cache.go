@@ -0,0 +1,198 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package cache caches the responses of the detector and of prometheus in
+// memory. Concurrent requests for the same key share one upstream call.
+package cache
+
+import (
+	"context"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups, by cache and result (hit, miss or coalesced).",
+	}, []string{"cache", "result"})
+
+	cacheEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "cpds_analyzer",
+		Subsystem: "cache",
+		Name:      "entries",
+		Help:      "Entries held, by cache.",
+	}, []string{"cache"})
+)
+
+// sweepInterval is how often the expired entries are removed
+const sweepInterval = time.Minute
+
+// Cache is safe for concurrent use. Errors are never cached.
+type Cache struct {
+	name string
+	now  func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]entry
+	calls     map[string]*call
+	lastSweep time.Time
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// call is a load in flight, done is closed once it returns. The load is
+// cancelled once every caller waiting on it has gone.
+type call struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// New returns an empty cache, name labels its metrics.
+func New(name string) *Cache {
+	return &Cache{
+		name:      name,
+		now:       time.Now,
+		entries:   make(map[string]entry),
+		calls:     make(map[string]*call),
+		lastSweep: time.Now(),
+	}
+}
+
+// Get returns the value of key, calling load when it is missing or expired
+// and keeping its value for ttl. A ttl of zero or less disables caching but
+// still coalesces concurrent loads. A caller whose ctx is done stops waiting,
+// the load is only cancelled when no caller waits on it anymore. The value is
+// shared by every caller, which must not modify it.
+func (c *Cache) Get(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && c.now().Before(e.expires) {
+		c.mu.Unlock()
+		cacheRequests.WithLabelValues(c.name, "hit").Inc()
+		return e.value, nil
+	}
+	if cl, ok := c.calls[key]; ok {
+		cl.waiters++
+		c.mu.Unlock()
+		cacheRequests.WithLabelValues(c.name, "coalesced").Inc()
+		return c.wait(ctx, key, cl)
+	}
+	loadCtx, cancel := context.WithCancel(context.Background())
+	cl := &call{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	c.calls[key] = cl
+	c.mu.Unlock()
+	cacheRequests.WithLabelValues(c.name, "miss").Inc()
+
+	go c.load(loadCtx, key, ttl, cl, load)
+	return c.wait(ctx, key, cl)
+}
+
+func (c *Cache) wait(ctx context.Context, key string, cl *call) (interface{}, error) {
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl.waiters--; cl.waiters == 0 {
+		cl.cancel()
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+	}
+	return nil, ctx.Err()
+}
+
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, cl *call, load func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			cl.value, cl.err = nil, fmt.Errorf("cache: load panicked: %v", r)
+		}
+
+		c.mu.Lock()
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+			if cl.err == nil && ttl > 0 {
+				now := c.now()
+				c.entries[key] = entry{value: cl.value, expires: now.Add(ttl)}
+				c.sweep(now)
+			}
+		}
+		cacheEntries.WithLabelValues(c.name).Set(float64(len(c.entries)))
+		c.mu.Unlock()
+
+		cl.cancel()
+		close(cl.done)
+	}()
+
+	cl.value, cl.err = load(ctx)
+}
+
+// sweep removes the expired entries at most every sweepInterval, the caller
+// holds the lock.
+func (c *Cache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < sweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// TTL parses a duration of the cache options, an invalid one disabling
+// caching. The options are validated on startup.
+func TTL(duration string) time.Duration {
+	d, err := timeutil.ParseDuration(duration)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// AlignRange rounds start and end down to a multiple of step, so that range
+// queries made at different times over the same window share a key.
+func AlignRange(start, end, step int64) (int64, int64) {
+	if step <= 0 {
+		return start, end
+	}
+	return start - mod(start, step), end - mod(end, step)
+}
+
+func mod(a, b int64) int64 {
+	if m := a % b; m >= 0 {
+		return m
+	}
+	return a%b + b
+}
@@ -0,0 +1,142 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := New("test")
+	c.now = func() time.Time { return now }
+
+	var loads int32
+	load := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return "value", nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if v, err := c.Get(context.Background(), "key", time.Second, load); err != nil || v != "value" {
+			t.Fatalf("Get() = %v, %v", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loaded %d times, want 1", loads)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := c.Get(context.Background(), "key", time.Second, load); err != nil || loads != 2 {
+		t.Fatalf("expired entry not reloaded: loads %d, err %v", loads, err)
+	}
+
+	failing := func(context.Context) (interface{}, error) { return nil, errors.New("boom") }
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(context.Background(), "error", time.Second, failing); err == nil {
+			t.Fatal("Get() returned no error")
+		}
+	}
+	if _, ok := c.entries["error"]; ok {
+		t.Fatal("error cached")
+	}
+}
+
+func TestCacheCoalesces(t *testing.T) {
+	c := New("test")
+
+	var loads int32
+	release := make(chan struct{})
+	load := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(context.Background(), "key", time.Minute, load); err != nil || v != 42 {
+				t.Errorf("Get() = %v, %v", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Fatalf("loaded %d times, want 1", loads)
+	}
+
+	if _, err := c.Get(context.Background(), "uncached", 0, func(context.Context) (interface{}, error) { return 1, nil }); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, ok := c.entries["uncached"]; ok {
+		t.Fatal("cached with a ttl of zero")
+	}
+}
+
+func TestCacheCancels(t *testing.T) {
+	c := New("test")
+
+	cancelled := make(chan struct{})
+	load := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.Get(ctx, "key", time.Minute, load); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get() error = %v, want %v", err, context.Canceled)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("load not cancelled once its caller had gone")
+	}
+}
+
+func TestAlignRange(t *testing.T) {
+	tests := []struct {
+		start, end, step int64
+		wantStart        int64
+		wantEnd          int64
+	}{
+		{105, 219, 60, 60, 180},
+		{120, 240, 60, 120, 240},
+		{105, 219, 0, 105, 219},
+		{-30, 30, 60, -60, 0},
+	}
+	for _, tt := range tests {
+		start, end := AlignRange(tt.start, tt.end, tt.step)
+		if start != tt.wantStart || end != tt.wantEnd {
+			t.Errorf("AlignRange(%d, %d, %d) = %d, %d, want %d, %d", tt.start, tt.end, tt.step, start, end, tt.wantStart, tt.wantEnd)
+		}
+	}
+}
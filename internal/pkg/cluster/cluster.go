@@ -0,0 +1,140 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package cluster is the clusters the analyzer manages, each with its own
+// detector and datasource.
+package cluster
+
+import (
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	detectorconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultName is the name of the cluster of a configuration without clusters.
+const DefaultName = "default"
+
+// ErrUnknown is returned when selecting a cluster not in the configuration.
+var ErrUnknown = errors.New("unknown cluster")
+
+// Cluster is a cluster the analyzer manages.
+type Cluster struct {
+	Name       string
+	Detector   *detectorconfig.Options
+	Datasource *datasource.Options
+}
+
+// Clusters is the clusters of the configuration, in order.
+type Clusters []Cluster
+
+// FromConfig returns the clusters of the configuration. Without clusters, the
+// analyzer manages a single cluster named DefaultName through the detector
+// and datasource sections.
+func FromConfig(conf *config.Config) Clusters {
+	if len(conf.Clusters) == 0 {
+		return Clusters{{
+			Name:       DefaultName,
+			Detector:   conf.DetectorOptions,
+			Datasource: conf.DatasourceOptions,
+		}}
+	}
+
+	clusters := make(Clusters, 0, len(conf.Clusters))
+	for _, c := range conf.Clusters {
+		detector := *detectorconfig.NewDetectorOptions()
+		if conf.DetectorOptions != nil {
+			detector = *conf.DetectorOptions
+		}
+		detector.Host = c.Host
+		detector.Port = c.Port
+
+		clusters = append(clusters, Cluster{
+			Name:       c.Name,
+			Detector:   &detector,
+			Datasource: c.DatasourceOptions(),
+		})
+	}
+	return clusters
+}
+
+// Names returns the names of the clusters.
+func (c Clusters) Names() []string {
+	names := make([]string, 0, len(c))
+	for _, cluster := range c {
+		names = append(names, cluster.Name)
+	}
+	return names
+}
+
+// Get returns the cluster named name.
+func (c Clusters) Get(name string) (Cluster, error) {
+	for _, cluster := range c {
+		if cluster.Name == name {
+			return cluster, nil
+		}
+	}
+	return Cluster{}, fmt.Errorf("%w: %s", ErrUnknown, name)
+}
+
+// Select returns the cluster named name, every cluster if name is empty.
+func (c Clusters) Select(name string) (Clusters, error) {
+	if name == "" {
+		return c, nil
+	}
+
+	cluster, err := c.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return Clusters{cluster}, nil
+}
+
+// Check returns an error if one of names is not a cluster.
+func (c Clusters) Check(names []string) error {
+	for _, name := range names {
+		if _, err := c.Get(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Each calls fn for every cluster concurrently, with the index of the
+// cluster. It returns the first error by cluster order, prefixed with the
+// name of its cluster.
+func (c Clusters) Each(fn func(i int, cluster Cluster) error) error {
+	errs := make([]error, len(c))
+
+	var wg sync.WaitGroup
+	for i := range c {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i, c[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("cluster %s: %w", c[i].Name, err)
+		}
+	}
+	return nil
+}
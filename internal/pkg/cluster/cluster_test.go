@@ -0,0 +1,88 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cluster
+
+import (
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
+	clusterconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/cluster"
+	"errors"
+	"testing"
+)
+
+func TestFromConfig(t *testing.T) {
+	conf := config.New()
+	clusters := FromConfig(conf)
+	if len(clusters) != 1 || clusters[0].Name != DefaultName || clusters[0].Detector != conf.DetectorOptions {
+		t.Fatalf("FromConfig() = %+v, want the default cluster", clusters)
+	}
+
+	conf.Clusters = clusterconfig.List{
+		{Name: "east", Host: "10.0.0.1", Port: 19092},
+		{Name: "west", Host: "10.0.0.2", Port: 19093},
+	}
+	clusters = FromConfig(conf)
+	if len(clusters) != 2 {
+		t.Fatalf("FromConfig() returned %d clusters, want 2", len(clusters))
+	}
+	west := clusters[1]
+	if west.Detector.Host != "10.0.0.2" || west.Detector.Port != 19093 || west.Detector.Timeout != conf.DetectorOptions.Timeout {
+		t.Fatalf("detector of west = %+v", west.Detector)
+	}
+	if west.Datasource == nil || west.Datasource.Type != "detector" {
+		t.Fatalf("datasource of west = %+v", west.Datasource)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	clusters := Clusters{{Name: "east"}, {Name: "west"}}
+
+	if selected, err := clusters.Select(""); err != nil || len(selected) != 2 {
+		t.Fatalf("Select(\"\") = %v, %v", selected, err)
+	}
+	if selected, err := clusters.Select("west"); err != nil || len(selected) != 1 || selected[0].Name != "west" {
+		t.Fatalf("Select(west) = %v, %v", selected, err)
+	}
+	if _, err := clusters.Select("north"); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("Select(north) error = %v, want ErrUnknown", err)
+	}
+	if err := clusters.Check([]string{"east", "north"}); !errors.Is(err, ErrUnknown) {
+		t.Fatalf("Check() error = %v, want ErrUnknown", err)
+	}
+}
+
+func TestEach(t *testing.T) {
+	clusters := Clusters{{Name: "east"}, {Name: "west"}}
+
+	seen := make([]string, len(clusters))
+	if err := clusters.Each(func(i int, c Cluster) error {
+		seen[i] = c.Name
+		return nil
+	}); err != nil || seen[0] != "east" || seen[1] != "west" {
+		t.Fatalf("Each() = %v, visited %v", err, seen)
+	}
+
+	boom := errors.New("boom")
+	err := clusters.Each(func(i int, c Cluster) error {
+		if c.Name == "west" {
+			return boom
+		}
+		return nil
+	})
+	if !errors.Is(err, boom) || err.Error() != "cluster west: boom" {
+		t.Fatalf("Each() error = %v", err)
+	}
+}
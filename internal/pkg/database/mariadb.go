@@ -17,7 +17,10 @@
 package database
 
 import (
+	"cpds/cpds-analyzer/internal/models/analysis"
 	"cpds/cpds-analyzer/internal/models/rules"
+	"cpds/cpds-analyzer/internal/models/severity"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -34,17 +37,143 @@ func New(db *gorm.DB) Database {
 
 func (m *mariadb) Init() error {
 	ruleTableExists := m.db.Migrator().HasTable(&rules.Rule{})
+	// The analysis table is written by the detector, the analyzer only adds
+	// its own columns to it. AutoMigrate adds missing columns and indexes and
+	// never drops or narrows one, and every column the analyzer adds has a
+	// default, so rows inserted by the detector without them stay valid.
+	if err := m.db.AutoMigrate(&severity.Severity{}, &rules.Rule{}, &rules.RuleRevision{}, &rules.RuleNotification{}, &analysis.Analysis{}, &analysis.AnalysisEvent{}, &analysis.AnalysisOccurrence{}, &analysis.AnalysisArchive{}, &analysis.Incident{}); err != nil {
+		return err
+	}
+
 	if !ruleTableExists {
-		if err := m.db.AutoMigrate(&rules.Rule{}); err != nil {
-			return err
-		}
 		m.db.Exec(`LOCK TABLES rule WRITE;`)
 		if err := m.db.Exec(`
-			INSERT INTO rule VALUES (1,'pod_breakdown','((sum(count_over_time(cpds_pod_state[30s])) by (name,instance) >=14) and sum(cpds_pod_state) by (name,instance)==0)*0 +on(name) group_right cpds_pod_state','',0,'==',0,'critical','1m',1690340685,1690340685),(2,'pod_network_timeout','increase(cpds_pod_ping_rtt_total[1m])/(increase(cpds_pod_ping_recv_count_total[1m])>0)','',0,'>',0.2,'critical','1m',1690340685,1690340685),(3,'pod_network_packet_loss','clamp_min(1-increase(cpds_pod_ping_recv_count_total[1m])/increase(cpds_pod_ping_send_count_total[1m]),0)','',0,'>',0.1,'critical','1m',1690340685,1690340685),(4,'cpu_usage','1-sum(irate(cpds_node_cpu_seconds_total{cpu!=\"cpu\", mode=\"idle\"}[1m])) by (instance)/sum (irate(cpds_node_cpu_seconds_total{cpu!=\"cpu\"}[1m])) by (instance)','',0,'>',0.85,'critical','1m',1690340685,1693380064),(5,'memory_usage','cpds_node_memory_usage_bytes / cpds_node_memory_total_bytes','',0,'>',0.7,'critical','1m',1690340685,1693380136),(6,'root_disk','sum(cpds_node_fs_usage_bytes{mount=\"/\"}) by (instance)/(sum(cpds_node_fs_usage_bytes{mount=\"/\"}) by (instance)+sum(cpds_node_fs_available_bytes{mount=\"/\"}) by (instance))','',0,'>',0.8,'critical','1m',1690340685,1693380244),(7,'lvm','cpds_node_lvm_state','',0,'!=',1,'critical','1m',1690340685,1693380294),(8,'container_memory_request_failed','increase(cpds_container_alloc_memory_fail_cnt_total[5m])','',0,'>',0,'critical','1m',1690340685,1693380355),(9,'container_zombie_process','cpds_container_sub_process_info{zombie=\"true\"}','',0,'==',1,'critical','1m',1690340685,1693380399),(10,'container_process_fail','increase(cpds_container_create_process_fail_cnt_total[10s])','',0,'>',0,'critical','1m',1690340685,1693380447),(11,'container_thread_fail','increase(cpds_container_create_thread_fail_cnt_total[10s])','',0,'>',0,'critical','1m',1690340685,1693380485),(12,'disk_usage','sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_usage_bytes) by (instance)/(sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_usage_bytes) by (instance)+sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_available_bytes) by (instance))','',0,'>',0.85,'critical','1m',1690340685,1693380641),(13,'network_failure','cpds_node_network_up','',0,'!=',1,'critical','1m',1690340685,1693380676),(14,'container_breakdown','cpds_container_state{exit_code!=\"0\"}','',0,'==',1,'critical','1m',1690340685,1693380718),(15,'container_memory_request_timeout','increase(cpds_container_alloc_memory_time_seconds_total[10s])/(increase(cpds_container_alloc_memory_count_total[10s])>0)','',0,'>',0.000009,'critical','1m',1690340685,1693380820),(16,'docker_service','cpds_container_service_docker_status','',0,'!=',1,'critical','1m',1690340685,1693380855),(17,'node_etcd_service','absent(absent(cpds_agent_alive_count{instance=\"ip:port\"}>15))  and absent(cpds_pod_state{name=~\"etcd.*\",instance=\"ip:port\"}==1) and absent(cpds_container_service_etcd_status{instance=\"ip:port\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388308),(18,'journald','cpds_systemd_journald_status','',0,'!=',1,'critical','1m',1690340685,1693381550),(19,'Kernel_Crash','time()-cpds_kernel_crash','',0,'<',86400,'critical','1m',1690340685,1693381609),(20,'kubelet_service','cpds_container_service_kubelet_status','',0,'!=',1,'critical','1m',1690340685,1693381643),(21,'node_kube_apiserver','absent(absent(cpds_agent_alive_count{instance=\"ip:port\"}>15)) and absent(cpds_pod_state{name=~\"kube-apiserver.*\",instance=\"ip:port\"}==1) and absent(cpds_container_service_kube_apiserver_status{instance=\"ip:port\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388336),(22,'node_kube_controller_manager','absent(absent(cpds_agent_alive_count{instance=\"ip:port\"}>15)) and absent(cpds_pod_state{name=~\"kube-controller-manager.*\",instance=\"ip:port\"}==1) and absent(cpds_container_service_kube_controller_manager_status{instance=\"ip:port\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388314),(23,'node_kube_proxy','absent(absent(cpds_agent_alive_count{instance=\"ip:port\"}>15)) and absent(cpds_pod_state{name=~\"kube-proxy.*\",instance=\"ip:port\"}==1) and absent(cpds_container_service_kube_proxy_status{instance=\"ip:port\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388385),(24,'container_disk_iodelay','rate(cpds_container_disk_iodelay_total[10s])','',0,'>',50,'critical','1m',1690340685,1693381688),(25,'node_kube_scheduler','absent(absent(cpds_agent_alive_count{instance=\"ip:port\"}>15)) and absent(cpds_pod_state{name=~\"kube-scheduler.*\",instance=\"ip:port\"}==1) and absent(cpds_container_service_kube_scheduler_status{instance=\"ip:port\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388413),(26,'container_network_packet_loss','clamp_min(1-increase(cpds_container_ping_recv_count_total[1m])/increase(cpds_container_ping_send_count_total[1m]),0)','',0,'>',0.1,'critical','1m',1690340685,1693381758),(27,'container_network_timeout','increase(cpds_container_ping_rtt_total[1m])/(increase(cpds_container_ping_recv_count_total[1m])>0)','',0,'>',0.2,'critical','1m',1690340685,1693381814),(28,'network_packets_loss','clamp_min(1-(increase(cpds_node_ping_recv_count_total[1m])/increase(cpds_node_ping_send_count_total[1m])),0)','',0,'>',0.1,'critical','1m',1690340685,1690340700),(29,'network_recive_error_rate','sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)/(sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_packets_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)+sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance))','',0,'>',0,'critical','1m',1690340685,1693382300),(30,'network_transmit_error_rate','sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)/(sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_packets_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)+sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance))','',0,'>',0,'critical','1m',1690340685,1693382393);
+			INSERT INTO rule (id,name,expression,subhealth_condition_type,subhealth_thresholds,fault_condition_type,fault_thresholds,severity,duration,create_time,update_time) VALUES (1,'pod_breakdown','((sum(count_over_time(cpds_pod_state[30s])) by (name,instance) >=14) and sum(cpds_pod_state) by (name,instance)==0)*0 +on(name) group_right cpds_pod_state','',0,'==',0,'critical','1m',1690340685,1690340685),(2,'pod_network_timeout','increase(cpds_pod_ping_rtt_total[1m])/(increase(cpds_pod_ping_recv_count_total[1m])>0)','',0,'>',0.2,'critical','1m',1690340685,1690340685),(3,'pod_network_packet_loss','clamp_min(1-increase(cpds_pod_ping_recv_count_total[1m])/increase(cpds_pod_ping_send_count_total[1m]),0)','',0,'>',0.1,'critical','1m',1690340685,1690340685),(4,'cpu_usage','1-sum(irate(cpds_node_cpu_seconds_total{cpu!=\"cpu\", mode=\"idle\"}[1m])) by (instance)/sum (irate(cpds_node_cpu_seconds_total{cpu!=\"cpu\"}[1m])) by (instance)','',0,'>',0.85,'critical','1m',1690340685,1693380064),(5,'memory_usage','cpds_node_memory_usage_bytes / cpds_node_memory_total_bytes','',0,'>',0.7,'critical','1m',1690340685,1693380136),(6,'root_disk','sum(cpds_node_fs_usage_bytes{mount=\"/\"}) by (instance)/(sum(cpds_node_fs_usage_bytes{mount=\"/\"}) by (instance)+sum(cpds_node_fs_available_bytes{mount=\"/\"}) by (instance))','',0,'>',0.8,'critical','1m',1690340685,1693380244),(7,'lvm','cpds_node_lvm_state','',0,'!=',1,'critical','1m',1690340685,1693380294),(8,'container_memory_request_failed','increase(cpds_container_alloc_memory_fail_cnt_total[5m])','',0,'>',0,'critical','1m',1690340685,1693380355),(9,'container_zombie_process','cpds_container_sub_process_info{zombie=\"true\"}','',0,'==',1,'critical','1m',1690340685,1693380399),(10,'container_process_fail','increase(cpds_container_create_process_fail_cnt_total[10s])','',0,'>',0,'critical','1m',1690340685,1693380447),(11,'container_thread_fail','increase(cpds_container_create_thread_fail_cnt_total[10s])','',0,'>',0,'critical','1m',1690340685,1693380485),(12,'disk_usage','sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_usage_bytes) by (instance)/(sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_usage_bytes) by (instance)+sum(cpds_node_blk_total_bytes{mount=~\".+\"}*0 + on(mount,instance) group_right cpds_node_fs_available_bytes) by (instance))','',0,'>',0.85,'critical','1m',1690340685,1693380641),(13,'network_failure','cpds_node_network_up','',0,'!=',1,'critical','1m',1690340685,1693380676),(14,'container_breakdown','cpds_container_state{exit_code!=\"0\"}','',0,'==',1,'critical','1m',1690340685,1693380718),(15,'container_memory_request_timeout','increase(cpds_container_alloc_memory_time_seconds_total[10s])/(increase(cpds_container_alloc_memory_count_total[10s])>0)','',0,'>',0.000009,'critical','1m',1690340685,1693380820),(16,'docker_service','cpds_container_service_docker_status','',0,'!=',1,'critical','1m',1690340685,1693380855),(17,'node_etcd_service','absent(absent(cpds_agent_alive_count{instance=\"{{ .instance }}\"}>15))  and absent(cpds_pod_state{name=~\"etcd.*\",instance=\"{{ .instance }}\"}==1) and absent(cpds_container_service_etcd_status{instance=\"{{ .instance }}\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388308),(18,'journald','cpds_systemd_journald_status','',0,'!=',1,'critical','1m',1690340685,1693381550),(19,'Kernel_Crash','time()-cpds_kernel_crash','',0,'<',86400,'critical','1m',1690340685,1693381609),(20,'kubelet_service','cpds_container_service_kubelet_status','',0,'!=',1,'critical','1m',1690340685,1693381643),(21,'node_kube_apiserver','absent(absent(cpds_agent_alive_count{instance=\"{{ .instance }}\"}>15)) and absent(cpds_pod_state{name=~\"kube-apiserver.*\",instance=\"{{ .instance }}\"}==1) and absent(cpds_container_service_kube_apiserver_status{instance=\"{{ .instance }}\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388336),(22,'node_kube_controller_manager','absent(absent(cpds_agent_alive_count{instance=\"{{ .instance }}\"}>15)) and absent(cpds_pod_state{name=~\"kube-controller-manager.*\",instance=\"{{ .instance }}\"}==1) and absent(cpds_container_service_kube_controller_manager_status{instance=\"{{ .instance }}\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388314),(23,'node_kube_proxy','absent(absent(cpds_agent_alive_count{instance=\"{{ .instance }}\"}>15)) and absent(cpds_pod_state{name=~\"kube-proxy.*\",instance=\"{{ .instance }}\"}==1) and absent(cpds_container_service_kube_proxy_status{instance=\"{{ .instance }}\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388385),(24,'container_disk_iodelay','rate(cpds_container_disk_iodelay_total[10s])','',0,'>',50,'critical','1m',1690340685,1693381688),(25,'node_kube_scheduler','absent(absent(cpds_agent_alive_count{instance=\"{{ .instance }}\"}>15)) and absent(cpds_pod_state{name=~\"kube-scheduler.*\",instance=\"{{ .instance }}\"}==1) and absent(cpds_container_service_kube_scheduler_status{instance=\"{{ .instance }}\"}==1)','',0,'==',1,'critical','1m',1690340685,1693388413),(26,'container_network_packet_loss','clamp_min(1-increase(cpds_container_ping_recv_count_total[1m])/increase(cpds_container_ping_send_count_total[1m]),0)','',0,'>',0.1,'critical','1m',1690340685,1693381758),(27,'container_network_timeout','increase(cpds_container_ping_rtt_total[1m])/(increase(cpds_container_ping_recv_count_total[1m])>0)','',0,'>',0.2,'critical','1m',1690340685,1693381814),(28,'network_packets_loss','clamp_min(1-(increase(cpds_node_ping_recv_count_total[1m])/increase(cpds_node_ping_send_count_total[1m])),0)','',0,'>',0.1,'critical','1m',1690340685,1690340700),(29,'network_recive_error_rate','sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)/(sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_packets_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)+sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_receive_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance))','',0,'>',0,'critical','1m',1690340685,1693382300),(30,'network_transmit_error_rate','sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)/(sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_packets_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance)+sum(cpds_node_network_info{mask=~".+"}*0+on(interface,instance) group_right sum(increase(cpds_node_network_transmit_errors_total{interface!~"lo|bond[0-9]|cbr[0-9]|veth.*|vir.*|docker.*|vnet.*|br.*|tap.*|tunl.*"}[1m])) by (instance,interface)) by (instance))','',0,'>',0,'critical','1m',1690340685,1693382393);
 		`).Error; err != nil {
 			return err
 		}
 		m.db.Exec(`UNLOCK TABLES;`)
+
+		// node rules are declared once and expanded for every monitored node,
+		// the control-plane ones only for the control-plane nodes
+		if err := m.db.Model(&rules.Rule{}).
+			Where("expression LIKE ?", "%{{ .instance }}%").
+			Update("parameters", rules.RuleParameters{{Name: "instance", Source: rules.ParameterSourceTargets}}).Error; err != nil {
+			return err
+		}
+		if err := m.db.Model(&rules.Rule{}).
+			Where("name IN ?", seedControlPlaneRules).
+			Update("parameters", rules.RuleParameters{{Name: "instance", Source: rules.ParameterSourceQuery, Query: controlPlaneNodesQuery}}).Error; err != nil {
+			return err
+		}
+
+		for group, names := range seedRuleGroups {
+			if err := m.db.Model(&rules.Rule{}).
+				Where("name IN ?", names).
+				Update("labels", rules.RuleLabels{"group": group}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := m.initSeverities(); err != nil {
+		return err
+	}
+
+	return m.initRuleRevisions()
+}
+
+// initSeverities seeds the default severities into an empty table and links
+// the rules that only have a severity name to their severity.
+func (m *mariadb) initSeverities() error {
+	var count int64
+	if err := m.db.Model(&severity.Severity{}).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		now := time.Now().Unix()
+		defaults := make([]severity.Severity, len(severity.Defaults))
+		copy(defaults, severity.Defaults)
+		for i := range defaults {
+			defaults[i].CreateTime = now
+			defaults[i].UpdateTime = now
+		}
+		if err := m.db.Create(&defaults).Error; err != nil {
+			return err
+		}
+	}
+
+	var severities []severity.Severity
+	if err := m.db.Find(&severities).Error; err != nil {
+		return err
+	}
+	for _, s := range severities {
+		if err := m.db.Model(&rules.Rule{}).
+			Where("severity = ? AND severity_id = 0", s.Name).
+			Update("severity_id", s.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedControlPlaneRules are the seeded rules checking a component that only
+// runs on control-plane nodes
+var seedControlPlaneRules = []string{
+	"node_etcd_service", "node_kube_apiserver", "node_kube_controller_manager", "node_kube_scheduler",
+}
+
+// controlPlaneNodesQuery selects the nodes that ran a control-plane component,
+// as a pod or as a service, during the last day
+const controlPlaneNodesQuery = `count by (instance) (` +
+	`max_over_time(cpds_pod_state{name=~"(etcd|kube-apiserver|kube-controller-manager|kube-scheduler).*"}[1d]) == 1` +
+	` or max_over_time(cpds_container_service_etcd_status[1d]) == 1` +
+	` or max_over_time(cpds_container_service_kube_apiserver_status[1d]) == 1` +
+	` or max_over_time(cpds_container_service_kube_controller_manager_status[1d]) == 1` +
+	` or max_over_time(cpds_container_service_kube_scheduler_status[1d]) == 1)`
+
+// seedRuleGroups assigns the seeded rules to a group label
+var seedRuleGroups = map[string][]string{
+	"node": {
+		"cpu_usage", "memory_usage", "root_disk", "lvm", "disk_usage", "journald", "Kernel_Crash",
+	},
+	"container": {
+		"pod_breakdown", "container_memory_request_failed", "container_zombie_process", "container_process_fail",
+		"container_thread_fail", "container_breakdown", "container_memory_request_timeout", "docker_service",
+		"container_disk_iodelay",
+	},
+	"network": {
+		"pod_network_timeout", "pod_network_packet_loss", "network_failure", "container_network_packet_loss",
+		"container_network_timeout", "network_packets_loss", "network_recive_error_rate", "network_transmit_error_rate",
+	},
+	"control-plane": {
+		"node_etcd_service", "kubelet_service", "node_kube_apiserver", "node_kube_controller_manager",
+		"node_kube_proxy", "node_kube_scheduler",
+	},
+}
+
+// initRuleRevisions records the first revision of rules that were seeded or
+// created before rule versioning existed.
+func (m *mariadb) initRuleRevisions() error {
+	var unversioned []rules.Rule
+	if err := m.db.Where("revision = ?", 0).Find(&unversioned).Error; err != nil {
+		return err
+	}
+
+	for i := range unversioned {
+		rule := &unversioned[i]
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			rule.Revision = 1
+			if err := tx.Model(rule).Update("revision", rule.Revision).Error; err != nil {
+				return err
+			}
+			return rules.RecordRevision(tx, rule, rules.RevisionActionCreate)
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,288 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package detector is the client of the detector api.
+package detector
+
+import (
+	"bytes"
+	"context"
+	detectorconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
+	"cpds/cpds-analyzer/pkg/prometheus"
+	timeutil "cpds/cpds-analyzer/pkg/utils/time"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// defaultTimeout bounds the attempts of a request when the options have
+	// no valid timeout
+	defaultTimeout = 10 * time.Second
+
+	retryMinBackoff = 200 * time.Millisecond
+	retryMaxBackoff = 5 * time.Second
+)
+
+// Client calls the detector. Requests are cancelled along with ctx, every
+// attempt is bounded by the timeout of the options and requests failing to
+// reach the detector, or answered with 502, 503 or 504, are retried.
+type Client interface {
+	// RuleUpdated sends the detector the rules to evaluate from now on.
+	RuleUpdated(ctx context.Context, rules *RuleSet) error
+
+	GetMonitorTargets(ctx context.Context) (*MonitorTargets, error)
+
+	GetNodeInfo(ctx context.Context, instance string) ([]NodeInfo, error)
+
+	GetNodeStatus(ctx context.Context, instance string) ([]NodeStatus, error)
+
+	GetNodeContainerStatus(ctx context.Context, instance string) ([]prometheus.Metric, error)
+
+	GetNodeResources(ctx context.Context, instance string, r RangeRequest) ([]prometheus.Metric, error)
+
+	GetClusterResources(ctx context.Context, r RangeRequest) ([]prometheus.Metric, error)
+
+	GetClusterContainerStatus(ctx context.Context, r RangeRequest) ([]prometheus.Metric, error)
+
+	Query(ctx context.Context, q QueryRequest) (*prometheus.MetricData, error)
+
+	QueryRange(ctx context.Context, q QueryRangeRequest) (*prometheus.MetricData, error)
+}
+
+type client struct {
+	baseURL string
+	http    *http.Client
+	retries int
+}
+
+// NewClient returns a client of the detector of the options, the default
+// detector if nil.
+func NewClient(options *detectorconfig.Options) Client {
+	if options == nil {
+		options = detectorconfig.NewDetectorOptions()
+	}
+
+	timeout, err := timeutil.ParseDuration(options.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	return &client{
+		baseURL: fmt.Sprintf("http://%s/api/v1", Address(options)),
+		http:    &http.Client{Timeout: timeout},
+		retries: options.Retries,
+	}
+}
+
+// Address returns the host:port of the detector of the options, the default
+// detector if nil.
+func Address(options *detectorconfig.Options) string {
+	if options == nil {
+		options = detectorconfig.NewDetectorOptions()
+	}
+	return net.JoinHostPort(options.Host, strconv.Itoa(options.Port))
+}
+
+// RuleUpdated posts the rule set. Detectors predating rule sets only know the
+// bodyless GET notification, after which they read the rule table: they are
+// notified that way when they do not accept the post.
+func (c *client) RuleUpdated(ctx context.Context, rules *RuleSet) error {
+	err := c.post(ctx, "/rule_updated", rules, nil)
+	var e *Error
+	if errors.As(err, &e) && (e.Status == http.StatusNotFound || e.Status == http.StatusMethodNotAllowed) {
+		return c.get(ctx, "/rule_updated", nil, nil)
+	}
+	return err
+}
+
+func (c *client) GetMonitorTargets(ctx context.Context) (*MonitorTargets, error) {
+	var targets MonitorTargets
+	if err := c.get(ctx, "/monitor/targets", nil, &targets); err != nil {
+		return nil, err
+	}
+	return &targets, nil
+}
+
+func (c *client) GetNodeInfo(ctx context.Context, instance string) ([]NodeInfo, error) {
+	var info []NodeInfo
+	if err := c.get(ctx, "/monitor/node_info", instanceValues(instance), &info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (c *client) GetNodeStatus(ctx context.Context, instance string) ([]NodeStatus, error) {
+	var status []NodeStatus
+	if err := c.get(ctx, "/monitor/node_status", instanceValues(instance), &status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *client) GetNodeContainerStatus(ctx context.Context, instance string) ([]prometheus.Metric, error) {
+	return c.getMetrics(ctx, "/monitor/node_container_status", instanceValues(instance))
+}
+
+func (c *client) GetNodeResources(ctx context.Context, instance string, r RangeRequest) ([]prometheus.Metric, error) {
+	values := r.values()
+	values.Set("instance", instance)
+	return c.getMetrics(ctx, "/monitor/node_resources", values)
+}
+
+func (c *client) GetClusterResources(ctx context.Context, r RangeRequest) ([]prometheus.Metric, error) {
+	return c.getMetrics(ctx, "/monitor/cluster_resources", r.values())
+}
+
+func (c *client) GetClusterContainerStatus(ctx context.Context, r RangeRequest) ([]prometheus.Metric, error) {
+	return c.getMetrics(ctx, "/monitor/cluster_container_status", r.values())
+}
+
+func (c *client) Query(ctx context.Context, q QueryRequest) (*prometheus.MetricData, error) {
+	var data prometheus.MetricData
+	if err := c.get(ctx, "/prometheus/query", q.values(), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (c *client) QueryRange(ctx context.Context, q QueryRangeRequest) (*prometheus.MetricData, error) {
+	var data prometheus.MetricData
+	if err := c.get(ctx, "/prometheus/query_range", q.values(), &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (c *client) getMetrics(ctx context.Context, path string, values url.Values) ([]prometheus.Metric, error) {
+	var metrics []prometheus.Metric
+	if err := c.get(ctx, path, values, &metrics); err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// get requests path, retrying the attempts that may succeed later, and
+// decodes the data of the response into out unless nil.
+func (c *client) get(ctx context.Context, path string, values url.Values, out interface{}) error {
+	return c.request(ctx, http.MethodGet, path, values, nil, out)
+}
+
+// post sends in to path encoded as json, like get.
+func (c *client) post(ctx context.Context, path string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return c.request(ctx, http.MethodPost, path, nil, body, out)
+}
+
+func (c *client) request(ctx context.Context, method, path string, values url.Values, body []byte, out interface{}) error {
+	backoff := retryMinBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.do(ctx, method, path, values, body, out)
+		if err == nil || attempt >= c.retries || !retryable(ctx, err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+func (c *client) do(ctx context.Context, method, path string, values url.Values, body []byte, out interface{}) error {
+	u := c.baseURL + path
+	if len(values) != 0 {
+		u += "?" + values.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response responseBody
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return &Error{Path: path, Status: resp.StatusCode}
+		}
+		return fmt.Errorf("detector %s: invalid response: %s", path, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || response.Status != http.StatusOK {
+		status := response.Status
+		if status == 0 {
+			status = resp.StatusCode
+		}
+		return &Error{Path: path, Status: status, Code: response.Code, Message: response.Message}
+	}
+
+	if out == nil || len(response.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("detector %s: invalid data: %s", path, err)
+	}
+	return nil
+}
+
+// retryable tells whether a failed attempt may succeed later: the detector
+// could not be reached or was unavailable.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Status == http.StatusBadGateway || e.Status == http.StatusServiceUnavailable || e.Status == http.StatusGatewayTimeout
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+func instanceValues(instance string) url.Values {
+	if instance == "" {
+		return nil
+	}
+	return url.Values{"instance": []string{instance}}
+}
@@ -0,0 +1,157 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package detector
+
+import (
+	"context"
+	detectorconfig "cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := detectorconfig.NewDetectorOptions()
+	options.Host = host
+	options.Port, _ = strconv.Atoi(port)
+	options.Retries = 1
+	return NewClient(options)
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/monitor/node_status" || r.URL.Query().Get("instance") != "node 1" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"status":200,"code":0,"data":[{"instance":"node 1","cpu":{"usage":0.5}}]}`))
+	})
+
+	status, err := c.GetNodeStatus(context.Background(), "node 1")
+	if err != nil {
+		t.Fatalf("GetNodeStatus() error = %v", err)
+	}
+	if len(status) != 1 || status[0].Instance != "node 1" || status[0].Cpu.Usage != 0.5 {
+		t.Fatalf("GetNodeStatus() = %+v", status)
+	}
+}
+
+func TestRuleUpdated(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var rules RuleSet
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/rule_updated" || rules.Version != 3 || len(rules.Rules) != 1 {
+			t.Errorf("unexpected request %s %s %+v", r.Method, r.URL, rules)
+		}
+		w.Write([]byte(`{"status":200,"code":0}`))
+	})
+
+	err := c.RuleUpdated(context.Background(), &RuleSet{Version: 3, Rules: []Rule{{ID: 1, Name: "lvm"}}})
+	if err != nil {
+		t.Fatalf("RuleUpdated() error = %v", err)
+	}
+}
+
+func TestRuleUpdatedLegacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		methods string
+	}{
+		{"not found", http.StatusNotFound, "POST GET "},
+		{"method not allowed", http.StatusMethodNotAllowed, "POST GET "},
+		{"bad request", http.StatusBadRequest, "POST "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods string
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				methods += r.Method + " "
+				if r.Method == http.MethodPost {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`404 page not found`))
+					return
+				}
+				w.Write([]byte(`{"status":200,"code":0}`))
+			})
+
+			err := c.RuleUpdated(context.Background(), &RuleSet{Version: 3})
+			if methods != tt.methods {
+				t.Errorf("requests = %q, want %q", methods, tt.methods)
+			}
+			if fellBack := tt.methods != "POST "; fellBack != (err == nil) {
+				t.Errorf("RuleUpdated() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		attempts int32
+		want     int
+	}{
+		{"detector error", http.StatusOK, `{"status":400,"code":4001,"message":"bad query","data":null}`, 1, http.StatusBadRequest},
+		{"unavailable", http.StatusServiceUnavailable, `upstream down`, 2, http.StatusBadGateway},
+		{"unexpected data", http.StatusOK, `{"status":200,"data":{"not":"a list"}}`, 1, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := c.GetNodeInfo(context.Background(), "")
+			if err == nil {
+				t.Fatal("GetNodeInfo() returned no error")
+			}
+			if attempts != tt.attempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			if got := HTTPStatus(err, http.StatusInternalServerError); got != tt.want {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", err, got, tt.want)
+			}
+		})
+	}
+
+	var e *Error
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":500,"code":3001,"message":"no such instance"}`))
+	})
+	if _, err := c.GetMonitorTargets(context.Background()); !errors.As(err, &e) || e.Code != 3001 || e.Message != "no such instance" {
+		t.Fatalf("GetMonitorTargets() error = %v, want the detector error", err)
+	}
+}
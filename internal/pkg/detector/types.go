@@ -0,0 +1,190 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package detector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// responseBody is the envelope of every response of the detector.
+type responseBody struct {
+	Status  int             `json:"status"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Error is a request the detector answered with an error, Status and Code
+// being the ones of the detector.
+type Error struct {
+	Path    string
+	Status  int
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	message := e.Message
+	if message == "" {
+		message = http.StatusText(e.Status)
+	}
+	if e.Code != 0 {
+		return fmt.Sprintf("detector %s: %s (status %d, code %d)", e.Path, message, e.Status, e.Code)
+	}
+	return fmt.Sprintf("detector %s: %s (status %d)", e.Path, message, e.Status)
+}
+
+// HTTPStatus returns the status to answer a request that failed with err
+// with: 504 when the detector timed out, 400 when it rejected the request, 502
+// when it could not be reached or answered with another error and fallback
+// for errors not coming from the detector.
+func HTTPStatus(err error, fallback int) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return http.StatusGatewayTimeout
+		}
+		return http.StatusBadGateway
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		if e.Status == http.StatusBadRequest {
+			return http.StatusBadRequest
+		}
+		return http.StatusBadGateway
+	}
+	return fallback
+}
+
+// RangeRequest is a range of unix times, with a step in seconds.
+type RangeRequest struct {
+	StartTime int64
+	EndTime   int64
+	Step      int64
+}
+
+func (r RangeRequest) values() url.Values {
+	return url.Values{
+		"start_time": []string{strconv.FormatInt(r.StartTime, 10)},
+		"end_time":   []string{strconv.FormatInt(r.EndTime, 10)},
+		"step":       []string{strconv.FormatInt(r.Step, 10)},
+	}
+}
+
+// QueryRequest is a PromQL query at a unix time.
+type QueryRequest struct {
+	Query string
+	Time  int64
+}
+
+func (q QueryRequest) values() url.Values {
+	return url.Values{
+		"query": []string{q.Query},
+		"time":  []string{strconv.FormatInt(q.Time, 10)},
+	}
+}
+
+// QueryRangeRequest is a PromQL query over a range.
+type QueryRangeRequest struct {
+	Query string
+	RangeRequest
+}
+
+func (q QueryRangeRequest) values() url.Values {
+	values := q.RangeRequest.values()
+	values.Set("query", q.Query)
+	return values
+}
+
+// MonitorTargets, NodeInfo and NodeStatus are the monitor data of the
+// detector. Their Cluster is not part of the detector api, the analyzer sets
+// it when merging the data of several clusters.
+type MonitorTargets struct {
+	Targets []struct {
+		Instance string `json:"instance"`
+		Status   string `json:"status"`
+		Cluster  string `json:"cluster,omitempty"`
+	} `json:"targets"`
+}
+
+type NodeInfo struct {
+	Instance      string `json:"instance"`
+	Cluster       string `json:"cluster,omitempty"`
+	Arch          string `json:"arch"`
+	KernelVersion string `json:"kernal_version"`
+	OSVersion     string `json:"os_version"`
+}
+
+type NodeStatus struct {
+	Instance  string `json:"instance"`
+	Cluster   string `json:"cluster,omitempty"`
+	Container struct {
+		Running int `json:"running"`
+		Total   int `json:"total"`
+	} `json:"container"`
+	Cpu struct {
+		Usage       float64 `json:"usage"`
+		UsedCore    float64 `json:"used_core"`
+		TotalCore   float64 `json:"total_core"`
+		NumberCores float64 `json:"number_cores"`
+	} `json:"cpu"`
+	Memory struct {
+		Usage      float64 `json:"usage"`
+		UsedBytes  float64 `json:"used_bytes"`
+		TotalBytes float64 `json:"total_bytes"`
+	} `json:"memory"`
+	Disk struct {
+		Usage      float64 `json:"usage"`
+		UsedBytes  float64 `json:"used_bytes"`
+		TotalBytes float64 `json:"total_bytes"`
+	} `json:"disk"`
+}
+
+// RuleSet is the rule set the detector evaluates, sent along with every rule
+// change. Version identifies the change.
+type RuleSet struct {
+	Version uint   `json:"version"`
+	Rules   []Rule `json:"rules"`
+}
+
+// Rule is a rule as the detector evaluates it, with the columns of the rule
+// table the detector used to read. A rule with parameters is sent once per
+// combination of their values, its Arguments, with the values rendered into
+// the expression.
+type Rule struct {
+	ID                     uint              `json:"id"`
+	Name                   string            `json:"name"`
+	Expression             string            `json:"expression"`
+	SubhealthConditionType string            `json:"subhealth_condition_type"`
+	SubhealthThresholds    float64           `json:"subhealth_thresholds"`
+	FaultConditionType     string            `json:"fault_condition_type"`
+	FaultThresholds        float64           `json:"fault_thresholds"`
+	Severity               string            `json:"severity"`
+	Duration               string            `json:"duration"`
+	Arguments              map[string]string `json:"arguments,omitempty"`
+}
@@ -24,14 +24,36 @@ const (
 	SOCKET_ERROR   = 102
 	DETECTOR_ERROR = 103
 
-	RULES_GET_ERROR    = 1001
-	RULES_CREATE_ERROR = 1002
-	RULES_UPDATE_ERROR = 1003
-	RULES_DELETE_ERROR = 1004
+	RULES_GET_ERROR             = 1001
+	RULES_CREATE_ERROR          = 1002
+	RULES_UPDATE_ERROR          = 1003
+	RULES_DELETE_ERROR          = 1004
+	RULES_BACKTEST_ERROR        = 1005
+	RULES_GET_HISTORY_ERROR     = 1006
+	RULES_DIFF_ERROR            = 1007
+	RULES_ROLLBACK_ERROR        = 1008
+	RULES_EXPORT_ERROR          = 1009
+	RULES_IMPORT_ERROR          = 1010
+	RULES_EXPAND_ERROR          = 1011
+	RULES_ENABLE_ERROR          = 1012
+	RULES_DISABLE_ERROR         = 1013
+	RULES_LINT_ERROR            = 1014
+	RULES_GET_SYNC_STATUS_ERROR = 1015
 
 	ANALYSIS_GET_RESULT_ERROR    = 2001
 	ANALYSIS_DELETE_RESULT_ERROR = 2002
 	ANALYSIS_GET_RAW_DATA_ERROR  = 2003
+	ANALYSIS_ACKNOWLEDGE_ERROR   = 2004
+	ANALYSIS_UNACKNOWLEDGE_ERROR = 2005
+	ANALYSIS_ASSIGN_ERROR        = 2006
+	ANALYSIS_RESOLVE_ERROR       = 2007
+	ANALYSIS_COMMENT_ERROR       = 2008
+	ANALYSIS_GET_EVENTS_ERROR    = 2009
+	ANALYSIS_EXPORT_ERROR        = 2010
+	ANALYSIS_GET_SUMMARY_ERROR   = 2011
+	ANALYSIS_GET_STATS_ERROR     = 2012
+	ANALYSIS_GET_TIMELINE_ERROR  = 2013
+	ANALYSIS_GET_CONTEXT_ERROR   = 2014
 
 	MONITOR_GET_NODE_STATUS_ERROR              = 3001
 	MONITOR_GET_NODE_INFO_ERROR                = 3002
@@ -40,10 +62,18 @@ const (
 	MONITOR_GET_CLUSTER_RESOURCES_ERROR        = 3005
 	MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR = 3006
 	MONITOR_GET_TARGET_ERROR                   = 3007
+	MONITOR_STREAM_ERROR                       = 3008
 
 	PROMETHEUS_QUERY_ERROR          = 4001
 	PROMETHEUS_QUERY_RANGE_ERROR    = 4002
 	PROMETHEUS_QUERY_VALIDATE_ERROR = 4003
+
+	SEVERITY_GET_ERROR    = 5001
+	SEVERITY_CREATE_ERROR = 5002
+	SEVERITY_UPDATE_ERROR = 5003
+	SEVERITY_DELETE_ERROR = 5004
+
+	INCIDENT_GET_ERROR = 6001
 )
 
 var AnalyzerResultCodeMap = map[uint16]string{
@@ -52,14 +82,36 @@ var AnalyzerResultCodeMap = map[uint16]string{
 	SOCKET_ERROR:   "Network Error",
 	DETECTOR_ERROR: "Unable to connect to detector",
 
-	RULES_GET_ERROR:    "Failed to get rule list",
-	RULES_CREATE_ERROR: "Failed to create rule",
-	RULES_UPDATE_ERROR: "Failed to update rule",
-	RULES_DELETE_ERROR: "Failed to delete rule",
+	RULES_GET_ERROR:             "Failed to get rule list",
+	RULES_CREATE_ERROR:          "Failed to create rule",
+	RULES_UPDATE_ERROR:          "Failed to update rule",
+	RULES_DELETE_ERROR:          "Failed to delete rule",
+	RULES_BACKTEST_ERROR:        "Failed to backtest rule",
+	RULES_GET_HISTORY_ERROR:     "Failed to get rule history",
+	RULES_DIFF_ERROR:            "Failed to diff rule revisions",
+	RULES_ROLLBACK_ERROR:        "Failed to rollback rule",
+	RULES_EXPORT_ERROR:          "Failed to export rules",
+	RULES_IMPORT_ERROR:          "Failed to import rules",
+	RULES_EXPAND_ERROR:          "Failed to expand rules",
+	RULES_ENABLE_ERROR:          "Failed to enable rules",
+	RULES_DISABLE_ERROR:         "Failed to disable rules",
+	RULES_LINT_ERROR:            "Failed to lint rule",
+	RULES_GET_SYNC_STATUS_ERROR: "Failed to get rule sync status",
 
 	ANALYSIS_GET_RESULT_ERROR:    "Failed to get analysis result",
 	ANALYSIS_DELETE_RESULT_ERROR: "Failed to delete analysis result",
 	ANALYSIS_GET_RAW_DATA_ERROR:  "Failed to get raw data",
+	ANALYSIS_ACKNOWLEDGE_ERROR:   "Failed to acknowledge analysis result",
+	ANALYSIS_UNACKNOWLEDGE_ERROR: "Failed to unacknowledge analysis result",
+	ANALYSIS_ASSIGN_ERROR:        "Failed to assign analysis result",
+	ANALYSIS_RESOLVE_ERROR:       "Failed to resolve analysis result",
+	ANALYSIS_COMMENT_ERROR:       "Failed to comment on analysis result",
+	ANALYSIS_GET_EVENTS_ERROR:    "Failed to get analysis result events",
+	ANALYSIS_EXPORT_ERROR:        "Failed to export analysis results",
+	ANALYSIS_GET_SUMMARY_ERROR:   "Failed to get analysis summary",
+	ANALYSIS_GET_STATS_ERROR:     "Failed to get analysis statistics",
+	ANALYSIS_GET_TIMELINE_ERROR:  "Failed to get analysis result timeline",
+	ANALYSIS_GET_CONTEXT_ERROR:   "Failed to get analysis result context",
 
 	MONITOR_GET_NODE_STATUS_ERROR:              "Failed to get node state",
 	MONITOR_GET_NODE_INFO_ERROR:                "Fauled to get node info monitor data",
@@ -68,10 +120,18 @@ var AnalyzerResultCodeMap = map[uint16]string{
 	MONITOR_GET_CLUSTER_RESOURCES_ERROR:        "Failed to get cluster resources monitor data",
 	MONITOR_GET_CLUSTER_CONTAINER_STATUS_ERROR: "Failed to get cluster container status",
 	MONITOR_GET_TARGET_ERROR:                   "Failed to get monitor target",
+	MONITOR_STREAM_ERROR:                       "Failed to stream monitor data",
 
 	PROMETHEUS_QUERY_ERROR:          "Failed to query prometheus",
 	PROMETHEUS_QUERY_RANGE_ERROR:    "Failed to query range prometheus",
 	PROMETHEUS_QUERY_VALIDATE_ERROR: "Failed to validate query expression",
+
+	SEVERITY_GET_ERROR:    "Failed to get severity list",
+	SEVERITY_CREATE_ERROR: "Failed to create severity",
+	SEVERITY_UPDATE_ERROR: "Failed to update severity",
+	SEVERITY_DELETE_ERROR: "Failed to delete severity",
+
+	INCIDENT_GET_ERROR: "Failed to get incident list",
 }
 
 type Error struct {
@@ -36,11 +36,17 @@ func HandleOK(ctx *gin.Context, data interface{}) {
 }
 
 func HandleError(ctx *gin.Context, httpStatus int, err error) {
+	HandleErrorWithData(ctx, httpStatus, err, nil)
+}
+
+// HandleErrorWithData responds with an error along with data describing it,
+// such as the fields that failed validation.
+func HandleErrorWithData(ctx *gin.Context, httpStatus int, err error, data interface{}) {
 	r := &ResponseBody{
 		Status:    httpStatus,
 		Code:      int(err.(*cpdserr.Error).ResultCode),
 		Message:   err.Error(),
-		Data:      nil,
+		Data:      data,
 		Timestamp: time.Now().Unix(),
 	}
 	ctx.Error(err)
@@ -0,0 +1,179 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+// Package stream fans the events of one poller out to many subscribers.
+package stream
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Event is pushed to the subscribers of its topic. The last retained event
+// of every topic and name is kept and replayed to new subscribers, so that
+// they start from the current state.
+type Event struct {
+	Topic    string
+	Name     string
+	Data     interface{}
+	Retained bool
+}
+
+// Poller feeds a hub. Run publishes events until ctx is done.
+type Poller interface {
+	Run(ctx context.Context, publish func(Event))
+}
+
+// Hub runs its poller while it has subscribers, however many they are.
+// Subscribers not keeping up are dropped rather than slowing the others
+// down: their event channel is closed.
+type Hub struct {
+	poller     Poller
+	bufferSize int
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+	retained    map[retainedKey]Event
+	stop        context.CancelFunc
+}
+
+type retainedKey struct {
+	topic, name string
+}
+
+// Subscription receives the events of its topics, or of every topic if it
+// has none.
+type Subscription struct {
+	topics map[string]bool
+	events chan Event
+}
+
+// NewHub returns a hub buffering up to bufferSize events per subscriber.
+func NewHub(poller Poller, bufferSize int) *Hub {
+	return &Hub{
+		poller:      poller,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+		retained:    make(map[retainedKey]Event),
+	}
+}
+
+// Subscribe subscribes to topics, every topic if empty. The first subscriber
+// starts the poller.
+func (h *Hub) Subscribe(topics []string) *Subscription {
+	s := &Subscription{
+		topics: make(map[string]bool, len(topics)),
+		events: make(chan Event, h.bufferSize),
+	}
+	for _, topic := range topics {
+		s.topics[topic] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]retainedKey, 0, len(h.retained))
+	for key := range h.retained {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].topic != keys[j].topic {
+			return keys[i].topic < keys[j].topic
+		}
+		return keys[i].name < keys[j].name
+	})
+	for _, key := range keys {
+		if e := h.retained[key]; s.wants(e.Topic) {
+			select {
+			case s.events <- e:
+			default:
+			}
+		}
+	}
+
+	h.subscribers[s] = struct{}{}
+	if h.stop == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		h.stop = cancel
+		go h.poller.Run(ctx, func(e Event) { h.publish(ctx, e) })
+	}
+	return s
+}
+
+// Unsubscribe closes the event channel of s. The last subscriber leaving
+// stops the poller.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// Subscribers returns the number of subscribers.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+func (h *Hub) publish(ctx context.Context, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// a stopped poller may still be finishing a poll
+	if ctx.Err() != nil {
+		return
+	}
+
+	if e.Retained {
+		h.retained[retainedKey{e.Topic, e.Name}] = e
+	}
+	for s := range h.subscribers {
+		if !s.wants(e.Topic) {
+			continue
+		}
+		select {
+		case s.events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// remove removes s, the caller holds the lock.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subscribers[s]; !ok {
+		return
+	}
+	delete(h.subscribers, s)
+	close(s.events)
+
+	if len(h.subscribers) == 0 && h.stop != nil {
+		h.stop()
+		h.stop = nil
+		h.retained = make(map[retainedKey]Event)
+	}
+}
+
+// Events returns the events of the subscription, closed once it is
+// unsubscribed or dropped.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) wants(topic string) bool {
+	return len(s.topics) == 0 || s.topics[topic]
+}
@@ -0,0 +1,100 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// chanPoller publishes the events sent on its channel, and reports its runs
+// starting and stopping.
+type chanPoller struct {
+	events  chan Event
+	running chan bool
+}
+
+func (p *chanPoller) Run(ctx context.Context, publish func(Event)) {
+	p.running <- true
+	defer func() { p.running <- false }()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-p.events:
+			publish(e)
+		}
+	}
+}
+
+func receive(t *testing.T, s *Subscription) Event {
+	t.Helper()
+	select {
+	case e := <-s.Events():
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestHub(t *testing.T) {
+	poller := &chanPoller{events: make(chan Event), running: make(chan bool, 1)}
+	hub := NewHub(poller, 2)
+
+	all := hub.Subscribe(nil)
+	if !<-poller.running {
+		t.Fatal("poller not started by the first subscriber")
+	}
+	results := hub.Subscribe([]string{"results"})
+
+	poller.events <- Event{Topic: "node_status", Name: "node_status", Data: 1, Retained: true}
+	poller.events <- Event{Topic: "results", Name: "result", Data: 2}
+
+	if e := receive(t, all); e.Data != 1 {
+		t.Errorf("first event = %v, want node status", e.Data)
+	}
+	if e := receive(t, all); e.Data != 2 {
+		t.Errorf("second event = %v, want result", e.Data)
+	}
+	if e := receive(t, results); e.Data != 2 {
+		t.Errorf("filtered event = %v, want result", e.Data)
+	}
+
+	late := hub.Subscribe([]string{"node_status"})
+	if e := receive(t, late); e.Data != 1 {
+		t.Errorf("replayed event = %v, want the retained node status", e.Data)
+	}
+
+	// results does not read, it is dropped once its buffer is full
+	for i := 0; i < 3; i++ {
+		poller.events <- Event{Topic: "results", Name: "result", Data: 3 + i}
+		receive(t, all)
+	}
+	for range results.Events() {
+	}
+	if n := hub.Subscribers(); n != 2 {
+		t.Errorf("Subscribers() = %d, want 2 after the slow subscriber is dropped", n)
+	}
+
+	hub.Unsubscribe(all)
+	hub.Unsubscribe(late)
+	if <-poller.running {
+		t.Fatal("poller not stopped by the last subscriber")
+	}
+}
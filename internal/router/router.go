@@ -25,6 +25,7 @@ import (
 	gormlogger "gorm.io/gorm/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -55,12 +56,16 @@ func InitRouter(debug bool, config *config.Config, logger *zap.Logger, db *gorm.
 	// test route
 	router.GET("/ping", handlers.GetPing)
 
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	apiv1 := router.Group("/api/v1")
 	{
 		setRulesRouter(apiv1, r)
 		setAnalysisRouter(apiv1, r)
 		setMonitorRouter(apiv1, r)
 		setPrometheusRouter(apiv1, r)
+		setSeverityRouter(apiv1, r)
+		setIncidentRouter(apiv1, r)
 	}
 
 	initDatabaseTable(db)
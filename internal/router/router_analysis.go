@@ -28,6 +28,18 @@ func setAnalysisRouter(api *gin.RouterGroup, r *resource) {
 		analysisHandler := analysisHandler.New(r.logger, r.db, r.config)
 		rulesApi.GET("/result", analysisHandler.GetResult())
 		rulesApi.POST("/result/delete", analysisHandler.DeleteResult())
+		rulesApi.POST("/result/acknowledge", analysisHandler.AcknowledgeResults())
+		rulesApi.GET("/result/export", analysisHandler.ExportResults())
 		rulesApi.GET("/result/raw_data", analysisHandler.GetRawData())
+		rulesApi.GET("/summary", analysisHandler.GetSummary())
+		rulesApi.GET("/stats", analysisHandler.GetStats())
+		rulesApi.POST("/result/:id/acknowledge", analysisHandler.Acknowledge())
+		rulesApi.POST("/result/:id/unacknowledge", analysisHandler.Unacknowledge())
+		rulesApi.POST("/result/:id/assign", analysisHandler.Assign())
+		rulesApi.POST("/result/:id/resolve", analysisHandler.Resolve())
+		rulesApi.POST("/result/:id/comment", analysisHandler.Comment())
+		rulesApi.GET("/result/:id/events", analysisHandler.GetEvents())
+		rulesApi.GET("/result/:id/timeline", analysisHandler.GetTimeline())
+		rulesApi.GET("/result/:id/context", analysisHandler.GetContext())
 	}
 }
@@ -25,7 +25,7 @@ import (
 func setMonitorRouter(api *gin.RouterGroup, r *resource) {
 	monitorApi := api.Group("monitor")
 	{
-		handler := monitorHandler.New(r.config, r.logger)
+		handler := monitorHandler.New(r.config, r.logger, r.db)
 		monitorApi.GET("/targets", handler.GetMonitorTargets())
 		monitorApi.GET("/node_info", handler.GetNodeInfo())
 		monitorApi.GET("/node_status", handler.GetNodeStatus())
@@ -33,5 +33,6 @@ func setMonitorRouter(api *gin.RouterGroup, r *resource) {
 		monitorApi.GET("/node_resources", handler.GetNodeResource())
 		monitorApi.GET("/cluster_resources", handler.GetClusterResource())
 		monitorApi.GET("/cluster_container_status", handler.GetClusterContainerStatus())
+		monitorApi.GET("/stream", handler.Stream())
 	}
 }
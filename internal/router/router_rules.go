@@ -30,5 +30,16 @@ func setRulesRouter(api *gin.RouterGroup, r *resource) {
 		rulesApi.POST("/create", rulesHandler.Create())
 		rulesApi.POST("/delete", rulesHandler.Delete())
 		rulesApi.POST("/update", rulesHandler.Update())
+		rulesApi.POST("/backtest", rulesHandler.Backtest())
+		rulesApi.POST("/lint", rulesHandler.Lint())
+		rulesApi.GET("/export", rulesHandler.Export())
+		rulesApi.POST("/import", rulesHandler.Import())
+		rulesApi.GET("/expanded", rulesHandler.GetExpanded())
+		rulesApi.GET("/sync_status", rulesHandler.GetSyncStatus())
+		rulesApi.POST("/enable", rulesHandler.Enable())
+		rulesApi.POST("/disable", rulesHandler.Disable())
+		rulesApi.GET("/:id/history", rulesHandler.GetHistory())
+		rulesApi.GET("/:id/diff", rulesHandler.Diff())
+		rulesApi.POST("/:id/rollback", rulesHandler.Rollback())
 	}
 }
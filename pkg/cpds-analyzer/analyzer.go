@@ -18,6 +18,7 @@ package analyzer
 
 import (
 	"context"
+	"cpds/cpds-analyzer/internal/jobs"
 	"cpds/cpds-analyzer/internal/router"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config"
 	"cpds/cpds-analyzer/pkg/logger"
@@ -82,6 +83,10 @@ func (s *Analyzer) PrepareRun() error {
 func (s *Analyzer) Run() error {
 	r := router.InitRouter(s.Debug, s.Config, s.Logger, s.DB)
 
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobs.Start(jobsCtx, s.Config, s.Logger, s.DB)
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", s.Config.GenericOptions.Port),
 		Handler: r,
@@ -92,10 +97,11 @@ func (s *Analyzer) Run() error {
 		}
 	}()
 
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	s.Logger.Info("Shutdown Server ...")
+	stopJobs()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -0,0 +1,78 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cache
+
+import (
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Options is the in memory cache of the detector and prometheus responses.
+// Every duration is how long the responses of an endpoint are kept, zero
+// disabling caching for it.
+type Options struct {
+	Enabled         bool   `json:"enabled" yaml:"enabled"`
+	Targets         string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	NodeInfo        string `json:"nodeInfo,omitempty" yaml:"nodeInfo,omitempty"`
+	NodeStatus      string `json:"nodeStatus,omitempty" yaml:"nodeStatus,omitempty"`
+	ContainerStatus string `json:"containerStatus,omitempty" yaml:"containerStatus,omitempty"`
+	Resources       string `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Query           string `json:"query,omitempty" yaml:"query,omitempty"`
+	QueryRange      string `json:"queryRange,omitempty" yaml:"queryRange,omitempty"`
+}
+
+func NewCacheOptions() *Options {
+	return &Options{
+		Enabled:         true,
+		Targets:         "10s",
+		NodeInfo:        "1m",
+		NodeStatus:      "5s",
+		ContainerStatus: "5s",
+		Resources:       "30s",
+		Query:           "10s",
+		QueryRange:      "30s",
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !s.Enabled {
+		return errs
+	}
+
+	for _, d := range []string{s.Targets, s.NodeInfo, s.NodeStatus, s.ContainerStatus, s.Resources, s.Query, s.QueryRange} {
+		if !timeutils.IsValidDuration(d) {
+			errs = append(errs, fmt.Errorf("invalid time duration format: %s", d))
+		}
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.BoolVar(&s.Enabled, "cache-enabled", c.Enabled, "cache the detector and prometheus responses")
+	fs.StringVar(&s.Targets, "cache-targets", c.Targets, "how long the monitor targets are cached")
+	fs.StringVar(&s.NodeInfo, "cache-node-info", c.NodeInfo, "how long the node info is cached")
+	fs.StringVar(&s.NodeStatus, "cache-node-status", c.NodeStatus, "how long the node status is cached")
+	fs.StringVar(&s.ContainerStatus, "cache-container-status", c.ContainerStatus, "how long the container status is cached")
+	fs.StringVar(&s.Resources, "cache-resources", c.Resources, "how long the node and cluster resources are cached")
+	fs.StringVar(&s.Query, "cache-query", c.Query, "how long the prometheus queries are cached")
+	fs.StringVar(&s.QueryRange, "cache-query-range", c.QueryRange, "how long the prometheus range queries are cached")
+}
@@ -0,0 +1,103 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package cluster
+
+import (
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
+	"cpds/cpds-analyzer/pkg/utils/net"
+	"fmt"
+	"regexp"
+)
+
+var nameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Options is a cluster the analyzer manages, with its own detector. The
+// timeout and retries of the detector are the ones of the detector section.
+// Datasource is the datasource of the cluster, the detector when not set.
+type Options struct {
+	Name       string              `json:"name" yaml:"name"`
+	Host       string              `json:"host,omitempty" yaml:"host,omitempty"`
+	Port       int                 `json:"port,omitempty" yaml:"port,omitempty"`
+	Datasource *datasource.Options `json:"datasource,omitempty" yaml:"datasource,omitempty"`
+}
+
+// List is the clusters of the configuration. When empty, the analyzer
+// manages a single cluster through the detector and datasource sections.
+type List []*Options
+
+func NewClusterOptions() List {
+	return List{}
+}
+
+// DatasourceOptions returns the datasource of the cluster, the timeout
+// defaulting to the one of the datasource section.
+func (s *Options) DatasourceOptions() *datasource.Options {
+	options := datasource.NewDatasourceOptions()
+	if s.Datasource == nil {
+		return options
+	}
+
+	d := *s.Datasource
+	if d.Type == "" {
+		d.Type = options.Type
+	}
+	if d.Timeout == "" {
+		d.Timeout = options.Timeout
+	}
+	return &d
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !nameRegexp.MatchString(s.Name) {
+		errs = append(errs, fmt.Errorf("invalid cluster name: %q, should be lowercase alphanumeric characters or '-'", s.Name))
+	}
+
+	if !net.IsValidIPAdress(s.Host) {
+		errs = append(errs, fmt.Errorf("cluster %s: wrong IP Address format: %s", s.Name, s.Host))
+	}
+
+	if !net.IsValidPort(s.Port) {
+		errs = append(errs, fmt.Errorf("cluster %s: invalid port number range: %d, should be 0 - 65535", s.Name, s.Port))
+	}
+
+	for _, err := range s.DatasourceOptions().Validate() {
+		errs = append(errs, fmt.Errorf("cluster %s: %w", s.Name, err))
+	}
+
+	return errs
+}
+
+func (s List) Validate() []error {
+	errs := []error{}
+
+	names := make(map[string]bool, len(s))
+	for _, c := range s {
+		if c == nil {
+			errs = append(errs, fmt.Errorf("empty cluster"))
+			continue
+		}
+		if names[c.Name] {
+			errs = append(errs, fmt.Errorf("duplicate cluster name: %s", c.Name))
+		}
+		names[c.Name] = true
+		errs = append(errs, c.Validate()...)
+	}
+
+	return errs
+}
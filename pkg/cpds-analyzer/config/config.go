@@ -17,10 +17,17 @@
 package config
 
 import (
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cache"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/cluster"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/database"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/datasource"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/detector"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/flapping"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/generic"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/incident"
 	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/logger"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/retention"
+	"cpds/cpds-analyzer/pkg/cpds-analyzer/config/stream"
 	"fmt"
 	"strings"
 
@@ -37,18 +44,32 @@ const (
 
 // Config defines everything needed for cpds-analyzer to deal with external services
 type Config struct {
-	GenericOptions  *generic.Options  `json:"generic,omitempty" yaml:"generic,omitempty" mapstructure:"generic"`
-	DatabaseOptions *database.Options `json:"database,omitempty" yaml:"database,omitempty" mapstructure:"database"`
-	DetectorOptions *detector.Options `json:"detector,omitempty" yaml:"detector,omitempty" mapstructure:"detector"`
-	LoggerOptions   *logger.Options   `json:"log,omitempty" yaml:"log,omitempty" mapstructure:"log"`
+	GenericOptions    *generic.Options    `json:"generic,omitempty" yaml:"generic,omitempty" mapstructure:"generic"`
+	DatabaseOptions   *database.Options   `json:"database,omitempty" yaml:"database,omitempty" mapstructure:"database"`
+	DetectorOptions   *detector.Options   `json:"detector,omitempty" yaml:"detector,omitempty" mapstructure:"detector"`
+	DatasourceOptions *datasource.Options `json:"datasource,omitempty" yaml:"datasource,omitempty" mapstructure:"datasource"`
+	CacheOptions      *cache.Options      `json:"cache,omitempty" yaml:"cache,omitempty" mapstructure:"cache"`
+	LoggerOptions     *logger.Options     `json:"log,omitempty" yaml:"log,omitempty" mapstructure:"log"`
+	RetentionOptions  *retention.Options  `json:"retention,omitempty" yaml:"retention,omitempty" mapstructure:"retention"`
+	FlappingOptions   *flapping.Options   `json:"flapping,omitempty" yaml:"flapping,omitempty" mapstructure:"flapping"`
+	IncidentOptions   *incident.Options   `json:"incident,omitempty" yaml:"incident,omitempty" mapstructure:"incident"`
+	StreamOptions     *stream.Options     `json:"stream,omitempty" yaml:"stream,omitempty" mapstructure:"stream"`
+	Clusters          cluster.List        `json:"clusters,omitempty" yaml:"clusters,omitempty" mapstructure:"clusters"`
 }
 
 func New() *Config {
 	return &Config{
-		GenericOptions:  generic.NewGenericOptions(),
-		DatabaseOptions: database.NewDatabaseOptions(),
-		DetectorOptions: detector.NewDetectorOptions(),
-		LoggerOptions:   logger.NewLoggerOptions(),
+		GenericOptions:    generic.NewGenericOptions(),
+		DatabaseOptions:   database.NewDatabaseOptions(),
+		DetectorOptions:   detector.NewDetectorOptions(),
+		DatasourceOptions: datasource.NewDatasourceOptions(),
+		CacheOptions:      cache.NewCacheOptions(),
+		LoggerOptions:     logger.NewLoggerOptions(),
+		RetentionOptions:  retention.NewRetentionOptions(),
+		FlappingOptions:   flapping.NewFlappingOptions(),
+		IncidentOptions:   incident.NewIncidentOptions(),
+		StreamOptions:     stream.NewStreamOptions(),
+		Clusters:          cluster.NewClusterOptions(),
 	}
 }
 
@@ -0,0 +1,124 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package datasource
+
+import (
+	stringutil "cpds/cpds-analyzer/pkg/utils/string"
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	// TypeDetector proxies the queries through the detector
+	TypeDetector = "detector"
+	// TypePrometheus sends the queries to a Prometheus compatible api
+	TypePrometheus = "prometheus"
+)
+
+var Types = []string{TypeDetector, TypePrometheus}
+
+// Options is where the PromQL queries of the analyzer are sent. The other
+// fields only apply to the prometheus type, basic auth and bearer token
+// are exclusive.
+type Options struct {
+	Type            string     `json:"type" yaml:"type"`
+	URL             string     `json:"url,omitempty" yaml:"url,omitempty"`
+	Username        string     `json:"username,omitempty" yaml:"username,omitempty"`
+	Password        string     `json:"-" yaml:"password,omitempty"`
+	BearerToken     string     `json:"-" yaml:"bearerToken,omitempty"`
+	BearerTokenFile string     `json:"bearerTokenFile,omitempty" yaml:"bearerTokenFile,omitempty"`
+	Timeout         string     `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	TLS             TLSOptions `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// TLSOptions configure the connection to an https url. CertFile and KeyFile
+// are the client certificate, both or none are given.
+type TLSOptions struct {
+	CAFile             string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	CertFile           string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile            string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	ServerName         string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty" yaml:"insecureSkipVerify,omitempty"`
+}
+
+func NewDatasourceOptions() *Options {
+	return &Options{
+		Type:    TypeDetector,
+		Timeout: "20s",
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !stringutil.IsStringInArray(s.Type, Types) {
+		errs = append(errs, fmt.Errorf("invalid datasource type: %s, should be one of %v", s.Type, Types))
+		return errs
+	}
+
+	if s.Type == TypeDetector {
+		return errs
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("invalid datasource url: %s, should be an absolute http or https url", s.URL))
+	}
+
+	if s.Username != "" && (s.BearerToken != "" || s.BearerTokenFile != "") {
+		errs = append(errs, fmt.Errorf("datasource basic auth and bearer token are exclusive"))
+	}
+	if s.BearerToken != "" && s.BearerTokenFile != "" {
+		errs = append(errs, fmt.Errorf("datasource bearer token and bearer token file are exclusive"))
+	}
+
+	if !timeutils.IsValidDuration(s.Timeout) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Timeout))
+	}
+
+	if (s.TLS.CertFile == "") != (s.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("datasource tls cert file and key file should be given together"))
+	}
+	for _, file := range []string{s.BearerTokenFile, s.TLS.CAFile, s.TLS.CertFile, s.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("invalid datasource file: %s", err))
+		}
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.StringVar(&s.Type, "datasource-type", c.Type, "where queries are sent, detector or prometheus")
+	fs.StringVar(&s.URL, "datasource-url", c.URL, "url of the prometheus compatible api")
+	fs.StringVar(&s.Username, "datasource-username", c.Username, "basic auth username")
+	fs.StringVar(&s.Password, "datasource-password", c.Password, "basic auth password")
+	fs.StringVar(&s.BearerTokenFile, "datasource-bearer-token-file", c.BearerTokenFile, "file holding the bearer token")
+	fs.StringVar(&s.Timeout, "datasource-timeout", c.Timeout, "timeout of a query")
+	fs.StringVar(&s.TLS.CAFile, "datasource-tls-ca-file", c.TLS.CAFile, "ca certificate verifying the server")
+	fs.StringVar(&s.TLS.CertFile, "datasource-tls-cert-file", c.TLS.CertFile, "client certificate")
+	fs.StringVar(&s.TLS.KeyFile, "datasource-tls-key-file", c.TLS.KeyFile, "client certificate key")
+	fs.StringVar(&s.TLS.ServerName, "datasource-tls-server-name", c.TLS.ServerName, "server name verified in the server certificate")
+	fs.BoolVar(&s.TLS.InsecureSkipVerify, "datasource-tls-insecure-skip-verify", c.TLS.InsecureSkipVerify, "skip verifying the server certificate")
+}
@@ -18,20 +18,27 @@ package detector
 
 import (
 	"cpds/cpds-analyzer/pkg/utils/net"
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
 	"fmt"
 
 	"github.com/spf13/pflag"
 )
 
+// Options is the detector api. Timeout bounds every attempt of a request,
+// failed requests are retried up to Retries times.
 type Options struct {
-	Host string `json:"host,omitempty" yaml:"host,omitempty"`
-	Port int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Host    string `json:"host,omitempty" yaml:"host,omitempty"`
+	Port    int    `json:"port,omitempty" yaml:"port,omitempty"`
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Retries int    `json:"retries" yaml:"retries"`
 }
 
 func NewDetectorOptions() *Options {
 	return &Options{
-		Host: "127.0.0.1",
-		Port: 19092,
+		Host:    "127.0.0.1",
+		Port:    19092,
+		Timeout: "10s",
+		Retries: 2,
 	}
 }
 
@@ -46,10 +53,20 @@ func (s *Options) Validate() []error {
 		errs = append(errs, fmt.Errorf("invalid port number range: %d, should be 0 - 65535", s.Port))
 	}
 
+	if !timeutils.IsValidDuration(s.Timeout) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Timeout))
+	}
+
+	if s.Retries < 0 {
+		errs = append(errs, fmt.Errorf("invalid retries: %d, should not be negative", s.Retries))
+	}
+
 	return errs
 }
 
 func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
 	fs.StringVar(&s.Host, "detector-host", c.Host, "detector host IP address")
 	fs.IntVar(&s.Port, "detector-port", c.Port, "detector port number")
+	fs.StringVar(&s.Timeout, "detector-timeout", c.Timeout, "timeout of every attempt of a detector request")
+	fs.IntVar(&s.Retries, "detector-retries", c.Retries, "times a failed detector request is retried")
 }
@@ -0,0 +1,72 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package flapping
+
+import (
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Options is the flapping detection of the analysis results. A rule flaps on
+// an instance when its results make at least Transitions state transitions
+// within Window. Results are checked every Interval.
+type Options struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	Interval    string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Window      string `json:"window,omitempty" yaml:"window,omitempty"`
+	Transitions int    `json:"transitions,omitempty" yaml:"transitions,omitempty"`
+}
+
+func NewFlappingOptions() *Options {
+	return &Options{
+		Enabled:     true,
+		Interval:    "30s",
+		Window:      "1h",
+		Transitions: 6,
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !s.Enabled {
+		return errs
+	}
+
+	if !timeutils.IsValidDuration(s.Interval) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Interval))
+	}
+
+	if !timeutils.IsValidDuration(s.Window) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Window))
+	}
+
+	if s.Transitions < 2 {
+		errs = append(errs, fmt.Errorf("invalid transitions: %d, should be at least 2", s.Transitions))
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.BoolVar(&s.Enabled, "flapping-enabled", c.Enabled, "detect flapping analysis results")
+	fs.StringVar(&s.Interval, "flapping-interval", c.Interval, "how often flapping is checked")
+	fs.StringVar(&s.Window, "flapping-window", c.Window, "window the state transitions are counted in")
+	fs.IntVar(&s.Transitions, "flapping-transitions", c.Transitions, "state transitions within the window making a rule flap")
+}
@@ -0,0 +1,73 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package incident
+
+import (
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Options is the grouping of analysis results into incidents. Results
+// sharing an instance or a pod are grouped when they are active within
+// Window of each other. At most BatchSize results are grouped every
+// Interval.
+type Options struct {
+	Enabled   bool   `json:"enabled" yaml:"enabled"`
+	Interval  string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Window    string `json:"window,omitempty" yaml:"window,omitempty"`
+	BatchSize int    `json:"batchSize,omitempty" yaml:"batchSize,omitempty"`
+}
+
+func NewIncidentOptions() *Options {
+	return &Options{
+		Enabled:   true,
+		Interval:  "30s",
+		Window:    "5m",
+		BatchSize: 1000,
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !s.Enabled {
+		return errs
+	}
+
+	if !timeutils.IsValidDuration(s.Interval) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Interval))
+	}
+
+	if !timeutils.IsValidDuration(s.Window) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Window))
+	}
+
+	if s.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("invalid batch size: %d, should be positive", s.BatchSize))
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.BoolVar(&s.Enabled, "incident-enabled", c.Enabled, "group analysis results into incidents")
+	fs.StringVar(&s.Interval, "incident-interval", c.Interval, "how often results are grouped")
+	fs.StringVar(&s.Window, "incident-window", c.Window, "time between results still grouped together")
+	fs.IntVar(&s.BatchSize, "incident-batch-size", c.BatchSize, "results grouped per run")
+}
@@ -0,0 +1,106 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package retention
+
+import (
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	ArchiveNone  = "none"
+	ArchiveTable = "table"
+	ArchiveFile  = "file"
+)
+
+// Options is the retention policy of the analysis results. Results not
+// updated for MaxAge are pruned, then the oldest ones beyond MaxRows. Fault
+// results are never pruned when KeepFault is set. Pruned results are archived
+// first, to the analysis_archive table or to gzip compressed jsonl files in
+// ArchiveDir.
+type Options struct {
+	Enabled    bool   `json:"enabled" yaml:"enabled"`
+	Interval   string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	MaxAge     string `json:"maxAge,omitempty" yaml:"maxAge,omitempty"`
+	MaxRows    int    `json:"maxRows,omitempty" yaml:"maxRows,omitempty"`
+	KeepFault  bool   `json:"keepFault" yaml:"keepFault"`
+	BatchSize  int    `json:"batchSize,omitempty" yaml:"batchSize,omitempty"`
+	Archive    string `json:"archive,omitempty" yaml:"archive,omitempty"`
+	ArchiveDir string `json:"archiveDir,omitempty" yaml:"archiveDir,omitempty"`
+}
+
+func NewRetentionOptions() *Options {
+	return &Options{
+		Enabled:    false,
+		Interval:   "1h",
+		MaxAge:     "90d",
+		MaxRows:    0,
+		KeepFault:  true,
+		BatchSize:  500,
+		Archive:    ArchiveTable,
+		ArchiveDir: "/var/lib/cpds/cpds-analyzer/archive",
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !s.Enabled {
+		return errs
+	}
+
+	if !timeutils.IsValidDuration(s.Interval) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Interval))
+	}
+
+	// an empty max age only prunes by row count
+	if s.MaxAge != "" && !timeutils.IsValidDuration(s.MaxAge) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.MaxAge))
+	}
+
+	if s.MaxRows < 0 {
+		errs = append(errs, fmt.Errorf("invalid max rows: %d, should not be negative", s.MaxRows))
+	}
+
+	if s.BatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("invalid batch size: %d, should be positive", s.BatchSize))
+	}
+
+	switch s.Archive {
+	case ArchiveNone, ArchiveTable:
+	case ArchiveFile:
+		if s.ArchiveDir == "" {
+			errs = append(errs, fmt.Errorf("archive directory is required to archive to files"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid archive: %s, should be %s, %s or %s", s.Archive, ArchiveNone, ArchiveTable, ArchiveFile))
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.BoolVar(&s.Enabled, "retention-enabled", c.Enabled, "prune old analysis results")
+	fs.StringVar(&s.Interval, "retention-interval", c.Interval, "how often analysis results are pruned")
+	fs.StringVar(&s.MaxAge, "retention-max-age", c.MaxAge, "prune analysis results not updated for this long")
+	fs.IntVar(&s.MaxRows, "retention-max-rows", c.MaxRows, "maximum number of analysis results kept, 0 for no limit")
+	fs.BoolVar(&s.KeepFault, "retention-keep-fault", c.KeepFault, "never prune fault analysis results")
+	fs.StringVar(&s.Archive, "retention-archive", c.Archive, `where pruned analysis results are archived ("none"|"table"|"file")`)
+	fs.StringVar(&s.ArchiveDir, "retention-archive-dir", c.ArchiveDir, "directory of the archive files")
+}
@@ -0,0 +1,66 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package stream
+
+import (
+	timeutils "cpds/cpds-analyzer/pkg/utils/time"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// Options is the monitor stream. While anyone is subscribed, the detector
+// and the results are polled every Interval. Heartbeat keeps idle streams
+// open through proxies and BufferSize is how many events a subscriber may
+// lag behind before it is dropped.
+type Options struct {
+	Interval   string `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Heartbeat  string `json:"heartbeat,omitempty" yaml:"heartbeat,omitempty"`
+	BufferSize int    `json:"bufferSize,omitempty" yaml:"bufferSize,omitempty"`
+}
+
+func NewStreamOptions() *Options {
+	return &Options{
+		Interval:   "5s",
+		Heartbeat:  "15s",
+		BufferSize: 64,
+	}
+}
+
+func (s *Options) Validate() []error {
+	errs := []error{}
+
+	if !timeutils.IsValidDuration(s.Interval) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Interval))
+	}
+
+	if !timeutils.IsValidDuration(s.Heartbeat) {
+		errs = append(errs, fmt.Errorf("invalid time duration format: %s", s.Heartbeat))
+	}
+
+	if s.BufferSize <= 0 {
+		errs = append(errs, fmt.Errorf("invalid buffer size: %d, should be positive", s.BufferSize))
+	}
+
+	return errs
+}
+
+func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
+	fs.StringVar(&s.Interval, "stream-interval", c.Interval, "how often the streamed data is polled")
+	fs.StringVar(&s.Heartbeat, "stream-heartbeat", c.Heartbeat, "how often idle streams are kept alive")
+	fs.IntVar(&s.BufferSize, "stream-buffer-size", c.BufferSize, "events a subscriber may lag behind")
+}
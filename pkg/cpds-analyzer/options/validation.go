@@ -22,7 +22,14 @@ func (s *ServerRunOptions) Validate() []error {
 	errors = append(errors, s.GenericOptions.Validate()...)
 	errors = append(errors, s.DatabaseOptions.Validate()...)
 	errors = append(errors, s.DetectorOptions.Validate()...)
+	errors = append(errors, s.DatasourceOptions.Validate()...)
+	errors = append(errors, s.CacheOptions.Validate()...)
 	errors = append(errors, s.LoggerOptions.Validate()...)
+	errors = append(errors, s.RetentionOptions.Validate()...)
+	errors = append(errors, s.FlappingOptions.Validate()...)
+	errors = append(errors, s.IncidentOptions.Validate()...)
+	errors = append(errors, s.StreamOptions.Validate()...)
+	errors = append(errors, s.Clusters.Validate()...)
 
 	return errors
 }
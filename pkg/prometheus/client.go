@@ -0,0 +1,152 @@
+/*
+ *  Copyright 2023 CPDS Author
+ *
+ *  Licensed under the Apache License, Version 2.0 (the "License");
+ *  you may not use this file except in compliance with the License.
+ *  You may obtain a copy of the License at
+ *
+ *       https://www.apache.org/licenses/LICENSE-2.0
+ *
+ *  Unless required by applicable law or agreed to in writing, software
+ *  distributed under the License is distributed on an "AS IS" BASIS,
+ *  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *  See the License for the specific language governing permissions and
+ *  limitations under the License.
+ */
+
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	apiv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+)
+
+// Client queries a Prometheus compatible api, a query is cancelled with its
+// ctx.
+type Client interface {
+	GetSingleMetric(ctx context.Context, expr string, ts time.Time) Metric
+
+	GetSingleMetricOverTime(ctx context.Context, expr string, start, end time.Time, step time.Duration) Metric
+
+	GetMultiMetrics(ctx context.Context, metrics map[string]string, ts time.Time) []Metric
+
+	GetMultiMetricsOverTime(ctx context.Context, metrics map[string]string, start, end time.Time, step time.Duration) []Metric
+}
+
+// ClientOptions configure a Client. Basic auth and bearer token are
+// exclusive, BearerTokenFile is read on every request so that rotated tokens
+// are picked up. A zero Timeout is MeteringDefaultTimeout.
+type ClientOptions struct {
+	URL                string
+	Username           string
+	Password           string
+	BearerToken        string
+	BearerTokenFile    string
+	Timeout            time.Duration
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// NewClient returns a client of the api at options.URL.
+func NewClient(options *ClientOptions) (Client, error) {
+	tlsConfig, err := newTLSConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := api.DefaultRoundTripper.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = MeteringDefaultTimeout
+	}
+
+	client, err := api.NewClient(api.Config{
+		Address: options.URL,
+		Client: &http.Client{
+			Transport: &authRoundTripper{options: options, next: transport},
+			Timeout:   timeout,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prometheus{client: apiv1.NewAPI(client)}, nil
+}
+
+func newTLSConfig(options *ClientOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         options.ServerName,
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CAFile != "" {
+		ca, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", options.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// authRoundTripper sets the basic auth or the bearer token of the options on
+// every request.
+type authRoundTripper struct {
+	options *ClientOptions
+	next    http.RoundTripper
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := rt.options.BearerToken
+	if rt.options.BearerTokenFile != "" {
+		data, err := os.ReadFile(rt.options.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read bearer token file: %s", err)
+		}
+		token = strings.TrimSpace(string(data))
+		if token == "" {
+			return nil, errors.New("empty bearer token file")
+		}
+	}
+
+	if token == "" && rt.options.Username == "" {
+		return rt.next.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		req.SetBasicAuth(rt.options.Username, rt.options.Password)
+	}
+	return rt.next.RoundTrip(req)
+}
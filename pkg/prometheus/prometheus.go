@@ -43,10 +43,10 @@ func NewPrometheus(host string, port int) (prometheus, error) {
 	return prometheus{client: apiv1.NewAPI(client)}, err
 }
 
-func (p prometheus) GetSingleMetric(expr string, ts time.Time) Metric {
+func (p prometheus) GetSingleMetric(ctx context.Context, expr string, ts time.Time) Metric {
 	var parsedResp Metric
 
-	value, _, err := p.client.Query(context.Background(), expr, ts)
+	value, _, err := p.client.Query(ctx, expr, ts)
 	if err != nil {
 		parsedResp.Error = err.Error()
 	} else {
@@ -56,14 +56,14 @@ func (p prometheus) GetSingleMetric(expr string, ts time.Time) Metric {
 	return parsedResp
 }
 
-func (p prometheus) GetSingleMetricOverTime(expr string, start, end time.Time, step time.Duration) Metric {
+func (p prometheus) GetSingleMetricOverTime(ctx context.Context, expr string, start, end time.Time, step time.Duration) Metric {
 	timeRange := apiv1.Range{
 		Start: start,
 		End:   end,
 		Step:  step,
 	}
 
-	value, _, err := p.client.QueryRange(context.Background(), expr, timeRange)
+	value, _, err := p.client.QueryRange(ctx, expr, timeRange)
 
 	var parsedResp Metric
 	if err != nil {
@@ -74,7 +74,7 @@ func (p prometheus) GetSingleMetricOverTime(expr string, start, end time.Time, s
 	return parsedResp
 }
 
-func (p prometheus) GetMultiMetrics(metrics map[string]string, ts time.Time) []Metric {
+func (p prometheus) GetMultiMetrics(ctx context.Context, metrics map[string]string, ts time.Time) []Metric {
 	var res []Metric
 	var mtx sync.Mutex
 	var wg sync.WaitGroup
@@ -84,7 +84,7 @@ func (p prometheus) GetMultiMetrics(metrics map[string]string, ts time.Time) []M
 		go func(name, expr string) {
 			parsedResp := Metric{MetricName: name}
 
-			value, _, err := p.client.Query(context.Background(), expr, ts)
+			value, _, err := p.client.Query(ctx, expr, ts)
 			if err != nil {
 				parsedResp.Error = err.Error()
 			} else {
@@ -104,7 +104,7 @@ func (p prometheus) GetMultiMetrics(metrics map[string]string, ts time.Time) []M
 	return res
 }
 
-func (p prometheus) GetMultiMetricsOverTime(metrics map[string]string, start, end time.Time, step time.Duration) []Metric {
+func (p prometheus) GetMultiMetricsOverTime(ctx context.Context, metrics map[string]string, start, end time.Time, step time.Duration) []Metric {
 	var res []Metric
 	var mtx sync.Mutex
 	var wg sync.WaitGroup
@@ -120,7 +120,7 @@ func (p prometheus) GetMultiMetricsOverTime(metrics map[string]string, start, en
 		go func(name, expr string) {
 			parsedResp := Metric{MetricName: name}
 
-			value, _, err := p.client.QueryRange(context.Background(), expr, timeRange)
+			value, _, err := p.client.QueryRange(ctx, expr, timeRange)
 			if err != nil {
 				parsedResp.Error = err.Error()
 			} else {